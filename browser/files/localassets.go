@@ -21,6 +21,7 @@ type LocalAssetBrowser struct {
 	log        *logger.Journal
 	sm         immich.SupportedMedia
 	whenNoDate string
+	tzFromGPS  bool // determine the time zone from the GPS coordinates when the file doesn't give it
 }
 
 func NewLocalFiles(ctx context.Context, log *logger.Journal, fsyss ...fs.FS) (*LocalAssetBrowser, error) {
@@ -42,6 +43,11 @@ func (la *LocalAssetBrowser) SetWhenNoDate(opt string) *LocalAssetBrowser {
 	return la
 }
 
+func (la *LocalAssetBrowser) SetTimeZoneFromGPS(b bool) *LocalAssetBrowser {
+	la.tzFromGPS = b
+	return la
+}
+
 var toOldDate = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
 
 func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAssetFile {
@@ -91,72 +97,128 @@ func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileC
 		return err
 	}
 
+	assets := []*browser.LocalAssetFile{}
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
 		}
-		fileName := path.Join(folder, e.Name())
-		la.log.AddEntry(fileName, logger.DiscoveredFile, "")
-		name := e.Name()
-		ext := strings.ToLower(path.Ext(name))
-
-		t := la.sm.TypeFromExt(ext)
-		switch t {
-		default:
-			la.log.AddEntry(fileName, logger.Unsupported, "")
-			continue
-		case immich.TypeIgnored:
-			la.log.AddEntry(name, logger.Discarded, "File ignored")
+		f := la.newAsset(fsys, folder, entries, e)
+		if f == nil {
 			continue
-		case immich.TypeSidecar:
-			la.log.AddEntry(name, logger.Metadata, "")
-			continue
-		case immich.TypeImage:
-			la.log.AddEntry(name, logger.ScannedImage, "")
-		case immich.TypeVideo:
-			la.log.AddEntry(name, logger.ScannedVideo, "")
-		}
-
-		f := browser.LocalAssetFile{
-			FSys:      fsys,
-			FileName:  path.Join(folder, name),
-			Title:     path.Base(name),
-			FileSize:  0,
-			Err:       err,
-			DateTaken: metadata.TakeTimeFromName(filepath.Base(name)),
 		}
+		assets = append(assets, f)
+	}
 
-		s, err := e.Info()
-		if err != nil {
-			f.Err = err
-		} else {
-			f.FileSize = int(s.Size())
-			if f.DateTaken.IsZero() {
-				err = la.ReadMetadataFromFile(&f)
-				_ = err
-				if f.DateTaken.Before(toOldDate) {
-					switch la.whenNoDate {
-					case "FILE":
-						f.DateTaken = s.ModTime()
-					case "NOW":
-						f.DateTaken = time.Now()
-					}
-				}
-			}
-			la.checkSidecar(&f, entries, folder, name)
-		}
+	for _, f := range la.pairLivePhotos(assets) {
 		// Check if the context has been cancelled
 		select {
 		case <-ctx.Done():
 			// If the context has been cancelled, return immediately
 			return ctx.Err()
 		default:
-			fileChan <- &f
+			fileChan <- f
 		}
 	}
 	return nil
 }
 
+// newAsset gives the asset of the folder's entry, or nil when the entry isn't an image or a video
+func (la *LocalAssetBrowser) newAsset(fsys fs.FS, folder string, entries []fs.DirEntry, e fs.DirEntry) *browser.LocalAssetFile {
+	fileName := path.Join(folder, e.Name())
+	la.log.AddFileEntry(fsys, fileName, logger.DiscoveredFile, "")
+	name := e.Name()
+	ext := strings.ToLower(path.Ext(name))
+
+	t := la.sm.TypeFromExt(ext)
+	switch t {
+	default:
+		la.log.AddFileEntry(fsys, fileName, logger.Unsupported, "")
+		return nil
+	case immich.TypeIgnored:
+		if ext != ".mp" {
+			la.log.AddFileEntry(fsys, fileName, logger.Discarded, "File ignored")
+			return nil
+		}
+		// Google's motion photos, kept when an image is paired with. Journaled once paired.
+	case immich.TypeSidecar:
+		la.log.AddFileEntry(fsys, fileName, logger.Metadata, "")
+		return nil
+	case immich.TypeImage:
+		la.log.AddFileEntry(fsys, fileName, logger.ScannedImage, "")
+	case immich.TypeVideo:
+		la.log.AddFileEntry(fsys, fileName, logger.ScannedVideo, "")
+	}
+
+	f := browser.LocalAssetFile{
+		FSys:      fsys,
+		FileName:  path.Join(folder, name),
+		Title:     path.Base(name),
+		FileSize:  0,
+		DateTaken: metadata.TakeTimeFromName(filepath.Base(name)),
+	}
+
+	s, err := e.Info()
+	if err != nil {
+		f.Err = err
+	} else {
+		f.FileSize = int(s.Size())
+		f.FileDate = s.ModTime()
+		if err = la.ReadMetadataFromFile(&f); err != nil {
+			// the file can't be read, it's journaled
+			return nil
+		}
+		if la.checkSidecar(&f, entries, folder, name) {
+			la.readSidecar(&f)
+		}
+		if f.DateTaken.Before(toOldDate) {
+			switch la.whenNoDate {
+			case "FILE":
+				f.DateTaken = s.ModTime()
+			case "NOW":
+				f.DateTaken = time.Now()
+			}
+		}
+	}
+	return &f
+}
+
+// pairLivePhotos attaches the videos of live photos to their image, the assets must be in the same folder
+func (la *LocalAssetBrowser) pairLivePhotos(assets []*browser.LocalAssetFile) []*browser.LocalAssetFile {
+	assets = browser.PairLivePhotos(assets, la.contentID)
+	r := assets[:0]
+	for _, a := range assets {
+		if strings.ToLower(path.Ext(a.FileName)) == ".mp" {
+			la.log.AddFileEntry(a.FSys, a.FileName, logger.Discarded, "File ignored")
+			continue
+		}
+		if v := a.LivePhoto; v != nil {
+			if strings.ToLower(path.Ext(v.FileName)) == ".mp" {
+				v.Title = browser.LivePhotoVideoTitle(a.Title, v.FileName)
+				v.DateTaken = a.DateTaken
+				la.log.AddFileEntry(v.FSys, v.FileName, logger.ScannedVideo, "motion photo")
+			}
+			la.log.AddFileEntry(a.FSys, a.FileName, logger.LivePhoto, "video: "+v.FileName)
+			la.log.AddFileEntry(v.FSys, v.FileName, logger.LivePhoto, "image: "+a.FileName)
+		}
+		r = append(r, a)
+	}
+	return r
+}
+
+// contentID reads the Apple's content identifier shared by the image and the video of a live photo
+func (la *LocalAssetBrowser) contentID(a *browser.LocalAssetFile) string {
+	f, err := a.FSys.Open(a.FileName)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	id, err := metadata.GetContentIdentifier(f, path.Ext(a.FileName))
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
 func (la *LocalAssetBrowser) checkSidecar(f *browser.LocalAssetFile, entries []fs.DirEntry, dir, name string) bool {
 	assetBase := la.baseNames(name)
 
@@ -172,7 +234,7 @@ func (la *LocalAssetBrowser) checkSidecar(f *browser.LocalAssetFile, entries []f
 					FileName: path.Join(dir, e.Name()),
 					OnFSsys:  true,
 				}
-				la.log.AddEntry(name, logger.AssociatedMetadata, "")
+				la.log.AddFileEntry(f.FSys, f.FileName, logger.AssociatedMetadata, "")
 				return true
 			}
 		}
@@ -180,6 +242,46 @@ func (la *LocalAssetBrowser) checkSidecar(f *browser.LocalAssetFile, entries []f
 	return false
 }
 
+// readSidecar applies the metadata of the XMP sidecar.
+// They take precedence over the file's metadata and the date found in the file name.
+func (la *LocalAssetBrowser) readSidecar(a *browser.LocalAssetFile) {
+	f, err := a.FSys.Open(a.SideCar.FileName)
+	if err != nil {
+		la.log.AddFileEntry(a.FSys, a.SideCar.FileName, logger.ERROR, err.Error())
+		return
+	}
+	defer f.Close()
+	m, err := metadata.ReadXMP(f)
+	if err != nil {
+		la.log.AddFileEntry(a.FSys, a.SideCar.FileName, logger.ERROR, err.Error())
+		return
+	}
+	if m.Latitude != 0 || m.Longitude != 0 {
+		a.Latitude, a.Longitude, a.Altitude = m.Latitude, m.Longitude, m.Altitude
+	}
+	if la.tzFromGPS {
+		m.Latitude, m.Longitude = a.Latitude, a.Longitude
+		m.ResolveTimeZone()
+	}
+	if !m.DateTaken.IsZero() {
+		a.DateTaken, a.TimeZone = m.DateTaken, m.TimeZone
+	}
+	if m.Description != "" {
+		a.Description = m.Description
+	} else if m.Title != "" {
+		a.Description = m.Title
+	}
+	if m.Rating != 0 {
+		a.Rating = m.Rating
+	}
+	if len(m.Keywords) > 0 {
+		a.Keywords = m.Keywords
+	}
+	if len(m.Faces) > 0 {
+		a.Faces = m.Faces
+	}
+}
+
 func (la *LocalAssetBrowser) baseNames(n string) []string {
 	n = escapeName(n)
 	names := []string{n}
@@ -213,17 +315,36 @@ func escapeName(n string) string {
 	return b.String()
 }
 
+// ReadMetadataFromFile reads the metadata of the file. The file is closed once read, it's opened again when uploaded.
+// The failures are journaled: the files without metadata are kept, the error is given when the file can't be read.
 func (la *LocalAssetBrowser) ReadMetadataFromFile(a *browser.LocalAssetFile) error {
 	ext := strings.ToLower(path.Ext(a.FileName))
 
 	// Open the file
+	defer a.Close()
 	r, err := a.PartialSourceReader()
 	if err != nil {
+		la.log.AddFileEntry(a.FSys, a.FileName, logger.ERROR, "can't read the metadata: "+err.Error())
 		return err
 	}
 	m, err := metadata.GetFromReader(r, ext)
-	if err == nil {
+	if err != nil {
+		la.log.AddFileEntry(a.FSys, a.FileName, logger.INFO, "no metadata: "+err.Error())
+	}
+	if la.tzFromGPS {
+		m.ResolveTimeZone()
+	}
+	// The date found in the file name takes precedence
+	if a.DateTaken.IsZero() && err == nil {
 		a.DateTaken = m.DateTaken
+	} else if !a.DateTaken.IsZero() && m.TimeZone != nil {
+		// The name gives the wall clock time of the capture
+		a.DateTaken = metadata.TakeTimeFromNameInLocation(path.Base(a.FileName), m.TimeZone)
 	}
-	return err
+	a.TimeZone = m.TimeZone
+	a.Latitude, a.Longitude, a.Altitude = m.Latitude, m.Longitude, m.Altitude
+	a.Make, a.Model, a.LensModel = m.Make, m.Model, m.LensModel
+	a.Orientation, a.Width, a.Height = m.Orientation, m.Width, m.Height
+	a.Description, a.Rating, a.Keywords, a.Faces = m.Description, m.Rating, m.Keywords, m.Faces
+	return nil
 }
@@ -1,12 +1,19 @@
 package files_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io/fs"
 	"path"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kr/pretty"
 	"github.com/psanford/memfs"
@@ -36,6 +43,16 @@ func (mfs *inMemFS) addFile(name string) *inMemFS {
 	return mfs
 }
 
+func (mfs *inMemFS) addFileContent(name string, content []byte) *inMemFS {
+	if mfs.err != nil {
+		return mfs
+	}
+	dir := path.Dir(name)
+	mfs.err = errors.Join(mfs.err, mfs.MkdirAll(dir, 0o777))
+	mfs.err = errors.Join(mfs.err, mfs.WriteFile(name, content, 0o777))
+	return mfs
+}
+
 func generateFS() *inMemFS {
 	return newInMemFS().
 		addFile("root_01.jpg").
@@ -96,3 +113,251 @@ func TestLocalAssets(t *testing.T) {
 		})
 	}
 }
+
+const contentID = "1B7E4A3C-2D5F-4E6A-8B9C-0D1E2F3A4B5C"
+
+// liveImage gives an image with an Apple's maker note having the content identifier
+func liveImage(id string) []byte {
+	b := bytes.NewBufferString("image data")
+	b.WriteString("Apple iOS\x00\x00\x01MM")
+	_ = binary.Write(b, binary.BigEndian, uint16(1))
+	_ = binary.Write(b, binary.BigEndian, []uint16{0x11, 2})
+	_ = binary.Write(b, binary.BigEndian, []uint32{uint32(len(id) + 1), 16 + 12 + 4})
+	b.Write([]byte{0, 0, 0, 0})
+	b.WriteString(id + "\x00")
+	return b.Bytes()
+}
+
+// liveVideo gives a video with the quicktime content identifier in its moov atom, after the media data
+func liveVideo(id string) []byte {
+	mdat := "\x00\x00\x00\x12mdatvideo data"
+	moov := "keys com.apple.quicktime.content.identifier ilst data " + id
+	return append([]byte(mdat), append(binary.BigEndian.AppendUint32(nil, uint32(8+len(moov))), "moov"+moov...)...)
+}
+
+func TestLivePhotos(t *testing.T) {
+	fsys := newInMemFS().
+		addFile("iphone/IMG_0001.HEIC").
+		addFile("iphone/IMG_0001.MOV").
+		addFile("iphone/IMG_0002.MOV").
+		addFileContent("iphone/holidays.heic", liveImage(contentID)).
+		addFileContent("iphone/beach.mov", liveVideo(contentID)).
+		addFile("pixel/PXL_20231006_063000139.MP.jpg").
+		addFile("pixel/PXL_20231006_063000139.MP").
+		addFile("pixel/PXL_20231006_063029647.MP")
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+	ctx := context.Background()
+	jnl := logger.NewJournal(logger.NoLog{})
+	b, err := files.NewLocalFiles(ctx, jnl, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSupportedMedia(immich.DefaultSupportedMedia)
+
+	expected := []string{
+		"iphone/IMG_0001.HEIC + iphone/IMG_0001.MOV (IMG_0001.MOV)",
+		"iphone/IMG_0002.MOV",
+		"iphone/holidays.heic + iphone/beach.mov (beach.mov)",
+		"pixel/PXL_20231006_063000139.MP.jpg + pixel/PXL_20231006_063000139.MP (PXL_20231006_063000139.MP.mp4)",
+	}
+	results := []string{}
+	for a := range b.Browse(ctx) {
+		r := a.FileName
+		if a.LivePhoto != nil {
+			r += " + " + a.LivePhoto.FileName + " (" + a.LivePhoto.Title + ")"
+		}
+		results = append(results, r)
+	}
+	sort.Strings(expected)
+	sort.Strings(results)
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("difference\n")
+		pretty.Ldiff(t, expected, results)
+	}
+
+	// The motion photos are journaled once, as a video when paired
+	for _, f := range jnl.Files() {
+		var want logger.Action
+		switch f.File {
+		case "pixel/PXL_20231006_063000139.MP":
+			want = logger.ScannedVideo
+		case "pixel/PXL_20231006_063029647.MP":
+			want = logger.Discarded
+		default:
+			continue
+		}
+		actions := []logger.Action{}
+		for _, e := range f.History {
+			if e.Action != logger.DiscoveredFile && e.Action != logger.LivePhoto && e.Action != logger.INFO {
+				actions = append(actions, e.Action)
+			}
+		}
+		if !reflect.DeepEqual(actions, []logger.Action{want}) {
+			t.Errorf("%s: %v, want %s", f.File, actions, want)
+		}
+	}
+}
+
+const sidecar = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    exif:DateTimeOriginal="2022-05-04T10:00:00+02:00"
+    exif:GPSLatitude="48,51.462N"
+    exif:GPSLongitude="2,17.7W"
+    xmp:Rating="4">
+   <dc:description><rdf:Alt><rdf:li xml:lang="x-default">Eiffel tower</rdf:li></rdf:Alt></dc:description>
+   <dc:subject><rdf:Bag><rdf:li>Paris</rdf:li><rdf:li>Holidays</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestSidecar(t *testing.T) {
+	fsys := newInMemFS().
+		addFile("photos/20230801-001.jpg").
+		addFileContent("photos/20230801-001.jpg.xmp", []byte(sidecar)).
+		addFile("photos/20230801-002.jpg")
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+	ctx := context.Background()
+	b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLog{}), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSupportedMedia(immich.DefaultSupportedMedia)
+
+	expected := []string{
+		"photos/20230801-001.jpg 2022-05-04T08:00:00Z 48.857700,-2.295000 4 \"Eiffel tower\" [Paris Holidays]",
+		"photos/20230801-002.jpg 2023-08-01T00:00:00Z 0.000000,0.000000 0 \"\" []",
+	}
+	results := []string{}
+	for a := range b.Browse(ctx) {
+		results = append(results, fmt.Sprintf("%s %s %f,%f %d %q %v", a.FileName, a.DateTaken.UTC().Format(time.RFC3339),
+			a.Latitude, a.Longitude, a.Rating, a.Description, a.Keywords))
+	}
+	sort.Strings(results)
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("difference\n")
+		pretty.Ldiff(t, expected, results)
+	}
+}
+
+// countingFS counts the files opened and not closed yet, and fails to open the given files
+type countingFS struct {
+	fs.FS
+	mut     sync.Mutex
+	opened  int
+	maxOpen int
+	fail    map[string]error
+}
+
+type countedFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	if err := c.fail[name]; err != nil {
+		return nil, err
+	}
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.opened++
+	c.maxOpen = max(c.maxOpen, c.opened)
+	return &countedFile{File: f, fsys: c}, nil
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(c.FS, name)
+}
+
+func (f *countedFile) Close() error {
+	f.fsys.mut.Lock()
+	f.fsys.opened--
+	f.fsys.mut.Unlock()
+	return f.File.Close()
+}
+
+func TestMetadataReadFailure(t *testing.T) {
+	mem := newInMemFS().
+		addFile("photos/IMG_0001.jpg").
+		addFile("photos/IMG_0002.jpg")
+	if mem.err != nil {
+		t.Fatal(mem.err)
+	}
+	fsys := &countingFS{FS: mem, fail: map[string]error{"photos/IMG_0002.jpg": errors.New("too many open files")}}
+	ctx := context.Background()
+	jnl := logger.NewJournal(logger.NoLog{})
+	b, err := files.NewLocalFiles(ctx, jnl, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSupportedMedia(immich.DefaultSupportedMedia)
+	n := 0
+	for range b.Browse(ctx) {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("%d assets, want 1", n)
+	}
+	if fsys.opened != 0 {
+		t.Errorf("%d files left open", fsys.opened)
+	}
+	found := false
+	for _, f := range jnl.Files() {
+		for _, e := range f.History {
+			if f.File == "photos/IMG_0002.jpg" && e.Action == logger.ERROR && strings.Contains(e.Comment, "too many open files") {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Errorf("the failure isn't journaled: %+v", jnl.Files())
+	}
+}
+
+func TestBrowseOpenFiles(t *testing.T) {
+	mem := newInMemFS().
+		addFileContent("iphone/holidays.heic", liveImage(contentID)).
+		addFileContent("iphone/beach.mov", liveVideo(contentID)).
+		addFile("pixel/PXL_20231006_063000139.MP.jpg").
+		addFile("pixel/PXL_20231006_063000139.MP")
+	for i := 0; i < 300; i++ {
+		mem.addFile(fmt.Sprintf("iphone/IMG_%04d.HEIC", i)).
+			addFile(fmt.Sprintf("iphone/IMG_%04d.MOV", i))
+	}
+	if mem.err != nil {
+		t.Fatal(mem.err)
+	}
+	fsys := &countingFS{FS: mem}
+	ctx := context.Background()
+	b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLog{}), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSupportedMedia(immich.DefaultSupportedMedia)
+	n, live := 0, 0
+	for a := range b.Browse(ctx) {
+		n++
+		if a.LivePhoto != nil {
+			live++
+		}
+	}
+	if n != 302 || live != 302 {
+		t.Errorf("%d assets, %d live photos, want 302 and 302", n, live)
+	}
+	if fsys.opened != 0 || fsys.maxOpen > 1 {
+		t.Errorf("%d files left open, %d opened at once, want 0 and 1", fsys.opened, fsys.maxOpen)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package files
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotify reports the changes of folders using the linux inotify API
+type inotify struct {
+	fd      int
+	f       *os.File
+	mut     sync.Mutex
+	watches map[int32]string // folders by watch descriptor
+	events  chan string
+	done    chan struct{}
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	n := &inotify{
+		fd: fd,
+		// A non blocking file uses the runtime poller, and Close unblocks the pending Read
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		watches: map[int32]string{},
+		events:  make(chan string, 64),
+		done:    make(chan struct{}),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) Add(dir string) error {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	const mask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, mask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	n.watches[int32(wd)] = dir
+	return nil
+}
+
+func (n *inotify) Events() <-chan string {
+	return n.events
+}
+
+func (n *inotify) Close() error {
+	close(n.done)
+	return n.f.Close()
+}
+
+func (n *inotify) read() {
+	defer close(n.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		l, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for p := 0; p+syscall.SizeofInotifyEvent <= l; {
+			e := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[p]))
+			name := buf[p+syscall.SizeofInotifyEvent : p+syscall.SizeofInotifyEvent+int(e.Len)]
+			p += syscall.SizeofInotifyEvent + int(e.Len)
+
+			n.mut.Lock()
+			dir, ok := n.watches[e.Wd]
+			if e.Mask&syscall.IN_IGNORED != 0 {
+				delete(n.watches, e.Wd)
+			}
+			n.mut.Unlock()
+			if !ok || e.Mask&(syscall.IN_CREATE|syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) == 0 {
+				continue
+			}
+			if e.Mask&syscall.IN_ISDIR != 0 {
+				// report the new folder itself, to scan it and watch it
+				dir = filepath.Join(dir, string(bytes.TrimRight(name, "\x00")))
+			}
+			select {
+			case n.events <- dir:
+			case <-n.done:
+				return
+			}
+		}
+	}
+}
+
+// network file systems don't send notifications for changes made by other hosts
+var networkFS = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xff534d42: true, // CIFS
+	0xfe534d42: true, // SMB2
+	0x65735546: true, // FUSE (sshfs...)
+}
+
+func isNetworkFS(dir string) bool {
+	var s syscall.Statfs_t
+	if err := syscall.Statfs(dir, &s); err != nil {
+		return false
+	}
+	return networkFS[uint32(s.Type)] // the type is an int32 on 32-bit systems, the magic numbers are above 2^31
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package files
+
+import "errors"
+
+func newNotifier() (notifier, error) {
+	return nil, errors.New("not implemented on this system")
+}
+
+func isNetworkFS(dir string) bool {
+	return false
+}
@@ -0,0 +1,260 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+)
+
+// WatchOptions control how folders are watched
+type WatchOptions struct {
+	Stability    time.Duration // A file is reported when its size and date haven't changed during this delay
+	PollInterval time.Duration // Delay between two scans of the folders when they are polled
+	Poll         bool          // Poll the folders instead of using the system's notifications
+}
+
+// notifier reports the folders where a file has been created or modified
+type notifier interface {
+	Add(dir string) error
+	Events() <-chan string
+	Close() error
+}
+
+type watchedRoot struct {
+	dir  string // folder on the OS
+	fsys fs.FS
+	poll bool // the folder is polled
+}
+
+type watchedKey struct {
+	root int
+	name string
+}
+
+type watchedFile struct {
+	size     int64
+	mod      time.Time
+	since    time.Time // last time a change has been seen
+	reported bool
+}
+
+type watcher struct {
+	la     *LocalAssetBrowser
+	opt    WatchOptions
+	roots  []watchedRoot
+	files  map[watchedKey]*watchedFile
+	notify notifier
+	now    func() time.Time
+}
+
+// Watch reports the files of the folders, then the files created or modified later, until the context is cancelled.
+// A file is reported once it is stable: its size and its date haven't changed during the stability delay.
+// Files becoming stable at the same time are reported in the same batch.
+//
+// The system's notifications are used when possible. Network mounts, and systems without notifications, are polled.
+func (la *LocalAssetBrowser) Watch(ctx context.Context, folders []string, opt WatchOptions) chan []*browser.LocalAssetFile {
+	w := &watcher{
+		la:    la,
+		opt:   opt,
+		files: map[watchedKey]*watchedFile{},
+		now:   time.Now,
+	}
+	if w.opt.Stability <= 0 {
+		w.opt.Stability = 10 * time.Second
+	}
+	if w.opt.PollInterval <= 0 {
+		w.opt.PollInterval = 30 * time.Second
+	}
+
+	if !opt.Poll {
+		n, err := newNotifier()
+		if err != nil {
+			la.log.Log.Warning("File system notifications not available, the folders will be polled: %s", err)
+		} else {
+			w.notify = n
+		}
+	}
+	for _, dir := range folders {
+		r := watchedRoot{dir: dir, fsys: os.DirFS(dir), poll: w.notify == nil}
+		if !r.poll && isNetworkFS(dir) {
+			la.log.Log.Warning("%s is a network mount, it will be polled", dir)
+			r.poll = true
+		}
+		w.roots = append(w.roots, r)
+	}
+
+	batches := make(chan []*browser.LocalAssetFile)
+	go func() {
+		defer close(batches)
+		if w.notify != nil {
+			defer w.notify.Close()
+		}
+		w.run(ctx, batches)
+	}()
+	return batches
+}
+
+func (w *watcher) run(ctx context.Context, batches chan []*browser.LocalAssetFile) {
+	for i := range w.roots {
+		w.scan(i, ".", true)
+	}
+
+	var events <-chan string
+	if w.notify != nil {
+		events = w.notify.Events()
+	}
+	poll := time.NewTicker(w.opt.PollInterval)
+	defer poll.Stop()
+	check := time.NewTicker(max(w.opt.Stability/4, 100*time.Millisecond))
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dir, ok := <-events:
+			if !ok {
+				// the notifications are broken, fall back to polling
+				events = nil
+				for i := range w.roots {
+					w.roots[i].poll = true
+				}
+				continue
+			}
+			for i, r := range w.roots {
+				rel, err := filepath.Rel(r.dir, dir)
+				if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					continue
+				}
+				w.scan(i, filepath.ToSlash(rel), false)
+			}
+		case <-poll.C:
+			for i, r := range w.roots {
+				if r.poll {
+					w.scan(i, ".", true)
+				}
+			}
+		case <-check.C:
+			batch := w.stableFiles()
+			if len(batch) == 0 {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case batches <- batch:
+			}
+		}
+	}
+}
+
+// scan registers the files of the folder, and of its sub folders when recursive or newly discovered
+func (w *watcher) scan(root int, dir string, recursive bool) {
+	r := w.roots[root]
+	if !r.poll {
+		err := w.notify.Add(filepath.Join(r.dir, filepath.FromSlash(dir)))
+		if err != nil {
+			w.la.log.Log.Warning("can't watch the folder %s: %s", dir, err)
+		}
+	}
+	entries, err := fs.ReadDir(r.fsys, dir)
+	if err != nil {
+		return
+	}
+	now := w.now()
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if e.IsDir() {
+			if recursive || !w.known(root, name) {
+				w.files[watchedKey{root: root, name: name}] = &watchedFile{reported: true}
+				w.scan(root, name, true)
+			}
+			continue
+		}
+		t := w.la.sm.TypeFromExt(strings.ToLower(path.Ext(name)))
+		if t != immich.TypeImage && t != immich.TypeVideo {
+			continue
+		}
+		s, err := e.Info()
+		if err != nil {
+			continue
+		}
+		k := watchedKey{root: root, name: name}
+		f, ok := w.files[k]
+		if !ok {
+			w.files[k] = &watchedFile{size: s.Size(), mod: s.ModTime(), since: now}
+			continue
+		}
+		if f.size != s.Size() || !f.mod.Equal(s.ModTime()) {
+			f.size, f.mod, f.since, f.reported = s.Size(), s.ModTime(), now, false
+		}
+	}
+}
+
+func (w *watcher) known(root int, name string) bool {
+	_, ok := w.files[watchedKey{root: root, name: name}]
+	return ok
+}
+
+// stableFiles gives the assets of the files unchanged during the stability delay
+func (w *watcher) stableFiles() []*browser.LocalAssetFile {
+	now := w.now()
+	ready := []watchedKey{}
+	for k, f := range w.files {
+		if f.reported {
+			continue
+		}
+		s, err := fs.Stat(w.roots[k.root].fsys, k.name)
+		if err != nil {
+			delete(w.files, k)
+			continue
+		}
+		if f.size != s.Size() || !f.mod.Equal(s.ModTime()) {
+			f.size, f.mod, f.since = s.Size(), s.ModTime(), now
+			continue
+		}
+		if now.Sub(f.since) >= w.opt.Stability {
+			ready = append(ready, k)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].root != ready[j].root {
+			return ready[i].root < ready[j].root
+		}
+		return ready[i].name < ready[j].name
+	})
+
+	batch := []*browser.LocalAssetFile{}
+	var entries []fs.DirEntry
+	var dirAssets []*browser.LocalAssetFile
+	lastDir := watchedKey{root: -1}
+	for _, k := range ready {
+		w.files[k].reported = true
+		r := w.roots[k.root]
+		dir := watchedKey{root: k.root, name: path.Dir(k.name)}
+		if dir != lastDir {
+			// live photos are paired within a folder
+			batch = append(batch, w.la.pairLivePhotos(dirAssets)...)
+			dirAssets = nil
+			entries, _ = fs.ReadDir(r.fsys, dir.name)
+			lastDir = dir
+		}
+		for _, e := range entries {
+			if e.Name() == path.Base(k.name) {
+				if a := w.la.newAsset(r.fsys, dir.name, entries, e); a != nil {
+					dirAssets = append(dirAssets, a)
+				}
+				break
+			}
+		}
+	}
+	return append(batch, w.la.pairLivePhotos(dirAssets)...)
+}
@@ -0,0 +1,91 @@
+package files_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestWatch(t *testing.T) {
+	tc := []struct {
+		name string
+		poll bool
+	}{
+		{name: "notifications"},
+		{name: "polling", poll: true},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile := func(name string) {
+				t.Helper()
+				name = filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			writeFile("root_01.jpg")
+			writeFile("photos/photo_01.jpg")
+			writeFile("photos/notes.txt")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLog{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetSupportedMedia(immich.DefaultSupportedMedia)
+			batches := b.Watch(ctx, []string{dir}, files.WatchOptions{
+				Stability:    200 * time.Millisecond,
+				PollInterval: 100 * time.Millisecond,
+				Poll:         c.poll,
+			})
+
+			// next collects the batches until n files are received
+			next := func(n int) []string {
+				t.Helper()
+				names := []string{}
+				for len(names) < n {
+					select {
+					case batch := <-batches:
+						for _, a := range batch {
+							name := a.FileName
+							if a.LivePhoto != nil {
+								name += " + " + a.LivePhoto.FileName
+							}
+							names = append(names, name)
+						}
+					case <-ctx.Done():
+						t.Fatalf("expecting %d files, got %v", n, names)
+					}
+				}
+				sort.Strings(names)
+				return names
+			}
+
+			expected := []string{"photos/photo_01.jpg", "root_01.jpg"}
+			if got := next(len(expected)); !reflect.DeepEqual(got, expected) {
+				t.Errorf("first batch: expected %v, got %v", expected, got)
+			}
+
+			writeFile("card/DCIM/IMG_0001.jpg")
+			writeFile("card/DCIM/IMG_0001.mp4")
+			expected = []string{"card/DCIM/IMG_0001.jpg + card/DCIM/IMG_0001.mp4"}
+			if got := next(len(expected)); !reflect.DeepEqual(got, expected) {
+				t.Errorf("second batch: expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
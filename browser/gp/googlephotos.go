@@ -13,6 +13,7 @@ import (
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/tzone"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/logger"
 )
@@ -25,6 +26,7 @@ type Takeout struct {
 	albums     map[string]string           // tack album names by folder
 	jnl        *logger.Journal
 	sm         immich.SupportedMedia
+	tzFromGPS  bool // determine the time zone from the GPS coordinates
 }
 
 // walkerCatalog collects all directory catalogs
@@ -32,7 +34,9 @@ type walkerCatalog map[string]directoryCatalog // by directory in the walker
 
 // directoryCatalog captures all files in a given directory
 type directoryCatalog struct {
-	files map[string]fileInfo // map of fileInfo by base name
+	files      map[string]fileInfo // map of fileInfo by base name
+	liveImages map[string]string   // base name of images that can be the part of a live photo, by live photo key
+	liveVideos map[string]string   // base name of videos that can be the part of a live photo, by live photo key
 }
 
 // fileInfo keep information collected during pass one
@@ -71,6 +75,13 @@ func NewTakeout(ctx context.Context, jnl *logger.Journal, sm immich.SupportedMed
 	return &to, err
 }
 
+// SetTimeZoneFromGPS sets the time zone of the assets from their GPS coordinates.
+// The metadata files give the instant of the capture, but not its time zone.
+func (to *Takeout) SetTimeZoneFromGPS(b bool) *Takeout {
+	to.tzFromGPS = b
+	return to
+}
+
 // passOne scans all files in all walker to build the file catalog of the archive
 // metadata files content is read and kept
 
@@ -101,19 +112,21 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 				return nil
 			}
 
-			to.jnl.AddEntry(name, logger.DiscoveredFile, "")
+			to.jnl.AddFileEntry(w, name, logger.DiscoveredFile, "")
 			dir, base := path.Split(name)
 			dir = strings.TrimSuffix(dir, "/")
 			ext := strings.ToLower(path.Ext(base))
 
 			if slices.Contains(uselessFiles, base) {
-				to.jnl.AddEntry(name, logger.Discarded, "Useless file")
+				to.jnl.AddFileEntry(w, name, logger.Discarded, "Useless file")
 				return nil
 			}
 
 			dirCatalog := to.catalogs[w][dir]
 			if dirCatalog.files == nil {
 				dirCatalog.files = map[string]fileInfo{}
+				dirCatalog.liveImages = map[string]string{}
+				dirCatalog.liveVideos = map[string]string{}
 			}
 			finfo, err := d.Info()
 			if err != nil {
@@ -126,39 +139,49 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 					switch {
 					case md.isAsset():
 						to.addJSON(dir, base, md)
-						to.jnl.AddEntry(name, logger.Metadata, "Asset Title: "+md.Title)
+						to.jnl.AddFileEntry(w, name, logger.Metadata, "Asset Title: "+md.Title)
 					case md.isAlbum():
 						to.albums[dir] = md.Title
-						to.jnl.AddEntry(name, logger.Metadata, "Album title: "+md.Title)
+						to.jnl.AddFileEntry(w, name, logger.Metadata, "Album title: "+md.Title)
 					default:
-						to.jnl.AddEntry(name, logger.Discarded, "Unknown json file")
+						to.jnl.AddFileEntry(w, name, logger.Discarded, "Unknown json file")
 						return nil
 					}
 				} else {
-					to.jnl.AddEntry(name, logger.Discarded, "Unknown json file")
+					to.jnl.AddFileEntry(w, name, logger.Discarded, "Unknown json file")
 					return nil
 				}
 			default:
 				t := to.sm.TypeFromExt(ext)
 				switch t {
 				case immich.TypeUnknown:
-					to.jnl.AddEntry(name, logger.Unsupported, "")
+					to.jnl.AddFileEntry(w, name, logger.Unsupported, "")
 					return nil
 				case immich.TypeIgnored:
-					to.jnl.AddEntry(name, logger.Discarded, "File ignored")
+					to.jnl.AddFileEntry(w, name, logger.Discarded, "File ignored")
+					if ext != ".mp" {
+						return nil
+					}
+					// Google's motion photos are uploaded with their image
+					dirCatalog.files[base] = fileInfo{
+						length: int(finfo.Size()),
+					}
+					dirCatalog.addLivePhotoPart(base)
+					to.catalogs[w][dir] = dirCatalog
 					return nil
 				case immich.TypeVideo:
 					if strings.Contains(name, "Failed Videos") {
-						to.jnl.AddEntry(name, logger.FailedVideo, "")
+						to.jnl.AddFileEntry(w, name, logger.FailedVideo, "")
 						return nil
 					}
-					to.jnl.AddEntry(name, logger.ScannedVideo, "")
+					to.jnl.AddFileEntry(w, name, logger.ScannedVideo, "")
 				case immich.TypeImage:
-					to.jnl.AddEntry(name, logger.ScannedImage, "")
+					to.jnl.AddFileEntry(w, name, logger.ScannedImage, "")
 				}
 				dirCatalog.files[base] = fileInfo{
 					length: int(finfo.Size()),
 				}
+				dirCatalog.addLivePhotoPart(base)
 			}
 			to.catalogs[w][dir] = dirCatalog
 			return nil
@@ -167,6 +190,21 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 	return err
 }
 
+// addLivePhotoPart registers the file when it can be the image or the video of a live photo
+func (dc directoryCatalog) addLivePhotoPart(base string) {
+	k := browser.LivePhotoKey(base)
+	switch {
+	case browser.IsLivePhotoImage(base):
+		if _, exists := dc.liveImages[k]; !exists {
+			dc.liveImages[k] = base
+		}
+	case browser.IsLivePhotoVideo(base):
+		if _, exists := dc.liveVideos[k]; !exists {
+			dc.liveVideos[k] = base
+		}
+	}
+}
+
 // addJSON stores metadata and all paths where the combo base+year has been found
 func (to *Takeout) addJSON(dir, base string, md *GoogleMetaData) {
 	k := jsonKey{
@@ -249,7 +287,7 @@ func (to *Takeout) solvePuzzle() {
 					for f := range l.files {
 						if l.files[f].md == nil {
 							if matcher(k.name, f, to.sm) {
-								to.jnl.AddEntry(path.Join(d, f), logger.AssociatedMetadata, fmt.Sprintf("%s (%d)", k.name, k.year))
+								to.jnl.AddFileEntry(w, path.Join(d, f), logger.AssociatedMetadata, fmt.Sprintf("%s (%d)", k.name, k.year))
 								// if not already matched
 								i := l.files[f]
 								i.md = md
@@ -428,13 +466,22 @@ func (to *Takeout) passTwoWalk(ctx context.Context, w fs.FS, assetChan chan *bro
 		if !to.sm.IsMedia(ext) {
 			return nil
 		}
-		f, exist := to.catalogs[w][dir].files[base]
+		dc := to.catalogs[w][dir]
+		f, exist := dc.files[base]
 		if !exist {
 			return nil
 		}
 
+		if browser.IsLivePhotoVideo(base) {
+			// The video part of a live photo is uploaded with its image
+			if image, ok := dc.liveImages[browser.LivePhotoKey(base)]; ok && dc.files[image].md != nil {
+				to.jnl.AddFileEntry(w, name, logger.LivePhoto, "image: "+path.Join(dir, image))
+				return nil
+			}
+		}
+
 		if f.md == nil {
-			to.jnl.AddEntry(name, logger.ERROR, "JSON File not found for this file")
+			to.jnl.AddFileEntry(w, name, logger.ERROR, "JSON File not found for this file")
 			return nil
 		}
 		finfo, err := d.Info()
@@ -449,10 +496,14 @@ func (to *Takeout) passTwoWalk(ctx context.Context, w fs.FS, assetChan chan *bro
 			year:   f.md.PhotoTakenTime.Time().Year(),
 		}
 		if _, exists := to.uploaded[key]; exists {
-			to.jnl.AddEntry(name, logger.LocalDuplicate, "")
+			to.jnl.AddFileEntry(w, name, logger.LocalDuplicate, "")
 			return nil
 		}
 		a := to.googleMDToAsset(f.md, key, w, name)
+		a.FileDate = finfo.ModTime()
+		if browser.IsLivePhotoImage(base) {
+			a.LivePhoto = to.livePhotoVideo(w, dir, a)
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -463,6 +514,28 @@ func (to *Takeout) passTwoWalk(ctx context.Context, w fs.FS, assetChan chan *bro
 	})
 }
 
+// livePhotoVideo gives the video part of the live photo, or nil
+func (to *Takeout) livePhotoVideo(w fs.FS, dir string, image *browser.LocalAssetFile) *browser.LocalAssetFile {
+	dc := to.catalogs[w][dir]
+	base, ok := dc.liveVideos[browser.LivePhotoKey(image.FileName)]
+	if !ok {
+		return nil
+	}
+	name := path.Join(dir, base)
+	v := browser.LocalAssetFile{
+		FileName:  name,
+		FileSize:  dc.files[base].length,
+		Title:     browser.LivePhotoVideoTitle(image.Title, base),
+		DateTaken: image.DateTaken,
+		FSys:      w,
+	}
+	if s, err := fs.Stat(w, name); err == nil {
+		v.FileDate = s.ModTime()
+	}
+	to.jnl.AddFileEntry(w, image.FileName, logger.LivePhoto, "video: "+name)
+	return &v
+}
+
 // googleMDToAsset makes a localAssetFile based on the google metadata
 func (to *Takeout) googleMDToAsset(md *GoogleMetaData, key fileKey, fsys fs.FS, name string) *browser.LocalAssetFile {
 	// Change file's title with the asset's title and the actual file's extension
@@ -493,6 +566,10 @@ func (to *Takeout) googleMDToAsset(md *GoogleMetaData, key fileKey, fsys fs.FS,
 		FSys:        fsys,
 	}
 
+	if to.tzFromGPS {
+		a.TimeZone = tzone.FromLocation(a.Latitude, a.Longitude)
+	}
+
 	for _, p := range md.foundInPaths {
 		if album, exists := to.albums[p]; exists {
 			a.Albums = append(a.Albums, browser.LocalAlbum{Path: p, Name: album})
@@ -95,6 +95,7 @@ type fileResult struct {
 	name  string
 	size  int
 	title string
+	live  string // name of the live photo's video
 }
 
 func sortFileResult(s []fileResult) []fileResult {
@@ -184,6 +185,18 @@ func titlesWithForbiddenChars() *inMemFS {
 		addImage("Takeout/Google Photos/Photos from 2012/27_06_12 - 1.jpg", 24)
 }
 
+func motionPhotos() *inMemFS {
+	return newInMemFS().
+		addJSONImage("Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.MP.jpg.json", "PXL_20231006_063000139.MP.jpg").
+		addImage("Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.MP.jpg", 10).
+		addImage("Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.MP", 20).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_1234.HEIC.json", "IMG_1234.HEIC").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_1234.HEIC", 30).
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_1234.MOV", 40).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/VID_0001.mp4.json", "VID_0001.mp4").
+		addImage("Takeout/Google Photos/Photos from 2023/VID_0001.mp4", 50)
+}
+
 func namesIssue39() *inMemFS {
 	return newInMemFS().
 		addJSONAlbum("Takeout/Google Photos/Album/anyname.json", "Album").
@@ -70,8 +70,15 @@ func TestBrowse(t *testing.T) {
 		{
 			"titlesWithForbiddenChars", titlesWithForbiddenChars,
 			sortFileResult([]fileResult{
-				{name: "27_06_12 - 1.mov", size: 52, title: "27/06/12 - 1.mov"},
-				{name: "27_06_12 - 1.jpg", size: 24, title: "27/06/12 - 1.jpg"},
+				{name: "27_06_12 - 1.jpg", size: 24, title: "27/06/12 - 1.jpg", live: "27_06_12 - 1.mov"},
+			}),
+		},
+		{
+			"motionPhotos", motionPhotos,
+			sortFileResult([]fileResult{
+				{name: "PXL_20231006_063000139.MP.jpg", size: 10, title: "PXL_20231006_063000139.MP.jpg", live: "PXL_20231006_063000139.MP"},
+				{name: "IMG_1234.HEIC", size: 30, title: "IMG_1234.HEIC", live: "IMG_1234.MOV"},
+				{name: "VID_0001.mp4", size: 50, title: "VID_0001.mp4"},
 			}),
 		},
 		{
@@ -85,7 +92,7 @@ func TestBrowse(t *testing.T) {
 		{
 			"issue68MPFiles", issue68MPFiles,
 			sortFileResult([]fileResult{
-				{name: "PXL_20221228_185930354.MP.jpg", size: 2, title: "PXL_20221228_185930354.MP.jpg"},
+				{name: "PXL_20221228_185930354.MP.jpg", size: 2, title: "PXL_20221228_185930354.MP.jpg", live: "PXL_20221228_185930354.MP"},
 			}),
 		},
 		{
@@ -120,7 +127,11 @@ func TestBrowse(t *testing.T) {
 
 			results := []fileResult{}
 			for a := range b.Browse(ctx) {
-				results = append(results, fileResult{name: path.Base(a.FileName), size: a.FileSize, title: a.Title})
+				r := fileResult{name: path.Base(a.FileName), size: a.FileSize, title: a.Title}
+				if a.LivePhoto != nil {
+					r.live = path.Base(a.LivePhoto.FileName)
+				}
+				results = append(results, r)
 			}
 			results = sortFileResult(results)
 
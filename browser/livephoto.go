@@ -0,0 +1,118 @@
+package browser
+
+import (
+	"path"
+	"strings"
+)
+
+/*
+	Live photos are made of an image and a short video taken by the phone.
+	Both files share the same base name:
+		IMG_1234.HEIC  IMG_1234.MOV		(Apple)
+		PXL_20231006_063000139.MP.jpg  PXL_20231006_063000139.MP	(Google Photos motion photos)
+
+	When the names have been changed, Apple's files still share the same content identifier.
+*/
+
+// LivePhotoKey gives the key shared by the image and the video of a live photo:
+// the lower case name without extension and without the .MP suffix of Google's motion photos
+func LivePhotoKey(name string) string {
+	name = strings.ToLower(path.Base(name))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return strings.TrimSuffix(name, ".mp")
+}
+
+// IsLivePhotoImage tells if the file can be the image part of a live photo
+func IsLivePhotoImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".heic", ".heif", ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// IsLivePhotoVideo tells if the file can be the video part of a live photo
+func IsLivePhotoVideo(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mov", ".mp4", ".mp":
+		return true
+	}
+	return false
+}
+
+// LivePhotoVideoTitle gives the title of the video part based on the image's title.
+// Google's .MP files are MP4 videos
+func LivePhotoVideoTitle(imageTitle string, videoName string) string {
+	ext := path.Ext(videoName)
+	if strings.EqualFold(ext, ".mp") {
+		ext = ".mp4"
+	}
+	return strings.TrimSuffix(imageTitle, path.Ext(imageTitle)) + ext
+}
+
+// PairLivePhotos attaches the videos of live photos to their image.
+// The images and videos are paired by name first, then by content identifier when the function contentID is given.
+// The attached videos are removed from the returned list.
+func PairLivePhotos(assets []*LocalAssetFile, contentID func(a *LocalAssetFile) string) []*LocalAssetFile {
+	images := map[string]*LocalAssetFile{}
+	var videos []*LocalAssetFile
+	for _, a := range assets {
+		if a.Err == nil && IsLivePhotoImage(a.FileName) {
+			k := LivePhotoKey(a.FileName)
+			if _, exists := images[k]; !exists {
+				images[k] = a
+			}
+		}
+	}
+	if len(images) == 0 {
+		return assets
+	}
+
+	paired := map[*LocalAssetFile]bool{}
+	for _, a := range assets {
+		if a.Err != nil || !IsLivePhotoVideo(a.FileName) {
+			continue
+		}
+		if i, ok := images[LivePhotoKey(a.FileName)]; ok && i.LivePhoto == nil {
+			i.LivePhoto = a
+			paired[a] = true
+			continue
+		}
+		videos = append(videos, a)
+	}
+
+	if contentID != nil && len(videos) > 0 {
+		byID := map[string]*LocalAssetFile{}
+		for _, i := range images {
+			if i.LivePhoto != nil {
+				continue
+			}
+			if id := contentID(i); id != "" {
+				byID[id] = i
+			}
+		}
+		if len(byID) > 0 {
+			for _, v := range videos {
+				id := contentID(v)
+				if id == "" {
+					continue
+				}
+				if i, ok := byID[id]; ok && i.LivePhoto == nil {
+					i.LivePhoto = v
+					paired[v] = true
+				}
+			}
+		}
+	}
+
+	if len(paired) == 0 {
+		return assets
+	}
+	r := make([]*LocalAssetFile, 0, len(assets)-len(paired))
+	for _, a := range assets {
+		if !paired[a] {
+			r = append(r, a)
+		}
+	}
+	return r
+}
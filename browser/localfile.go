@@ -1,6 +1,8 @@
 package browser
 
 import (
+	"crypto/sha1"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -43,10 +45,20 @@ type LocalAssetFile struct {
 	SideCar     *metadata.SideCar
 
 	// Common metadata
-	DateTaken time.Time // the date of capture
-	Latitude  float64   // GPS Latitude
-	Longitude float64   // GPS Longitude
-	Altitude  float64   // GPS Altitude
+	DateTaken   time.Time      // the date of capture
+	TimeZone    *time.Location // the time zone of the capture, when known
+	Latitude    float64        // GPS Latitude
+	Longitude   float64        // GPS Longitude
+	Altitude    float64        // GPS Altitude
+	Make        string         // Camera's make
+	Model       string         // Camera's model
+	LensModel   string         // Lens
+	Orientation int            // EXIF orientation
+	Width       int            // in pixels
+	Height      int            // in pixels
+	Rating      int            // -1 for rejected, 0 to 5 stars
+	Keywords    []string       // XMP keywords
+	Faces       []metadata.FaceRegion
 
 	// Google Photos flags
 	Trashed     bool // The asset is trashed
@@ -55,10 +67,13 @@ type LocalAssetFile struct {
 	Favorite    bool
 
 	// Live Photos
-	LivePhotoData string // Filename of MP4 file associated
+	LivePhoto   *LocalAssetFile // The video part of the live photo, if any
+	LivePhotoID string          // The server's ID of the video part, once uploaded
 
-	FSys     fs.FS // Asset's file system
-	FileSize int   // File size in bytes
+	FSys     fs.FS     // Asset's file system
+	FileSize int       // File size in bytes
+	FileDate time.Time // File modification date
+	Checksum string    // SHA-1 of the file, base64 encoded like the server does. Empty until ComputeChecksum is called
 
 	// buffer management
 	sourceFile fs.File   // the opened source file
@@ -69,6 +84,11 @@ type LocalAssetFile struct {
 
 func (l LocalAssetFile) DebugObject() any {
 	l.FSys = nil
+	if l.LivePhoto != nil {
+		v := *l.LivePhoto
+		v.FSys = nil
+		l.LivePhoto = &v
+	}
 	return l
 }
 
@@ -112,7 +132,7 @@ func (l *LocalAssetFile) PartialSourceReader() (reader io.Reader, err error) {
 			return nil, err
 		}
 		tempDir = filepath.Join(tempDir, "github.com/simulot/immich-go")
-		err = os.Mkdir(tempDir, 0o700)
+		err = os.MkdirAll(tempDir, 0o700)
 		if err != nil {
 			return nil, err
 		}
@@ -131,6 +151,25 @@ func (l *LocalAssetFile) PartialSourceReader() (reader io.Reader, err error) {
 	return io.MultiReader(l.tempFile, l.teeReader), nil
 }
 
+// ComputeChecksum reads the whole file to compute its SHA-1.
+// The file's content is kept in the temporary file, so the upload doesn't read the source again.
+func (l *LocalAssetFile) ComputeChecksum() (string, error) {
+	if l.Checksum != "" {
+		return l.Checksum, nil
+	}
+	r, err := l.PartialSourceReader()
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	l.Checksum = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return l.Checksum, nil
+}
+
 // Open return fs.File that reads previously read bytes followed by the actual file content.
 func (l *LocalAssetFile) Open() (fs.File, error) {
 	var err error
@@ -170,6 +209,7 @@ func (l *LocalAssetFile) Close() error {
 		err = errors.Join(err, os.Remove(f))
 		l.tempFile = nil
 	}
+	l.teeReader = nil
 	return err
 }
 
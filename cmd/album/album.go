@@ -43,7 +43,7 @@ func deleteAlbum(ctx context.Context, common *cmd.SharedFlags, args []string) er
 		app.AssumeYes, err = strconv.ParseBool(s)
 		return err
 	})
-	err := cmd.Parse(args)
+	err := app.SharedFlags.Parse(cmd, args)
 	if err != nil {
 		return err
 	}
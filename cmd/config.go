@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables giving flag values: IMMICH_GO_KEY for -key
+const EnvPrefix = "IMMICH_GO_"
+
+// Config is the content of the configuration file
+//
+//	{
+//	  "default-profile": "home",
+//	  "profiles": {
+//	    "home": {
+//	      "server": "http://nas:2283",
+//	      "key": "...",
+//	      "upload": { "create-album-folder": true }
+//	    }
+//	  }
+//	}
+type Config struct {
+	DefaultProfile string             `json:"default-profile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles"`
+}
+
+// Profile gives flag values by flag name.
+// An entry whose value is an object gives the values for the command of the same name only.
+type Profile map[string]any
+
+// DefaultConfigFile gives the configuration file in the user's configuration folder ($XDG_CONFIG_HOME/immich-go/config.json)
+func DefaultConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "immich-go", "config.json"), nil
+}
+
+// LoadConfig reads the configuration file. A missing file gives an empty configuration when mustExist is false.
+func LoadConfig(name string, mustExist bool) (*Config, error) {
+	c := &Config{}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !mustExist {
+			return c, nil
+		}
+		return nil, fmt.Errorf("can't read the configuration file: %w", err)
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the configuration file %s: %w", name, err)
+	}
+	return c, nil
+}
+
+// Profile gives the named profile, or the default profile when the name is empty
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+		if name == "" {
+			return Profile{}, nil
+		}
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// Value gives the value of the flag for the command, as a string accepted by flag.Set.
+// The command's entry wins over the profile's entry.
+func (p Profile) Value(command, name string) (string, bool, error) {
+	if c, ok := p[command].(map[string]any); ok {
+		if v, ok := c[name]; ok {
+			s, err := flagValue(v)
+			return s, true, err
+		}
+	}
+	v, ok := p[name]
+	if !ok {
+		return "", false, nil
+	}
+	if _, isCommand := v.(map[string]any); isCommand {
+		return "", false, nil
+	}
+	s, err := flagValue(v)
+	return s, true, err
+}
+
+func flagValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		l := make([]string, 0, len(v))
+		for _, i := range v {
+			s, err := flagValue(i)
+			if err != nil {
+				return "", err
+			}
+			l = append(l, s)
+		}
+		return strings.Join(l, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// EnvName gives the name of the environment variable of a flag
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(flagName))
+}
+
+// Parse parses the command line, then completes the flags not given on the command line with:
+//   - the environment variables IMMICH_GO_<FLAG NAME>
+//   - the values of the command's section of the profile
+//   - the values of the profile
+//
+// The flags keep their default values otherwise.
+// The flags given before the subcommand stay explicit when the subcommand's flags are parsed.
+func (app *SharedFlags) Parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if app.explicit == nil {
+		app.explicit = map[string]bool{}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		app.explicit[f.Name] = true
+	})
+
+	p, err := app.loadProfile()
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	fs.VisitAll(func(f *flag.Flag) {
+		if app.explicit[f.Name] || f.Name == "config" || f.Name == "profile" {
+			return
+		}
+		source := "the environment variable " + EnvName(f.Name)
+		v := os.Getenv(EnvName(f.Name))
+		ok := v != ""
+		if !ok {
+			source = "the profile"
+			v, ok, err = p.Value(fs.Name(), f.Name)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("flag %s in %s: %w", f.Name, source, err))
+				return
+			}
+		}
+		if !ok {
+			return
+		}
+		err := fs.Set(f.Name, v)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("flag %s in %s: %w", f.Name, source, err))
+		}
+	})
+	return errs
+}
+
+// loadProfile gives the profile selected by -profile, $IMMICH_GO_PROFILE or the configuration's default profile
+func (app *SharedFlags) loadProfile() (Profile, error) {
+	c, err := app.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	name := app.Profile
+	if name == "" {
+		name = os.Getenv(EnvName("profile"))
+	}
+	return c.Profile(name)
+}
+
+// loadConfig reads the file given by -config, $IMMICH_GO_CONFIG or the default configuration file
+func (app *SharedFlags) loadConfig() (*Config, error) {
+	name := app.ConfigFile
+	if name == "" {
+		name = os.Getenv(EnvName("config"))
+	}
+	if name != "" {
+		return LoadConfig(name, true)
+	}
+	name, err := DefaultConfigFile()
+	if err != nil {
+		return &Config{}, nil
+	}
+	return LoadConfig(name, false)
+}
+
+// SetDestinationProfile sets the destination flags registered by SetDestinationFlags with the connection values of a profile.
+// The flags given on the command line are kept.
+func (app *SharedFlags) SetDestinationProfile(fs *flag.FlagSet, profile string) error {
+	c, err := app.loadConfig()
+	if err != nil {
+		return err
+	}
+	p, err := c.Profile(profile)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"server", "api", "key", "device-uuid", "skip-verify-ssl"} {
+		if app.explicit["dest-"+name] {
+			continue
+		}
+		v, ok, err := p.Value(fs.Name(), name)
+		if err != nil {
+			return fmt.Errorf("flag %s in the profile %q: %w", name, profile, err)
+		}
+		if ok {
+			err = fs.Set("dest-"+name, v)
+			if err != nil {
+				return fmt.Errorf("flag %s in the profile %q: %w", name, profile, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/myflag"
+)
+
+const testConfig = `{
+	"default-profile": "home",
+	"profiles": {
+		"home": {
+			"server": "http://home:2283",
+			"key": "home-key",
+			"skip-verify-ssl": true,
+			"api-retries": 5,
+			"upload": {
+				"server": "http://upload:2283",
+				"create-album-folder": true,
+				"select-types": [".jpg", ".heic"]
+			}
+		},
+		"family": {
+			"server": "http://family:2283",
+			"key": "family-key"
+		}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Server, Key, Types string
+		SkipSSL, Folder    bool
+		Retries            int
+		RetriesDelay       time.Duration
+	}
+
+	tc := []struct {
+		name     string
+		command  string
+		global   []string // the arguments before the command
+		args     []string
+		env      map[string]string
+		expected result
+		wantErr  bool
+	}{
+		{
+			name:     "default profile",
+			command:  "download",
+			args:     []string{"-config", config},
+			expected: result{Server: "http://home:2283", Key: "home-key", SkipSSL: true, Retries: 5, RetriesDelay: time.Second},
+		},
+		{
+			name:     "command section",
+			command:  "upload",
+			args:     []string{"-config", config},
+			expected: result{Server: "http://upload:2283", Key: "home-key", SkipSSL: true, Folder: true, Types: ".jpg,.heic", Retries: 5, RetriesDelay: time.Second},
+		},
+		{
+			name:     "named profile",
+			command:  "upload",
+			args:     []string{"-config", config, "-profile", "family"},
+			expected: result{Server: "http://family:2283", Key: "family-key", Retries: 3, RetriesDelay: time.Second},
+		},
+		{
+			name:     "environment",
+			command:  "upload",
+			args:     []string{"-profile", "family"},
+			env:      map[string]string{"IMMICH_GO_CONFIG": config, "IMMICH_GO_KEY": "env-key", "IMMICH_GO_API_RETRIES_DELAY": "2s"},
+			expected: result{Server: "http://family:2283", Key: "env-key", Retries: 3, RetriesDelay: 2 * time.Second},
+		},
+		{
+			name:     "command line",
+			command:  "upload",
+			args:     []string{"-config", config, "-key", "cli-key", "-create-album-folder=false"},
+			env:      map[string]string{"IMMICH_GO_KEY": "env-key"},
+			expected: result{Server: "http://upload:2283", Key: "cli-key", SkipSSL: true, Types: ".jpg,.heic", Retries: 5, RetriesDelay: time.Second},
+		},
+		{
+			name:     "global flags",
+			command:  "upload",
+			global:   []string{"-config", config, "-profile", "family", "-skip-verify-ssl", "-api-retries", "7"},
+			args:     []string{"-create-album-folder"},
+			env:      map[string]string{"IMMICH_GO_API_RETRIES": "4", "IMMICH_GO_KEY": "env-key"},
+			expected: result{Server: "http://family:2283", Key: "env-key", SkipSSL: true, Folder: true, Retries: 7, RetriesDelay: time.Second},
+		},
+		{
+			name:     "global flags and command section",
+			command:  "upload",
+			global:   []string{"-config", config, "-key", "cli-key", "-skip-verify-ssl=false"},
+			expected: result{Server: "http://upload:2283", Key: "cli-key", Folder: true, Types: ".jpg,.heic", Retries: 5, RetriesDelay: time.Second},
+		},
+		{
+			name:    "unknown profile",
+			command: "upload",
+			args:    []string{"-config", config, "-profile", "work"},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			command: "upload",
+			args:    []string{"-config", config + ".missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("IMMICH_GO_CONFIG", "")
+			t.Setenv("IMMICH_GO_PROFILE", "")
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+
+			app := SharedFlags{}
+			if c.global != nil {
+				fs := flag.NewFlagSet("main", flag.ContinueOnError)
+				app.SetFlags(fs)
+				if err := app.Parse(fs, append(c.global, c.command)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r := result{}
+			fs := flag.NewFlagSet(c.command, flag.ContinueOnError)
+			app.SetFlags(fs)
+			fs.BoolFunc("create-album-folder", "", myflag.BoolFlagFn(&r.Folder, false))
+			fs.StringVar(&r.Types, "select-types", "", "")
+			err := app.Parse(fs, c.args)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.wantErr {
+				return
+			}
+			r.Server, r.Key, r.SkipSSL, r.Retries, r.RetriesDelay = app.Server, app.Key, app.SkipSSL, app.APIRetries, app.APIRetriesDelay
+			if r != c.expected {
+				t.Errorf("expected %+v, got %+v", c.expected, r)
+			}
+		})
+	}
+}
+
+func TestFlagsBeforeCommand(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	app := SharedFlags{}
+	fs := flag.NewFlagSet("main", flag.ContinueOnError)
+	app.SetFlags(fs)
+	if err := app.Parse(fs, []string{"-api-retries=10", "-api-retries-delay=5s", "-asset-cache", "upload"}); err != nil {
+		t.Fatal(err)
+	}
+	sub := flag.NewFlagSet("upload", flag.ContinueOnError)
+	app.SetFlags(sub)
+	if err := app.Parse(sub, fs.Args()[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if app.APIRetries != 10 || app.APIRetriesDelay != 5*time.Second || app.APIMaxRetriesDelay != 30*time.Second {
+		t.Errorf("retries: %d, %s, %s", app.APIRetries, app.APIRetriesDelay, app.APIMaxRetriesDelay)
+	}
+	if !app.AssetCache {
+		t.Errorf("the asset cache is disabled")
+	}
+}
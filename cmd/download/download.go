@@ -0,0 +1,339 @@
+/*
+Download the server's assets into a local folder.
+*/
+package download
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
+	"github.com/simulot/immich-go/logger"
+)
+
+const DefaultPathTemplate = "{{.Year}}/{{.Month}}/{{.OriginalFileName}}"
+
+type DownloadCmd struct {
+	*cmd.SharedFlags
+	DateRange    immich.DateRange // Set capture date range
+	PathTemplate string           // Template for the file's path
+	Sidecar      bool             // Write a XMP sidecar beside each file
+	DryRun       bool             // Display actions but don't write anything
+	Destination  string           // Destination folder
+
+	tmpl      *template.Template
+	useAlbums bool                // the template uses the album name
+	albums    map[string][]string // album names by asset ID
+	paths     map[string]string   // paths already given during this run, and their asset ID
+}
+
+func NewDownloadCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*DownloadCmd, error) {
+	cmd := flag.NewFlagSet("download", flag.ExitOnError)
+	app := DownloadCmd{
+		SharedFlags: common,
+		albums:      map[string][]string{},
+		paths:       map[string]string{},
+	}
+
+	app.SharedFlags.SetFlags(cmd)
+	cmd.Var(&app.DateRange, "date", "Download only assets having a capture date in that range.")
+	cmd.StringVar(&app.PathTemplate, "path", DefaultPathTemplate, "Template of the path of downloaded files. Fields: .Year .Month .Day .OriginalFileName .Name .Ext .Album .Make .Model .ID")
+	cmd.BoolFunc("sidecar", "Write a XMP sidecar file with the date and GPS coordinates beside each file (default: TRUE)", myflag.BoolFlagFn(&app.Sidecar, true))
+	cmd.BoolFunc("dry-run", "display actions but don't write files", myflag.BoolFlagFn(&app.DryRun, false))
+	err := app.SharedFlags.Parse(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd.Args()) != 1 {
+		return nil, errors.New("give the destination folder")
+	}
+	app.Destination = cmd.Args()[0]
+
+	app.tmpl, err = template.New("path").Option("missingkey=error").Parse(app.PathTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -path template: %w", err)
+	}
+	app.useAlbums = strings.Contains(app.PathTemplate, ".Album")
+
+	err = app.SharedFlags.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func DownloadCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
+	app, err := NewDownloadCmd(ctx, common, args)
+	if err != nil {
+		return err
+	}
+	return app.Run(ctx)
+}
+
+func (app *DownloadCmd) Run(ctx context.Context) error {
+	app.Jnl.Log.MessageContinue(logger.OK, "Get server's assets...")
+	var list []*immich.Asset
+	err := app.Immich.GetAllAssetsWithFilter(ctx, func(a *immich.Asset) {
+		if a.IsTrashed {
+			return
+		}
+		if !app.DateRange.InRange(a.ExifInfo.DateTimeOriginal.Time) {
+			return
+		}
+		list = append(list, a)
+	})
+	if err != nil {
+		return err
+	}
+	app.Jnl.Log.MessageTerminate(logger.OK, " %d received", len(list))
+
+	if app.useAlbums {
+		err = app.getAlbums(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Process the assets in a stable order, so homonyms get the same names at each run
+	sort.Slice(list, func(i, j int) bool {
+		c := list[i].ExifInfo.DateTimeOriginal.Compare(list[j].ExifInfo.DateTimeOriginal.Time)
+		if c != 0 {
+			return c < 0
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	var errs error
+	downloaded, skipped, errCount := 0, 0, 0
+	for _, a := range list {
+		names, err := app.assetPaths(a)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			done, err := app.downloadAsset(ctx, a, name)
+			switch {
+			case err != nil:
+				err = fmt.Errorf("can't download %s: %w", name, err)
+				app.Jnl.Log.Error(err.Error())
+				errs = errors.Join(errs, err)
+				errCount++
+			case done:
+				downloaded++
+			default:
+				skipped++
+			}
+		}
+	}
+	app.Jnl.Log.OK("%d file(s) downloaded, %d file(s) already present, %d error(s)", downloaded, skipped, errCount)
+	return errs
+}
+
+func (app *DownloadCmd) getAlbums(ctx context.Context) error {
+	albums, err := app.Immich.GetAllAlbums(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get the album list from the server: %w", err)
+	}
+	for _, al := range albums {
+		content, err := app.Immich.GetAlbumInfo(ctx, al.ID)
+		if err != nil {
+			return fmt.Errorf("can't get the content of the album %q: %w", al.AlbumName, err)
+		}
+		for _, a := range content.Assets {
+			app.albums[a.ID] = append(app.albums[a.ID], al.AlbumName)
+		}
+	}
+	return nil
+}
+
+// PathFields are the fields available in the path template
+type PathFields struct {
+	ID               string
+	Year             string
+	Month            string
+	Day              string
+	OriginalFileName string // the original file name with its extension
+	Name             string // the original file name without extension
+	Ext              string
+	Album            string // the album name, empty when the asset isn't in an album
+	Make             string
+	Model            string
+}
+
+// assetPaths gives the destination paths of the asset. An asset belonging to several albums
+// gets one path by album when the template uses the album name.
+func (app *DownloadCmd) assetPaths(a *immich.Asset) ([]string, error) {
+	ext := path.Ext(a.OriginalPath)
+	name := strings.TrimSuffix(a.OriginalFileName, ext)
+	// The folders are named after the wall clock time of the capture, whatever the time zone
+	d := a.WallClock()
+	if a.ExifInfo.DateTimeOriginal.IsZero() && a.LocalDateTime.IsZero() {
+		d = a.FileCreatedAt.Time
+	}
+	f := PathFields{
+		ID:               a.ID,
+		Year:             d.Format("2006"),
+		Month:            d.Format("01"),
+		Day:              d.Format("02"),
+		OriginalFileName: sanitize(name + ext),
+		Name:             sanitize(name),
+		Ext:              ext,
+		Make:             sanitize(a.ExifInfo.Make),
+		Model:            sanitize(a.ExifInfo.Model),
+	}
+
+	albums := []string{""}
+	if app.useAlbums && len(app.albums[a.ID]) > 0 {
+		albums = app.albums[a.ID]
+	}
+	paths := []string{}
+	for _, al := range albums {
+		f.Album = sanitize(al)
+		p, err := ExecutePathTemplate(app.tmpl, f)
+		if err != nil {
+			return nil, err
+		}
+		p = app.uniquePath(p, a.ID)
+		if !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// ExecutePathTemplate gives the relative path of the file
+func ExecutePathTemplate(tmpl *template.Template, f PathFields) (string, error) {
+	b := strings.Builder{}
+	err := tmpl.Execute(&b, f)
+	if err != nil {
+		return "", fmt.Errorf("can't execute the -path template: %w", err)
+	}
+	p := path.Clean("/" + b.String())[1:]
+	if p == "" {
+		return "", errors.New("the -path template gives an empty path")
+	}
+	return p, nil
+}
+
+// uniquePath adds a suffix to the path when it is already used by another asset
+func (app *DownloadCmd) uniquePath(p string, id string) string {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for i := 1; ; i++ {
+		if used, ok := app.paths[p]; !ok || used == id {
+			app.paths[p] = id
+			return p
+		}
+		p = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+}
+
+var sanitizer = strings.NewReplacer("/", "-", "\\", "-", ":", "-", "*", "-", "?", "-", "\"", "-", "<", "-", ">", "-", "|", "-")
+
+func sanitize(s string) string {
+	return strings.TrimSpace(sanitizer.Replace(s))
+}
+
+// downloadAsset writes the asset's original file at the given place, unless it is already there.
+func (app *DownloadCmd) downloadAsset(ctx context.Context, a *immich.Asset, name string) (bool, error) {
+	fileName := filepath.Join(app.Destination, filepath.FromSlash(name))
+
+	if s, err := os.Stat(fileName); err == nil && (a.ExifInfo.FileSizeInByte == 0 || s.Size() == int64(a.ExifInfo.FileSizeInByte)) {
+		return false, app.writeSidecar(a, fileName+".xmp")
+	}
+
+	if app.DryRun {
+		app.Jnl.Log.OK("Download %s, skipped - dry run mode", name)
+		return true, nil
+	}
+	app.Jnl.Log.OK("Download %s", name)
+
+	err := os.MkdirAll(filepath.Dir(fileName), 0o755)
+	if err != nil {
+		return false, err
+	}
+	r, err := app.Immich.DownloadAsset(ctx, a.ID)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	// Write into a temporary file to never leave a partial file under the final name
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(tmp, r)
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+
+	d := a.FileModifiedAt.Time
+	if d.IsZero() {
+		d = a.ExifInfo.DateTimeOriginal.Time
+	}
+	if !d.IsZero() {
+		err = os.Chtimes(fileName, time.Now(), d)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, app.writeSidecar(a, fileName+".xmp")
+}
+
+// captureZone gives the time zone of the capture known by the server, or the offset between
+// the wall clock time and the date of the capture. It's nil when unknown: the local time zone is used.
+func captureZone(a *immich.Asset) *time.Location {
+	if loc := a.ExifInfo.Location(); loc != nil {
+		return loc
+	}
+	if a.LocalDateTime.IsZero() || a.ExifInfo.DateTimeOriginal.IsZero() {
+		return nil
+	}
+	offset := a.WallClock().Sub(a.ExifInfo.DateTimeOriginal.Time)
+	return time.FixedZone("", int(offset/time.Second))
+}
+
+// writeSidecar writes the XMP file when missing
+func (app *DownloadCmd) writeSidecar(a *immich.Asset, fileName string) error {
+	if !app.Sidecar || app.DryRun {
+		return nil
+	}
+	if _, err := os.Stat(fileName); err == nil {
+		return nil
+	}
+	sc := metadata.SideCar{
+		DateTaken:   a.ExifInfo.DateTimeOriginal.Time,
+		TimeZone:    captureZone(a),
+		Latitude:    a.ExifInfo.Latitude,
+		Longitude:   a.ExifInfo.Longitude,
+		Description: a.ExifInfo.Description,
+	}
+	b, err := sc.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, b, 0o644)
+}
@@ -0,0 +1,158 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+)
+
+// TestMain sets the local time zone of the tests, it's determined once for all tests
+func TestMain(m *testing.M) {
+	os.Setenv("TZ", "Europe/Paris")
+	os.Exit(m.Run())
+}
+
+func TestAssetPaths(t *testing.T) {
+	d := immich.ImmichTime{Time: time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)}
+	assets := []*immich.Asset{
+		{ID: "1", OriginalFileName: "PXL_20231006_063000139", OriginalPath: "upload/a.jpg", ExifInfo: immich.ExifInfo{DateTimeOriginal: d, Make: "Google"}},
+		{ID: "2", OriginalFileName: "PXL_20231006_063000139", OriginalPath: "upload/b.jpg", ExifInfo: immich.ExifInfo{DateTimeOriginal: d}},
+		{ID: "3", OriginalFileName: "IMG_0001", OriginalPath: "upload/c.HEIC", ExifInfo: immich.ExifInfo{DateTimeOriginal: d}},
+	}
+	albums := map[string][]string{
+		"1": {"Summer 2023", "Family/Friends"},
+	}
+
+	tc := []struct {
+		name     string
+		template string
+		expected [][]string
+	}{
+		{
+			name:     "default",
+			template: DefaultPathTemplate,
+			expected: [][]string{
+				{"2023/10/PXL_20231006_063000139.jpg"},
+				{"2023/10/PXL_20231006_063000139_1.jpg"},
+				{"2023/10/IMG_0001.HEIC"},
+			},
+		},
+		{
+			name:     "albums",
+			template: "{{.Album}}/{{.Year}}-{{.Month}}-{{.Day}}/{{.Name}}{{.Ext}}",
+			expected: [][]string{
+				{"Summer 2023/2023-10-06/PXL_20231006_063000139.jpg", "Family-Friends/2023-10-06/PXL_20231006_063000139.jpg"},
+				{"2023-10-06/PXL_20231006_063000139.jpg"},
+				{"2023-10-06/IMG_0001.HEIC"},
+			},
+		},
+		{
+			name:     "escape from the destination",
+			template: "../../{{.Make}}/{{.OriginalFileName}}",
+			expected: [][]string{
+				{"Google/PXL_20231006_063000139.jpg"},
+				{"PXL_20231006_063000139.jpg"},
+				{"IMG_0001.HEIC"},
+			},
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			app := DownloadCmd{
+				tmpl:      template.Must(template.New("path").Parse(c.template)),
+				useAlbums: true,
+				albums:    albums,
+				paths:     map[string]string{},
+			}
+			for i, a := range assets {
+				got, err := app.assetPaths(a)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, c.expected[i]) {
+					t.Errorf("asset %s: expected %v, got %v", a.ID, c.expected[i], got)
+				}
+				// Asking again gives the same paths
+				again, _ := app.assetPaths(a)
+				if !reflect.DeepEqual(got, again) {
+					t.Errorf("asset %s: paths are not stable: %v, %v", a.ID, got, again)
+				}
+			}
+		})
+	}
+}
+
+func TestWallClockDate(t *testing.T) {
+	// Captured at 8:30 in Tokyo, the time zone given by the server isn't known
+	a := &immich.Asset{
+		ID:               "1",
+		OriginalFileName: "IMG_0001",
+		OriginalPath:     "upload/IMG_0001.jpg",
+		LocalDateTime:    immich.ImmichTime{Time: time.Date(2023, 10, 7, 8, 30, 0, 0, time.UTC)},
+		ExifInfo: immich.ExifInfo{
+			DateTimeOriginal: immich.ImmichTime{Time: time.Date(2023, 10, 6, 23, 30, 0, 0, time.UTC)},
+			TimeZone:         "Somewhere/Unknown",
+		},
+	}
+	dest := t.TempDir()
+	app := DownloadCmd{
+		tmpl:    template.Must(template.New("path").Parse("{{.Year}}-{{.Month}}-{{.Day}}/{{.Name}}{{.Ext}}")),
+		paths:   map[string]string{},
+		Sidecar: true,
+	}
+	got, err := app.assetPaths(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"2023-10-07/IMG_0001.jpg"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	name := filepath.Join(dest, "IMG_0001.jpg.xmp")
+	if err = app.writeSidecar(a, name); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<exif:DateTimeOriginal>2023-10-07T08:30:00+09:00</exif:DateTimeOriginal>") {
+		t.Errorf("unexpected date of capture:\n%s", b)
+	}
+}
+
+func TestDownloadFakeServer(t *testing.T) {
+	ctx := context.Background()
+	s := fakeimmich.New()
+	defer s.Close()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	d := time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)
+	s.AddAsset(fakeimmich.Asset{OriginalFileName: "OLD", OriginalPath: "upload/OLD.jpg", DateTimeOriginal: time.Date(1820, 1, 1, 0, 0, 0, 0, time.UTC), Content: []byte("old")})
+	s.AddAsset(fakeimmich.Asset{OriginalFileName: "NODATE", OriginalPath: "upload/NODATE.jpg", FileCreatedAt: d, Content: []byte("no date")})
+	failing := s.AddAsset(fakeimmich.Asset{OriginalFileName: "FAIL", OriginalPath: "upload/FAIL.jpg", DateTimeOriginal: d, Content: []byte("fail")})
+	s.FailNext(http.MethodPost, "/download/asset/"+failing, http.StatusNotFound, 1)
+
+	dest := t.TempDir()
+	app := cmd.SharedFlags{}
+	err := DownloadCommand(ctx, &app, []string{"-server=" + s.URL, "-key=" + s.Key, "-log-file=" + filepath.Join(t.TempDir(), "download.log"), "-sidecar=false", "-path={{.OriginalFileName}}", dest})
+	if err == nil {
+		t.Error("the failed download isn't reported")
+	}
+	for _, name := range []string{"OLD.jpg", "NODATE.jpg"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Errorf("the asset %s isn't downloaded: %s", name, err)
+		}
+	}
+}
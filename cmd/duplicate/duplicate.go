@@ -23,7 +23,7 @@ type DuplicateCmd struct {
 	*cmd.SharedFlags
 	AssumeYes      bool             // When true, doesn't ask to the user
 	DateRange      immich.DateRange // Set capture date range
-	IgnoreTZErrors bool             // Enable TZ error tolerance
+	IgnoreTZErrors bool             // Deprecated: the wall clock times of the captures are compared
 
 	assetsByID          map[string]*immich.Asset
 	assetsByBaseAndDate map[duplicateKey][]*immich.Asset
@@ -47,10 +47,10 @@ func NewDuplicateCmd(ctx context.Context, common *cmd.SharedFlags, args []string
 
 	app.SharedFlags.SetFlags(cmd)
 
-	cmd.BoolFunc("ignore-tz-errors", "Ignore timezone difference to check duplicates (default: FALSE).", myflag.BoolFlagFn(&app.IgnoreTZErrors, false))
+	cmd.BoolFunc("ignore-tz-errors", "Deprecated, the dates of capture are compared without their time zone.", myflag.BoolFlagFn(&app.IgnoreTZErrors, false))
 	cmd.BoolFunc("yes", "When true, assume Yes to all actions", myflag.BoolFlagFn(&app.AssumeYes, false))
 	cmd.Var(&app.DateRange, "date", "Process only documents having a capture date in that range.")
-	err := cmd.Parse(args)
+	err := app.SharedFlags.Parse(cmd, args)
 	if err != nil {
 		return nil, err
 	}
@@ -77,10 +77,8 @@ func DuplicateCommand(ctx context.Context, common *cmd.SharedFlags, args []strin
 			return
 		}
 		app.assetsByID[a.ID] = a
-		d := a.ExifInfo.DateTimeOriginal.Time.Round(time.Minute)
-		if app.IgnoreTZErrors {
-			d = time.Date(d.Year(), d.Month(), d.Day(), 0, d.Minute(), d.Second(), 0, time.UTC)
-		}
+		// The wall clock time of the capture doesn't depend on the time zone the server has determined
+		d := a.WallClock().Round(time.Minute)
 		k := duplicateKey{
 			Date: d,
 			Name: strings.ToUpper(a.OriginalFileName + path.Ext(a.OriginalPath)),
@@ -0,0 +1,42 @@
+package duplicate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+)
+
+func TestDuplicateFakeServer(t *testing.T) {
+	ctx := context.Background()
+	s := fakeimmich.New()
+	defer s.Close()
+
+	d := time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)
+	small := s.AddAsset(fakeimmich.Asset{OriginalFileName: "PXL_20231006_083000", OriginalPath: "upload/a.jpg", DateTimeOriginal: d, Content: []byte("small")})
+	large := s.AddAsset(fakeimmich.Asset{OriginalFileName: "PXL_20231006_083000", OriginalPath: "upload/b.jpg", DateTimeOriginal: d.Add(10 * time.Second), Content: []byte("the large copy")})
+	other := s.AddAsset(fakeimmich.Asset{OriginalFileName: "PXL_20231006_093000", OriginalPath: "upload/c.jpg", DateTimeOriginal: d.Add(time.Hour), Content: []byte("other")})
+	s.AddAlbum("album", small, other)
+
+	app := cmd.SharedFlags{}
+	err := DuplicateCommand(ctx, &app, []string{"-server=" + s.URL, "-key=" + s.Key, "-log-file=" + filepath.Join(t.TempDir(), "duplicate.log"), "-yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, _ := s.Asset(small); !a.IsTrashed {
+		t.Errorf("the small copy isn't trashed")
+	}
+	for _, id := range []string{large, other} {
+		if a, _ := s.Asset(id); a.IsTrashed {
+			t.Errorf("the asset %s is trashed", a.OriginalPath)
+		}
+	}
+	albums := s.Albums()
+	if len(albums) != 1 || len(albums[0].AssetIDs) != 3 || albums[0].AssetIDs[2] != large {
+		t.Errorf("the best copy isn't added to the album: %v", albums)
+	}
+}
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/geotag"
+	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/helpers/tzone"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type GeotagCmd struct {
+	*cmd.SharedFlags
+	DryRun    bool
+	DateRange immich.DateRange // Set capture date range
+	MaxGap    time.Duration    // Maximum delay between the capture and the points of the tracks
+	Offset    time.Duration    // Added to the camera's time to match the time of the tracks
+
+	tracks *geotag.Tracks
+}
+
+func NewGeotagCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*GeotagCmd, error) {
+	cmd := flag.NewFlagSet("metadata geotag", flag.ExitOnError)
+	app := GeotagCmd{
+		SharedFlags: common,
+	}
+
+	app.SharedFlags.SetFlags(cmd)
+	cmd.BoolFunc("dry-run", "display actions, but don't touch the server assets", myflag.BoolFlagFn(&app.DryRun, false))
+	cmd.Var(&app.DateRange, "date", "Process only assets having a capture date in that range.")
+	cmd.DurationVar(&app.MaxGap, "geotag-max-gap", 10*time.Minute, "Maximum delay between the capture and the points of the tracks")
+	cmd.DurationVar(&app.Offset, "geotag-offset", 0, "Added to the camera's time to match the time of the tracks, when the camera's clock is wrong")
+	err := app.SharedFlags.Parse(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd.Args()) == 0 {
+		return nil, errors.New("give the GPX or KML tracks")
+	}
+	app.tracks = geotag.NewTracks(app.MaxGap, app.Offset)
+	for _, f := range cmd.Args() {
+		err = app.tracks.Load(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = app.SharedFlags.Start(ctx)
+	return &app, err
+}
+
+// GeotagCommand sets the position of the server's assets without GPS coordinates from GPX or KML tracks
+func GeotagCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
+	app, err := NewGeotagCmd(ctx, common, args)
+	if err != nil {
+		return err
+	}
+	app.Jnl.Log.OK("%d point(s) read from the tracks", app.tracks.Len())
+
+	app.Jnl.Log.MessageContinue(logger.OK, "Get server's assets...")
+	list := []*immich.Asset{}
+	err = app.Immich.GetAllAssetsWithFilter(ctx, func(a *immich.Asset) {
+		if a.IsTrashed || a.ExifInfo.Latitude != 0 || a.ExifInfo.Longitude != 0 || a.ExifInfo.DateTimeOriginal.IsZero() {
+			return
+		}
+		if !app.DateRange.InRange(a.ExifInfo.DateTimeOriginal.Time) {
+			return
+		}
+		list = append(list, a)
+	})
+	if err != nil {
+		return err
+	}
+	app.Jnl.Log.MessageTerminate(logger.OK, " %d asset(s) without GPS coordinates", len(list))
+
+	count := 0
+	for _, a := range list {
+		p, ok := app.tracks.Locate(captureInstant(a))
+		if !ok {
+			continue
+		}
+		count++
+		app.Jnl.Log.OK("%s: %.6f, %.6f", a.OriginalPath, p.Latitude, p.Longitude)
+		if app.DryRun {
+			continue
+		}
+		_, err = app.Immich.UpdateAssetFields(ctx, a.ID, immich.AssetUpdate{Latitude: &p.Latitude, Longitude: &p.Longitude})
+		if err != nil {
+			app.Jnl.Log.Error("can't update the asset %s: %s", a.OriginalPath, err)
+		}
+	}
+	app.Jnl.Log.OK("%d asset(s) geotagged", count)
+	if app.DryRun {
+		app.Jnl.Log.OK("Dry-run mode. Exiting")
+	}
+	return nil
+}
+
+// captureInstant gives the instant of the capture.
+// When the server doesn't know the time zone, the wall clock time is taken in the local time zone.
+func captureInstant(a *immich.Asset) time.Time {
+	if a.ExifInfo.Location() != nil {
+		return a.ExifInfo.DateTimeOriginal.Time
+	}
+	local, err := tzone.Local()
+	if err != nil {
+		local = time.Local
+	}
+	w := a.WallClock()
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), local)
+}
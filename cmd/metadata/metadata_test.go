@@ -0,0 +1,177 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+	"github.com/simulot/immich-go/logger"
+)
+
+// TestMain sets the local time zone of the tests, it's determined once for all tests
+func TestMain(m *testing.M) {
+	os.Setenv("TZ", "Europe/Paris")
+	os.Exit(m.Run())
+}
+
+func TestTimeZoneMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		asset    string
+		mismatch bool
+		want     time.Time
+	}{
+		{
+			name:  "time zone matching the location",
+			asset: `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-05T23:30:00.000Z","timeZone":"Asia/Tokyo","latitude":35.6586,"longitude":139.7454}}`,
+		},
+		{
+			name:     "no time zone, the date is taken as UTC",
+			asset:    `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z","latitude":35.6586,"longitude":139.7454}}`,
+			mismatch: true,
+			want:     time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "camera set to the home time zone",
+			asset:    `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T06:30:00.000Z","timeZone":"UTC+2","latitude":35.6586,"longitude":139.7454}}`,
+			mismatch: true,
+			want:     time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "no location",
+			asset: `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a immich.Asset
+			err := json.Unmarshal([]byte(tt.asset), &a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, loc, mismatch := timeZoneMismatch(&a)
+			if mismatch != tt.mismatch {
+				t.Fatalf("timeZoneMismatch() = %v, want %v", mismatch, tt.mismatch)
+			}
+			if mismatch && (!d.Equal(tt.want) || loc.String() != "Asia/Tokyo") {
+				t.Errorf("timeZoneMismatch() = %s %s, want %s", d, loc, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTimeZone(t *testing.T) {
+	var a immich.Asset
+	err := json.Unmarshal([]byte(`{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z","latitude":35.6586,"longitude":139.7454}}`), &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Estimated time zone: reported only
+	ba := broken{a: &a}
+	ba.checkTimeZone(false)
+	if ba.fixable || !ba.SideCar.DateTaken.IsZero() || !reflect.DeepEqual(ba.reason, []string{"time zone unknown doesn't match the location's estimated time zone Asia/Tokyo"}) {
+		t.Errorf("unexpected result without boundaries: %v %v %s", ba.fixable, ba.reason, ba.SideCar.DateTaken)
+	}
+
+	ba = broken{a: &a}
+	ba.checkTimeZone(true)
+	if !ba.fixable || !ba.SideCar.DateTaken.Equal(time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC)) || ba.SideCar.TimeZone.String() != "Asia/Tokyo" {
+		t.Errorf("unexpected result with boundaries: %v %v %s", ba.fixable, ba.reason, ba.SideCar.DateTaken)
+	}
+}
+
+func TestCaptureInstant(t *testing.T) {
+	tests := []struct {
+		name  string
+		asset string
+		want  time.Time
+	}{
+		{
+			name:  "known time zone",
+			asset: `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-05T23:30:00.000Z","timeZone":"Asia/Tokyo"}}`,
+			want:  time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC),
+		},
+		{
+			name:  "unknown time zone",
+			asset: `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`,
+			want:  time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a immich.Asset
+			err := json.Unmarshal([]byte(tt.asset), &a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := captureInstant(&a); !got.Equal(tt.want) {
+				t.Errorf("captureInstant() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixChanges(t *testing.T) {
+	var a immich.Asset
+	err := json.Unmarshal([]byte(`{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z","latitude":35.6586,"longitude":139.7454}}`), &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	sc := metadata.SideCar{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, tokyo), TimeZone: tokyo}
+
+	changes := fixChanges(&a, sc)
+	want := []string{"date of capture: 2023-10-06T10:30:00+02:00 -> 2023-10-06T08:30:00+09:00"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("fixChanges() = %v, want %v", changes, want)
+	}
+
+	u := assetUpdate(sc)
+	if u.DateTimeOriginal != "2023-10-06T08:30:00+09:00" || u.Latitude != nil || u.Description != nil {
+		t.Errorf("unexpected update: %+v", u)
+	}
+}
+
+func TestFixWithAPIFailure(t *testing.T) {
+	s := fakeimmich.New()
+	defer s.Close()
+	ic, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.Retries = 0
+	old := time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)
+	ids := []string{
+		s.AddAsset(fakeimmich.Asset{OriginalFileName: "A", OriginalPath: "upload/A.jpg", Content: []byte("A"), DateTimeOriginal: old}),
+		s.AddAsset(fakeimmich.Asset{OriginalFileName: "B", OriginalPath: "upload/B.jpg", Content: []byte("B"), DateTimeOriginal: old}),
+	}
+	list, err := ic.GetAllAssets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := time.Date(2023, 10, 6, 10, 30, 0, 0, time.UTC)
+	brokenAssets := []broken{}
+	for _, a := range list {
+		brokenAssets = append(brokenAssets, broken{a: a, fixable: true, SideCar: metadata.SideCar{DateTaken: fixed}})
+	}
+
+	s.FailNext(http.MethodPut, "/asset/"+ids[0], http.StatusBadRequest, 1)
+	app := &cmd.SharedFlags{Immich: ic, Jnl: logger.NewJournal(logger.NoLog{})}
+	err = fixWithAPI(context.Background(), app, brokenAssets)
+	if err == nil || !strings.Contains(err.Error(), "upload/A.jpg") {
+		t.Errorf("fixWithAPI() error = %v, want the failure of upload/A.jpg", err)
+	}
+	if a, _ := s.Asset(ids[1]); !a.DateTimeOriginal.Equal(fixed) {
+		t.Errorf("the asset B isn't fixed: %s", a.DateTimeOriginal)
+	}
+}
@@ -0,0 +1,164 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestParseShift(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "1h", want: time.Hour},
+		{s: "-8h", want: -8 * time.Hour},
+		{s: "+1d", want: 24 * time.Hour},
+		{s: "-1d2h30m", want: -(26*time.Hour + 30*time.Minute)},
+		{s: "365d", want: 365 * 24 * time.Hour},
+		{s: "", wantErr: true},
+		{s: "-", wantErr: true},
+		{s: "xd", wantErr: true},
+		{s: "1d-2h", wantErr: true},
+		{s: "2 hours", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseShift(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseShift() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseShift() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftedDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		asset string
+		shift time.Duration
+		want  string
+	}{
+		{
+			name:  "known time zone",
+			asset: `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-05T23:30:00.000Z","timeZone":"Asia/Tokyo"}}`,
+			shift: -time.Hour,
+			want:  "2023-10-06T07:30:00+09:00",
+		},
+		{
+			name:  "unknown time zone, the wall clock time is shifted in the local time zone",
+			asset: `{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`,
+			shift: 24 * time.Hour,
+			want:  "2023-10-07T08:30:00+02:00",
+		},
+		{
+			name:  "across the daylight saving time change",
+			asset: `{"localDateTime":"2023-10-28T12:00:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-28T10:00:00.000Z","timeZone":"Europe/Paris"}}`,
+			shift: 24 * time.Hour,
+			want:  "2023-10-29T12:00:00+01:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a immich.Asset
+			if err := json.Unmarshal([]byte(tt.asset), &a); err != nil {
+				t.Fatal(err)
+			}
+			d, loc := shiftedDate(&a, tt.shift)
+			if got := formatDate(d, loc); got != tt.want {
+				t.Errorf("shiftedDate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftSelection(t *testing.T) {
+	assets := []*immich.Asset{}
+	for _, s := range []string{
+		`{"id":"1","originalFileName":"DSC_0001","originalPath":"upload/a.jpg","exifInfo":{"make":"NIKON CORPORATION","model":"NIKON D90 ","dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`,
+		`{"id":"2","originalFileName":"DSC_0002","originalPath":"upload/b.jpg","exifInfo":{"make":"NIKON CORPORATION","model":"NIKON D90","dateTimeOriginal":"2023-10-06T08:35:00.000Z"}}`,
+		`{"id":"3","originalFileName":"PXL_20231006_083000","originalPath":"upload/c.jpg","exifInfo":{"make":"Google","model":"Pixel 6","dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`,
+		`{"id":"4","originalFileName":"DSC_0003","originalPath":"upload/d.jpg","exifInfo":{"make":"NIKON CORPORATION","model":"NIKON D90","dateTimeOriginal":"2022-10-06T08:30:00.000Z"}}`,
+		`{"id":"5","originalFileName":"DSC_0004","originalPath":"upload/e.jpg","isTrashed":true,"exifInfo":{"make":"NIKON CORPORATION","model":"NIKON D90","dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`,
+	} {
+		var a immich.Asset
+		if err := json.Unmarshal([]byte(s), &a); err != nil {
+			t.Fatal(err)
+		}
+		assets = append(assets, &a)
+	}
+
+	dr := immich.DateRange{}
+	_ = dr.Set("2023")
+
+	tests := []struct {
+		name    string
+		app     ShiftCmd
+		inAlbum map[string]bool
+		want    []string
+	}{
+		{name: "model", app: ShiftCmd{Model: "nikon d90"}, want: []string{"1", "2", "4"}},
+		{name: "model and date", app: ShiftCmd{Model: "NIKON D90", DateRange: dr}, want: []string{"1", "2"}},
+		{name: "make", app: ShiftCmd{Make: "google"}, want: []string{"3"}},
+		{name: "name", app: ShiftCmd{Name: "dsc_*.jpg"}, want: []string{"1", "2", "4"}},
+		{name: "album", app: ShiftCmd{Make: "NIKON CORPORATION"}, inAlbum: map[string]bool{"2": true, "3": true}, want: []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, a := range assets {
+				if tt.app.selected(a, tt.inAlbum) {
+					got = append(got, a.ID)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("selected %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("selected %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	ref, err := findReference(assets, "dsc_0002.JPG")
+	if err != nil || ref.ID != "2" {
+		t.Errorf("findReference() = %v, %v", ref, err)
+	}
+	if _, err = findReference(assets, "missing.jpg"); err == nil {
+		t.Errorf("findReference() should fail when the reference is missing")
+	}
+}
+
+func TestNewShiftCmdArgs(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "no selection", args: []string{"-by", "1h"}, wantErr: "select the assets to shift"},
+		{name: "no selection, yes", args: []string{"-yes", "-by", "1h"}, wantErr: "select the assets to shift"},
+		{name: "no shift", args: []string{"-make", "NIKON"}, wantErr: "give the shift"},
+		{name: "shift and reference", args: []string{"-date", "2023", "-by", "1h", "-reference", "DSC_0001"}, wantErr: "can't be used together"},
+		{name: "reference without date", args: []string{"-album", "trip", "-reference", "DSC_0001"}, wantErr: "needs the -reference-date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewShiftCmd(context.Background(), &cmd.SharedFlags{}, tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewShiftCmd() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
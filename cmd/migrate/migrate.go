@@ -0,0 +1,331 @@
+/*
+Copy the assets of an immich server to another one.
+*/
+package migrate
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/cmd/upload"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type MigrateCmd struct {
+	*cmd.SharedFlags                  // source server
+	Dest             *cmd.SharedFlags // destination server
+	DateRange        immich.DateRange // Set capture date range
+	DryRun           bool             // Display actions but don't change the destination
+	Albums           bool             // Recreate albums on the destination (default: TRUE)
+	Stacks           bool             // Recreate stacks on the destination (default: TRUE)
+
+	destIndex *upload.AssetIndex // assets present on the destination
+	fsys      *remoteFS          // source assets
+	ids       map[string]string  // destination asset ID by source asset ID
+
+	uploaded, present, errCount int
+}
+
+func NewMigrateCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*MigrateCmd, error) {
+	dest := &cmd.SharedFlags{}
+	cmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	app := MigrateCmd{
+		SharedFlags: common,
+		Dest:        dest,
+		ids:         map[string]string{},
+	}
+
+	app.SharedFlags.SetFlags(cmd)
+	app.Dest.SetDestinationFlags(cmd)
+	cmd.Var(&app.DateRange, "date", "Migrate only assets having a capture date in that range.")
+	cmd.BoolFunc("dry-run", "display actions but don't touch the destination", myflag.BoolFlagFn(&app.DryRun, false))
+	cmd.BoolFunc("albums", "Recreate the albums on the destination server (default: TRUE)", myflag.BoolFlagFn(&app.Albums, true))
+	cmd.BoolFunc("stacks", "Recreate the stacks on the destination server (default: TRUE)", myflag.BoolFlagFn(&app.Stacks, true))
+	err := app.SharedFlags.Parse(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	if app.Dest.Profile != "" {
+		err = app.SharedFlags.SetDestinationProfile(cmd, app.Dest.Profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	app.Jnl.Log.OK("Connecting to the source server")
+	err = app.SharedFlags.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	app.Jnl.Log.OK("Connecting to the destination server")
+	app.Dest.Inherit(app.SharedFlags)
+	if app.Dest.Server == "" && app.Dest.API == "" && app.Dest.Immich == nil {
+		return nil, errors.New("missing -dest-server, destination Immich server address")
+	}
+	err = app.Dest.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	app.fsys = newRemoteFS(ctx, app.Immich)
+	return &app, nil
+}
+
+func MigrateCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
+	app, err := NewMigrateCmd(ctx, common, args)
+	if err != nil {
+		return err
+	}
+	return app.Run(ctx)
+}
+
+func (app *MigrateCmd) Run(ctx context.Context) error {
+	app.Jnl.Log.MessageContinue(logger.OK, "Get source server's assets...")
+	var list []*immich.Asset
+	err := app.Immich.GetAllAssetsWithFilter(ctx, func(a *immich.Asset) {
+		if a.IsTrashed {
+			return
+		}
+		if !app.DateRange.InRange(a.ExifInfo.DateTimeOriginal.Time) {
+			return
+		}
+		list = append(list, a)
+	})
+	if err != nil {
+		return err
+	}
+	app.Jnl.Log.MessageTerminate(logger.OK, " %d received", len(list))
+	sort.Slice(list, func(i, j int) bool {
+		c := list[i].ExifInfo.DateTimeOriginal.Compare(list[j].ExifInfo.DateTimeOriginal.Time)
+		if c != 0 {
+			return c < 0
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	app.Jnl.Log.MessageContinue(logger.OK, "Get destination server's assets...")
+	var destList []*immich.Asset
+	err = app.Dest.Immich.GetAllAssetsWithFilter(ctx, func(a *immich.Asset) {
+		if a.IsTrashed {
+			return
+		}
+		destList = append(destList, a)
+	})
+	if err != nil {
+		return err
+	}
+	app.Jnl.Log.MessageTerminate(logger.OK, " %d received", len(destList))
+	app.destIndex = upload.NewAssetIndex(destList)
+
+	for _, a := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = app.migrateAsset(ctx, a)
+		if err != nil {
+			app.errCount++
+			app.Jnl.AddEntry(a.OriginalPath, logger.ServerError, err.Error())
+		}
+	}
+
+	if app.Albums {
+		err = app.migrateAlbums(ctx)
+		if err != nil {
+			app.Jnl.Log.Error(err.Error())
+		}
+	}
+	if app.Stacks {
+		app.migrateStacks(ctx, list)
+	}
+
+	app.Jnl.Log.OK("%d asset(s) uploaded, %d asset(s) already on the destination, %d error(s)", app.uploaded, app.present, app.errCount)
+	return nil
+}
+
+// migrateAsset copies the asset to the destination when needed, and updates its properties
+func (app *MigrateCmd) migrateAsset(ctx context.Context, a *immich.Asset) error {
+	la := &browser.LocalAssetFile{
+		FSys:        app.fsys,
+		FileName:    app.fsys.add(a),
+		Title:       originalFileName(a),
+		Description: a.ExifInfo.Description,
+		DateTaken:   a.ExifInfo.DateTimeOriginal.Time,
+		Latitude:    a.ExifInfo.Latitude,
+		Longitude:   a.ExifInfo.Longitude,
+		Archived:    a.IsArchived,
+		Favorite:    a.IsFavorite,
+		FileSize:    a.ExifInfo.FileSizeInByte,
+		FileDate:    a.FileModifiedAt.Time,
+		Checksum:    a.Checksum,
+	}
+	if la.DateTaken.IsZero() {
+		la.DateTaken = a.FileCreatedAt.Time
+	}
+	defer la.Close()
+
+	var advice *upload.Advice
+	var err error
+	if sa := app.destIndex.ByChecksum(a.Checksum); a.Checksum != "" && sa != nil {
+		advice = &upload.Advice{Advice: upload.SameContentOnServer, ServerAsset: sa}
+	} else {
+		advice, err = app.destIndex.ShouldUpload(la)
+		if err != nil {
+			return err
+		}
+	}
+
+	var destID string
+	switch advice.Advice {
+	case upload.NotOnServer, upload.SmallerOnServer:
+		var resp immich.AssetResponse
+		if !app.DryRun {
+			resp, err = app.Dest.Immich.AssetUpload(ctx, la)
+			if err != nil {
+				return err
+			}
+		} else {
+			resp.ID = uuid.NewString()
+		}
+		destID = resp.ID
+		if resp.Duplicate {
+			app.present++
+			app.Jnl.AddEntry(a.OriginalPath, logger.ServerDuplicate, "already on the destination")
+		} else {
+			app.uploaded++
+			app.destIndex.AddLocalAsset(la, destID)
+			if advice.Advice == upload.SmallerOnServer {
+				app.Jnl.AddEntry(a.OriginalPath, logger.Upgraded, advice.Message)
+				err = app.replaceDestAsset(ctx, advice.ServerAsset.ID, destID)
+				if err != nil {
+					return err
+				}
+			} else {
+				app.Jnl.AddEntry(a.OriginalPath, logger.Uploaded, la.Title)
+			}
+		}
+	default:
+		app.present++
+		destID = advice.ServerAsset.ID
+		app.Jnl.AddEntry(a.OriginalPath, logger.ServerDuplicate, advice.Message)
+	}
+	app.ids[a.ID] = destID
+	app.Jnl.SetAsset(a.OriginalPath, destID, nil)
+
+	if !app.DryRun && (la.Favorite || la.Archived || la.Description != "") {
+		_, err = app.Dest.Immich.UpdateAsset(ctx, destID, la)
+		if err != nil {
+			return fmt.Errorf("can't update the asset on the destination: %w", err)
+		}
+	}
+	return nil
+}
+
+// replaceDestAsset puts the better copy into the albums of the destination's asset, and trashes the latter
+func (app *MigrateCmd) replaceDestAsset(ctx context.Context, oldID, newID string) error {
+	if app.DryRun {
+		app.Jnl.Log.OK("Replace the destination's asset %s skipped - dry run mode", oldID)
+		return nil
+	}
+	albums, err := app.Dest.Immich.GetAssetAlbums(ctx, oldID)
+	if err != nil {
+		return fmt.Errorf("can't get the albums of the asset replaced on the destination: %w", err)
+	}
+	for _, al := range albums {
+		_, err = app.Dest.Immich.AddAssetToAlbum(ctx, al.ID, []string{newID})
+		if err != nil {
+			return fmt.Errorf("can't update the album %q on the destination server: %w", al.AlbumName, err)
+		}
+	}
+	err = app.Dest.Immich.DeleteAssets(ctx, []string{oldID}, false)
+	if err != nil {
+		return fmt.Errorf("can't delete the asset replaced on the destination: %w", err)
+	}
+	return nil
+}
+
+// migrateAlbums recreates the source's albums on the destination with the migrated assets
+func (app *MigrateCmd) migrateAlbums(ctx context.Context) error {
+	srcAlbums, err := app.Immich.GetAllAlbums(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get the album list from the source server: %w", err)
+	}
+	destAlbums, err := app.Dest.Immich.GetAllAlbums(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get the album list from the destination server: %w", err)
+	}
+	destIDs := map[string]string{}
+	for _, al := range destAlbums {
+		destIDs[al.AlbumName] = al.ID
+	}
+
+	for _, al := range srcAlbums {
+		content, err := app.Immich.GetAlbumInfo(ctx, al.ID)
+		if err != nil {
+			return fmt.Errorf("can't get the content of the album %q: %w", al.AlbumName, err)
+		}
+		ids := map[string]any{}
+		for _, a := range content.Assets {
+			if id, ok := app.ids[a.ID]; ok {
+				ids[id] = nil
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if app.DryRun {
+			app.Jnl.Log.OK("Update the album %s skipped - dry run mode", al.AlbumName)
+			continue
+		}
+		if id, ok := destIDs[al.AlbumName]; ok {
+			app.Jnl.Log.OK("Update the album %s", al.AlbumName)
+			_, err = app.Dest.Immich.AddAssetToAlbum(ctx, id, gen.MapKeys(ids))
+		} else {
+			app.Jnl.Log.OK("Create the album %s", al.AlbumName)
+			_, err = app.Dest.Immich.CreateAlbum(ctx, al.AlbumName, gen.MapKeys(ids))
+		}
+		if err != nil {
+			return fmt.Errorf("can't update the album %q on the destination server: %w", al.AlbumName, err)
+		}
+	}
+	return nil
+}
+
+// migrateStacks recreates the source's stacks on the destination
+func (app *MigrateCmd) migrateStacks(ctx context.Context, list []*immich.Asset) {
+	stacks := map[string][]string{}
+	parents := []string{}
+	for _, a := range list {
+		if a.StackParentID == "" {
+			continue
+		}
+		if _, ok := stacks[a.StackParentID]; !ok {
+			parents = append(parents, a.StackParentID)
+		}
+		if id, ok := app.ids[a.ID]; ok {
+			stacks[a.StackParentID] = append(stacks[a.StackParentID], id)
+		}
+	}
+	for _, p := range parents {
+		cover, ok := app.ids[p]
+		if !ok || len(stacks[p]) == 0 {
+			continue
+		}
+		if app.DryRun {
+			app.Jnl.Log.OK("Stack %d asset(s) skipped - dry run mode", len(stacks[p])+1)
+			continue
+		}
+		app.Jnl.Log.OK("Stack %d asset(s)", len(stacks[p])+1)
+		err := app.Dest.Immich.StackAssets(ctx, cover, stacks[p])
+		if err != nil {
+			app.Jnl.Log.Warning("Can't stack images: %s", err)
+		}
+	}
+}
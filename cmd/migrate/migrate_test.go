@@ -0,0 +1,185 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+// fakeServer is a minimal immich server holding assets and albums in memory
+type fakeServer struct {
+	immich.ImmichInterface
+	assets   []*immich.Asset
+	content  map[string]string   // file content by asset ID
+	albums   map[string][]string // asset IDs by album name
+	stacks   map[string][]string // stacked IDs by cover ID
+	favorite map[string]bool
+	deleted  []string
+	nextID   int
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		content:  map[string]string{},
+		albums:   map[string][]string{},
+		stacks:   map[string][]string{},
+		favorite: map[string]bool{},
+	}
+}
+
+func (s *fakeServer) GetAllAssetsWithFilter(ctx context.Context, filter func(*immich.Asset)) error {
+	for _, a := range s.assets {
+		filter(a)
+	}
+	return nil
+}
+
+func (s *fakeServer) DownloadAsset(ctx context.Context, id string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(s.content[id])), nil
+}
+
+func (s *fakeServer) AssetUpload(ctx context.Context, la *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	f, err := la.Open()
+	if err != nil {
+		return immich.AssetResponse{}, err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return immich.AssetResponse{}, err
+	}
+	s.nextID++
+	id := "dest-" + strconv.Itoa(s.nextID)
+	s.content[id] = string(b)
+	s.assets = append(s.assets, &immich.Asset{ID: id, OriginalFileName: la.Title, Checksum: la.Checksum})
+	return immich.AssetResponse{ID: id}, nil
+}
+
+func (s *fakeServer) UpdateAsset(ctx context.Context, id string, la *browser.LocalAssetFile) (*immich.Asset, error) {
+	s.favorite[id] = la.Favorite
+	return nil, nil
+}
+
+func (s *fakeServer) UpdateAssetFields(ctx context.Context, id string, param immich.AssetUpdate) (*immich.Asset, error) {
+	return nil, nil
+}
+
+func (s *fakeServer) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	r := []immich.AlbumSimplified{}
+	for name := range s.albums {
+		r = append(r, immich.AlbumSimplified{ID: name, AlbumName: name})
+	}
+	return r, nil
+}
+
+func (s *fakeServer) GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error) {
+	r := immich.AlbumContent{ID: id, AlbumName: id}
+	for _, a := range s.albums[id] {
+		r.Assets = append(r.Assets, immich.AssetSimplified{ID: a})
+	}
+	return r, nil
+}
+
+func (s *fakeServer) AddAssetToAlbum(ctx context.Context, id string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	s.albums[id] = append(s.albums[id], ids...)
+	return nil, nil
+}
+
+func (s *fakeServer) CreateAlbum(ctx context.Context, name string, ids []string) (immich.AlbumSimplified, error) {
+	s.albums[name] = ids
+	return immich.AlbumSimplified{ID: name, AlbumName: name}, nil
+}
+
+func (s *fakeServer) GetAssetAlbums(ctx context.Context, id string) ([]immich.AlbumSimplified, error) {
+	r := []immich.AlbumSimplified{}
+	for name, ids := range s.albums {
+		for _, a := range ids {
+			if a == id {
+				r = append(r, immich.AlbumSimplified{ID: name, AlbumName: name})
+				break
+			}
+		}
+	}
+	return r, nil
+}
+
+func (s *fakeServer) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	s.deleted = append(s.deleted, ids...)
+	return nil
+}
+
+func (s *fakeServer) StackAssets(ctx context.Context, cover string, ids []string) error {
+	s.stacks[cover] = ids
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	d := immich.ImmichTime{Time: time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)}
+
+	src := newFakeServer()
+	src.assets = []*immich.Asset{
+		{ID: "1", OriginalFileName: "IMG_0001", OriginalPath: "upload/1.jpg", Checksum: "c1", IsFavorite: true, ExifInfo: immich.ExifInfo{DateTimeOriginal: d, FileSizeInByte: 5}},
+		{ID: "2", OriginalFileName: "IMG_0002", OriginalPath: "upload/2.jpg", Checksum: "c2", ExifInfo: immich.ExifInfo{DateTimeOriginal: d, FileSizeInByte: 5}},
+		{ID: "3", OriginalFileName: "IMG_0001", OriginalPath: "upload/3.dng", Checksum: "c3", StackParentID: "1", ExifInfo: immich.ExifInfo{DateTimeOriginal: d, FileSizeInByte: 5}},
+		{ID: "4", OriginalFileName: "IMG_0004", OriginalPath: "upload/4.jpg", Checksum: "c4", IsTrashed: true},
+		{ID: "5", OriginalFileName: "IMG_0005", OriginalPath: "upload/5.jpg", Checksum: "c5", ExifInfo: immich.ExifInfo{DateTimeOriginal: d, FileSizeInByte: 5}},
+		{ID: "6", OriginalFileName: "IMG_0006", OriginalPath: "upload/6.jpg", Checksum: "c6", ExifInfo: immich.ExifInfo{DateTimeOriginal: immich.ImmichTime{Time: time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)}, FileSizeInByte: 3}},
+	}
+	src.content = map[string]string{"1": "one..", "2": "two..", "3": "three", "5": "five.", "6": "six"}
+	src.albums = map[string][]string{"Trip": {"1", "2"}}
+
+	dst := newFakeServer()
+	dst.assets = []*immich.Asset{
+		{ID: "existing", OriginalFileName: "renamed", OriginalPath: "upload/x.jpg", Checksum: "c2"},
+		{ID: "small", OriginalFileName: "IMG_0005", OriginalPath: "upload/y.jpg", Checksum: "c5-small", ExifInfo: immich.ExifInfo{DateTimeOriginal: d, FileSizeInByte: 2}},
+	}
+	dst.albums = map[string][]string{"Kept": {"small"}}
+
+	jnl := logger.NewJournal(&logger.NoLog{})
+	app := MigrateCmd{
+		SharedFlags: &cmd.SharedFlags{Immich: src, Jnl: jnl},
+		Dest:        &cmd.SharedFlags{Immich: dst, Jnl: jnl},
+		Albums:      true,
+		Stacks:      true,
+		fsys:        newRemoteFS(ctx, src),
+		ids:         map[string]string{},
+	}
+
+	err := app.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIDs := map[string]string{"1": "dest-1", "2": "existing", "3": "dest-2", "5": "dest-3", "6": "dest-4"}
+	if !reflect.DeepEqual(app.ids, expectedIDs) {
+		t.Errorf("ids: expected %v, got %v", expectedIDs, app.ids)
+	}
+	if dst.content["dest-1"] != "one.." || dst.content["dest-2"] != "three" {
+		t.Errorf("unexpected content on the destination: %v", dst.content)
+	}
+	if !dst.favorite["dest-1"] {
+		t.Errorf("the favorite flag is lost")
+	}
+	album := dst.albums["Trip"]
+	sort.Strings(album)
+	if !reflect.DeepEqual(album, []string{"dest-1", "existing"}) {
+		t.Errorf("album Trip: got %v", album)
+	}
+	// The smaller copy is replaced
+	if !reflect.DeepEqual(dst.albums["Kept"], []string{"small", "dest-3"}) || !reflect.DeepEqual(dst.deleted, []string{"small"}) {
+		t.Errorf("the smaller copy isn't replaced: album Kept %v, deleted %v", dst.albums["Kept"], dst.deleted)
+	}
+	if !reflect.DeepEqual(dst.stacks, map[string][]string{"dest-1": {"dest-2"}}) {
+		t.Errorf("stacks: got %v", dst.stacks)
+	}
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// remoteFS gives access to the original files of a server's assets.
+// The file names are made of the asset's ID and its original file name: ID/name.ext
+// The files are streamed from the server, nothing is written locally.
+type remoteFS struct {
+	ctx    context.Context
+	ic     immich.ImmichInterface
+	assets map[string]*immich.Asset
+}
+
+func newRemoteFS(ctx context.Context, ic immich.ImmichInterface) *remoteFS {
+	return &remoteFS{
+		ctx:    ctx,
+		ic:     ic,
+		assets: map[string]*immich.Asset{},
+	}
+}
+
+// add an asset to the file system, and return its file name
+func (rfs *remoteFS) add(a *immich.Asset) string {
+	rfs.assets[a.ID] = a
+	return a.ID + "/" + originalFileName(a)
+}
+
+func originalFileName(a *immich.Asset) string {
+	ext := path.Ext(a.OriginalPath)
+	return strings.TrimSuffix(a.OriginalFileName, ext) + ext
+}
+
+func (rfs *remoteFS) Open(name string) (fs.File, error) {
+	id, _, _ := strings.Cut(name, "/")
+	a, ok := rfs.assets[id]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	rc, err := rfs.ic.DownloadAsset(rfs.ctx, id)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &remoteFile{ReadCloser: rc, a: a}, nil
+}
+
+type remoteFile struct {
+	io.ReadCloser
+	a *immich.Asset
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) { return f, nil }
+
+func (f *remoteFile) Name() string       { return originalFileName(f.a) }
+func (f *remoteFile) Size() int64        { return int64(f.a.ExifInfo.FileSizeInByte) }
+func (f *remoteFile) Mode() fs.FileMode  { return 0o444 }
+func (f *remoteFile) ModTime() time.Time { return f.a.FileModifiedAt.Time }
+func (f *remoteFile) IsDir() bool        { return false }
+func (f *remoteFile) Sys() any           { return nil }
@@ -8,49 +8,115 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/simulot/immich-go/helpers/myflag"
 	"github.com/simulot/immich-go/helpers/tzone"
 	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/assetcache"
+	"github.com/simulot/immich-go/immich/replay"
 	"github.com/simulot/immich-go/logger"
 )
 
 // SharedFlags collect all parameters that are common to all commands
 type SharedFlags struct {
-	Server      string // Immich server address (http://<your-ip>:2283/api or https://<your-domain>/api)
-	API         string // Immich api endpoint (http://container_ip:3301)
-	Key         string // API Key
-	DeviceUUID  string // Set a device UUID
-	APITrace    bool   // Enable API call traces
-	NoLogColors bool   // Disable log colors
-	LogLevel    string // Indicate the log level
-	Debug       bool   // Enable the debug mode
-	TimeZone    string // Override default TZ
-	SkipSSL     bool   // Skip SSL Verification
-
-	Immich  immich.ImmichInterface // Immich client
-	Jnl     *logger.Journal        // Program's logger
-	LogFile string                 // Log file
-	out     io.WriteCloser         // the log writer
+	Server       string // Immich server address (http://<your-ip>:2283/api or https://<your-domain>/api)
+	API          string // Immich api endpoint (http://container_ip:3301)
+	Key          string // API Key
+	DeviceUUID   string // Set a device UUID
+	APITrace     bool   // Enable API call traces
+	APIRecord    string // File receiving the exchanges with the server
+	APIReplay    string // File of recorded exchanges served instead of the server's responses
+	AssetCache   bool   // Keep a local copy of the server's assets, refreshed with the changes
+	NoLogColors  bool   // Disable log colors
+	LogLevel     string // Indicate the log level
+	Debug        bool   // Enable the debug mode
+	TimeZone     string // Override default TZ
+	TZBoundaries string // GeoJSON file giving the boundaries of the time zones
+	SkipSSL      bool   // Skip SSL Verification
+	ConfigFile   string // Configuration file
+	Profile      string // Profile of the configuration file
+
+	APIRetries         int           // Number of retries on temporary server errors
+	APIRetriesDelay    time.Duration // Delay before the first retry
+	APIMaxRetriesDelay time.Duration // Maximum delay between retries
+
+	Immich     immich.ImmichInterface // Immich client
+	Jnl        *logger.Journal        // Program's logger
+	LogFile    string                 // Log file
+	ReportJSON string                 // File receiving the fate of each file in JSON
+	ReportCSV  string                 // File receiving the fate of each file in CSV
+	out        io.WriteCloser         // the log writer
+	recorder   *replay.Recorder       // records the exchanges with the server when -api-record is given
+
+	explicit    map[string]bool // flags given on the command line
+	defaultsSet bool            // the default values are set by the first call of SetFlags
 }
 
-// SetFlag add common flags to a flagset
+// SetFlag add common flags to a flagset.
+// The flags are registered again by the subcommands, their current values are the defaults to keep the values given before the subcommand.
 func (app *SharedFlags) SetFlags(fs *flag.FlagSet) {
+	if !app.defaultsSet {
+		app.defaultsSet = true
+		app.APIRetries = 3
+		app.APIRetriesDelay = time.Second
+		app.APIMaxRetriesDelay = 30 * time.Second
+		app.NoLogColors = runtime.GOOS == "windows"
+	}
 	fs.StringVar(&app.Server, "server", app.Server, "Immich server address (http://<your-ip>:2283 or https://<your-domain>)")
-	fs.StringVar(&app.API, "api", "", "Immich api endpoint (http://container_ip:3301)")
+	fs.StringVar(&app.API, "api", app.API, "Immich api endpoint (http://container_ip:3301)")
 	fs.StringVar(&app.Key, "key", app.Key, "API Key")
 	fs.StringVar(&app.DeviceUUID, "device-uuid", app.DeviceUUID, "Set a device UUID")
-	fs.BoolFunc("no-colors-log", "Disable colors on logs", myflag.BoolFlagFn(&app.NoLogColors, runtime.GOOS == "windows"))
+	fs.BoolFunc("no-colors-log", "Disable colors on logs", myflag.BoolFlagFn(&app.NoLogColors, app.NoLogColors))
 	fs.StringVar(&app.LogLevel, "log-level", app.LogLevel, "Log level (Error|Warning|OK|Info), default OK")
 	fs.StringVar(&app.LogFile, "log-file", app.LogFile, "Write log messages into the file")
-	fs.BoolFunc("api-trace", "enable api call traces", myflag.BoolFlagFn(&app.APITrace, false))
-	fs.BoolFunc("debug", "enable debug messages", myflag.BoolFlagFn(&app.Debug, false))
+	fs.BoolFunc("api-trace", "enable api call traces", myflag.BoolFlagFn(&app.APITrace, app.APITrace))
+	fs.StringVar(&app.APIRecord, "api-record", app.APIRecord, "Record the exchanges with the server into the file, the API key and the files' content are left out")
+	fs.StringVar(&app.APIReplay, "api-replay", app.APIReplay, "Replay the exchanges recorded with -api-record instead of calling the server")
+	fs.BoolFunc("asset-cache", "Keep a copy of the list of the server's assets in the user's cache folder, only the changes are fetched at the next runs", myflag.BoolFlagFn(&app.AssetCache, app.AssetCache))
+	fs.BoolFunc("debug", "enable debug messages", myflag.BoolFlagFn(&app.Debug, app.Debug))
 	fs.StringVar(&app.TimeZone, "time-zone", app.TimeZone, "Override the system time zone")
-	fs.BoolFunc("skip-verify-ssl", "Skip SSL verification", myflag.BoolFlagFn(&app.SkipSSL, false))
+	fs.StringVar(&app.TZBoundaries, "time-zone-boundaries", app.TZBoundaries, "GeoJSON file giving the boundaries of the time zones, used to determine the time zone from the GPS coordinates")
+	fs.BoolFunc("skip-verify-ssl", "Skip SSL verification", myflag.BoolFlagFn(&app.SkipSSL, app.SkipSSL))
+	fs.IntVar(&app.APIRetries, "api-retries", app.APIRetries, "Number of retries when the server is temporarily unavailable")
+	fs.DurationVar(&app.APIRetriesDelay, "api-retries-delay", app.APIRetriesDelay, "Delay before the first retry, doubled at each retry")
+	fs.DurationVar(&app.APIMaxRetriesDelay, "api-max-retries-delay", app.APIMaxRetriesDelay, "Maximum delay between retries")
+	fs.StringVar(&app.ReportJSON, "report-json", app.ReportJSON, "Write the fate of each file into a JSON file")
+	fs.StringVar(&app.ReportCSV, "report-csv", app.ReportCSV, "Write the fate of each file into a CSV file")
+	fs.StringVar(&app.ConfigFile, "config", app.ConfigFile, "Configuration file (default: immich-go/config.json in the user's configuration folder)")
+	fs.StringVar(&app.Profile, "profile", app.Profile, "Profile of the configuration file")
+}
+
+// SetDestinationFlags add the flags of a second server to a flagset.
+// The flags are prefixed with "dest-".
+func (app *SharedFlags) SetDestinationFlags(fs *flag.FlagSet) {
+	fs.StringVar(&app.Server, "dest-server", app.Server, "Destination Immich server address (http://<your-ip>:2283 or https://<your-domain>)")
+	fs.StringVar(&app.API, "dest-api", "", "Destination Immich api endpoint (http://container_ip:3301)")
+	fs.StringVar(&app.Key, "dest-key", app.Key, "Destination API Key")
+	fs.StringVar(&app.DeviceUUID, "dest-device-uuid", app.DeviceUUID, "Set a device UUID for the destination server")
+	fs.BoolFunc("dest-skip-verify-ssl", "Skip SSL verification of the destination server", myflag.BoolFlagFn(&app.SkipSSL, false))
+	fs.StringVar(&app.Profile, "dest-profile", "", "Profile of the configuration file giving the destination server")
+}
+
+// Inherit takes the logger and the common settings from other shared flags, but not the connection settings.
+// It is used for a destination server, whose connection flags are registered by SetDestinationFlags.
+func (app *SharedFlags) Inherit(from *SharedFlags) {
+	app.APITrace = from.APITrace
+	app.AssetCache = from.AssetCache
+	app.NoLogColors = from.NoLogColors
+	app.LogLevel = from.LogLevel
+	app.Debug = from.Debug
+	app.TimeZone = from.TimeZone
+	app.TZBoundaries = from.TZBoundaries
+	app.APIRetries = from.APIRetries
+	app.APIRetriesDelay = from.APIRetriesDelay
+	app.APIMaxRetriesDelay = from.APIMaxRetriesDelay
+	app.Jnl = from.Jnl
+	app.out = from.out
 }
 
 func (app *SharedFlags) Start(ctx context.Context) error {
-	var joinedErr, err error
+	var joinedErr error
 	if app.Server != "" {
 		app.Server = strings.TrimSuffix(app.Server, "/")
 	}
@@ -58,6 +124,9 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 		_, err := tzone.SetLocal(app.TimeZone)
 		joinedErr = errors.Join(joinedErr, err)
 	}
+	if app.TZBoundaries != "" {
+		joinedErr = errors.Join(joinedErr, app.loadTZBoundaries())
+	}
 
 	if app.Jnl == nil {
 		app.Jnl = logger.NewJournal(logger.NewLogger(logger.OK, true, false))
@@ -93,6 +162,15 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 
 	// If the client isn't yet initialized
 	if app.Immich == nil {
+		if app.APIReplay != "" {
+			// The recorded responses don't depend on the server and the key
+			if app.Server == "" && app.API == "" {
+				app.Server = "http://replay"
+			}
+			if app.Key == "" {
+				app.Key = "replay"
+			}
+		}
 		switch {
 		case app.Server == "" && app.API == "":
 			joinedErr = errors.Join(joinedErr, errors.New("missing -server, Immich server address (http://<your-ip>:2283 or https://<your-domain>)"))
@@ -104,10 +182,25 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 			return joinedErr
 		}
 
-		app.Immich, err = immich.NewImmichClient(app.Server, app.Key, app.SkipSSL)
+		ic, err := immich.NewImmichClient(app.Server, app.Key, app.SkipSSL)
 		if err != nil {
 			return err
 		}
+		ic.Retries = app.APIRetries
+		ic.RetriesDelay = app.APIRetriesDelay
+		ic.MaxRetriesDelay = app.APIMaxRetriesDelay
+		if app.APIReplay != "" {
+			rp, err := replay.LoadReplayer(app.APIReplay)
+			if err != nil {
+				return err
+			}
+			ic.SetTransport(rp)
+		}
+		if app.APIRecord != "" {
+			app.recorder = replay.NewRecorder(ic.Transport(), "")
+			ic.SetTransport(app.recorder)
+		}
+		app.Immich = ic
 		if app.API != "" {
 			app.Immich.SetEndPoint(app.API)
 		}
@@ -129,6 +222,56 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 			return err
 		}
 		app.Jnl.Log.Info("Connected, user: %s", user.Email)
+
+		if app.AssetCache {
+			server := app.Server
+			if app.API != "" {
+				server = app.API
+			}
+			c, err := assetcache.New(app.Immich, server, user.ID)
+			if err != nil {
+				return err
+			}
+			app.Immich = c
+			app.Jnl.Log.Info("Server's assets cached into %s", c.File())
+		}
 	}
 	return nil
 }
+
+// WriteReports writes the journal into the files given by -report-json and -report-csv
+func (app *SharedFlags) WriteReports() error {
+	var joinedErr error
+	write := func(name string, fn func(io.Writer) error) {
+		if name == "" || app.Jnl == nil {
+			return
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			joinedErr = errors.Join(joinedErr, err)
+			return
+		}
+		joinedErr = errors.Join(joinedErr, fn(f), f.Close())
+	}
+	write(app.ReportJSON, app.Jnl.WriteJSON)
+	write(app.ReportCSV, app.Jnl.WriteCSV)
+	return joinedErr
+}
+
+// SaveAPIRecord writes the exchanges with the server into the file given by -api-record
+func (app *SharedFlags) SaveAPIRecord() error {
+	if app.recorder == nil {
+		return nil
+	}
+	return app.recorder.Save(app.APIRecord)
+}
+
+// loadTZBoundaries reads the boundaries of the time zones
+func (app *SharedFlags) loadTZBoundaries() error {
+	f, err := os.Open(app.TZBoundaries)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tzone.LoadBoundaries(f)
+}
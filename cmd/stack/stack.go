@@ -36,7 +36,7 @@ func initSack(ctx context.Context, common *cmd.SharedFlags, args []string) (*Sta
 		return err
 	})
 	cmd.Var(&app.DateRange, "date", "Process only documents having a capture date in that range.")
-	err := cmd.Parse(args)
+	err := app.SharedFlags.Parse(cmd, args)
 	if err != nil {
 		return nil, err
 	}
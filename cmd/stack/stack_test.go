@@ -0,0 +1,38 @@
+package stack
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+)
+
+func TestStackFakeServer(t *testing.T) {
+	ctx := context.Background()
+	s := fakeimmich.New()
+	defer s.Close()
+
+	d := time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)
+	jpg := s.AddAsset(fakeimmich.Asset{OriginalFileName: "IMG_0001", OriginalPath: "upload/IMG_0001.JPG", DateTimeOriginal: d, Content: []byte("jpg")})
+	raw := s.AddAsset(fakeimmich.Asset{OriginalFileName: "IMG_0001", OriginalPath: "upload/IMG_0001.CR2", DateTimeOriginal: d, Content: []byte("raw")})
+	other := s.AddAsset(fakeimmich.Asset{OriginalFileName: "IMG_0002", OriginalPath: "upload/IMG_0002.JPG", DateTimeOriginal: d, Content: []byte("other")})
+
+	app := cmd.SharedFlags{}
+	err := NewStackCommand(ctx, &app, []string{"-server=" + s.URL, "-key=" + s.Key, "-log-file=" + filepath.Join(t.TempDir(), "stack.log"), "-yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a1, _ := s.Asset(jpg)
+	a2, _ := s.Asset(raw)
+	a3, _ := s.Asset(other)
+	if !(a1.StackParentID == raw && a2.StackParentID == "") && !(a2.StackParentID == jpg && a1.StackParentID == "") {
+		t.Errorf("the JPG and the RAW aren't stacked: %q, %q", a1.StackParentID, a2.StackParentID)
+	}
+	if a3.StackParentID != "" {
+		t.Errorf("the other asset is stacked")
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/immich"
 )
 
 type AssetIndex struct {
+	lock   sync.RWMutex
 	assets []*immich.Asset
 	byHash map[string][]*immich.Asset
 	byName map[string][]*immich.Asset
@@ -17,7 +19,18 @@ type AssetIndex struct {
 	// albums []immich.AlbumSimplified
 }
 
+// NewAssetIndex builds the index of the given server's assets
+func NewAssetIndex(assets []*immich.Asset) *AssetIndex {
+	ai := &AssetIndex{
+		assets: assets,
+	}
+	ai.ReIndex()
+	return ai
+}
+
 func (ai *AssetIndex) ReIndex() {
+	ai.lock.Lock()
+	defer ai.lock.Unlock()
 	ai.byHash = map[string][]*immich.Asset{}
 	ai.byName = map[string][]*immich.Asset{}
 	ai.byID = map[string]*immich.Asset{}
@@ -38,6 +51,8 @@ func (ai *AssetIndex) ReIndex() {
 }
 
 func (ai *AssetIndex) Len() int {
+	ai.lock.RLock()
+	defer ai.lock.RUnlock()
 	return len(ai.assets)
 }
 
@@ -52,11 +67,31 @@ func (ai *AssetIndex) AddLocalAsset(la *browser.LocalAssetFile, immichID string)
 			Latitude:         la.Latitude,
 			Longitude:        la.Longitude,
 		},
-		JustUploaded: true,
+		LocalDateTime: immich.ImmichTime{Time: immich.WallClock(la.DateTaken, la.TimeZone)},
+		Checksum:      la.Checksum,
+		JustUploaded:  true,
+	}
+	if la.TimeZone != nil {
+		sa.ExifInfo.TimeZone = immich.TimeZoneName(la.TimeZone)
 	}
+	ai.lock.Lock()
+	defer ai.lock.Unlock()
 	ai.assets = append(ai.assets, sa)
 	ai.byID[sa.DeviceAssetID] = sa
 	l := ai.byName[sa.OriginalFileName]
 	l = append(l, sa)
 	ai.byName[sa.OriginalFileName] = l
+	if sa.Checksum != "" {
+		ai.byHash[sa.Checksum] = append(ai.byHash[sa.Checksum], sa)
+	}
+}
+
+// ByChecksum returns the asset having the given checksum, if any
+func (ai *AssetIndex) ByChecksum(checksum string) *immich.Asset {
+	ai.lock.RLock()
+	defer ai.lock.RUnlock()
+	if l := ai.byHash[checksum]; len(l) > 0 {
+		return l[0]
+	}
+	return nil
 }
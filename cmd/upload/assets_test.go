@@ -0,0 +1,98 @@
+package upload
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/tzone"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestCompareDate(t *testing.T) {
+	t.Setenv("TZ", "Europe/Paris")
+	// The local time zone is determined once for all tests, the local dates are given in that zone
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Captured at 8:30 in New York, the server knows the time zone
+	var withTZ immich.Asset
+	err = json.Unmarshal([]byte(`{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T12:30:00.000Z","timeZone":"America/New_York"}}`), &withTZ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server has read the date without time zone, and has placed it in UTC
+	var withoutTZ immich.Asset
+	err = json.Unmarshal([]byte(`{"localDateTime":"2023-10-06T08:30:00.000Z","exifInfo":{"dateTimeOriginal":"2023-10-06T08:30:00.000Z"}}`), &withoutTZ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An old server, that doesn't give the local date time
+	var oldServer immich.Asset
+	err = json.Unmarshal([]byte(`{"exifInfo":{"dateTimeOriginal":"2023-10-06T06:30:00.000Z","timeZone":"UTC+2"}}`), &oldServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYork := time.FixedZone("", -4*3600)
+	paris, _ := time.LoadLocation("Europe/Paris")
+	tests := []struct {
+		name string
+		la   browser.LocalAssetFile
+		sa   *immich.Asset
+		want int
+	}{
+		{
+			name: "both time zones known",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, newYork), TimeZone: newYork},
+			sa:   &withTZ,
+			want: 0,
+		},
+		{
+			name: "both time zones known, different instants",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, paris), TimeZone: paris},
+			sa:   &withTZ,
+			want: -1,
+		},
+		{
+			name: "no time zone locally",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, local)},
+			sa:   &withTZ,
+			want: 0,
+		},
+		{
+			name: "no time zone on the server",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, newYork), TimeZone: newYork},
+			sa:   &withoutTZ,
+			want: 0,
+		},
+		{
+			name: "within the tolerance",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 33, 0, 0, local)},
+			sa:   &withoutTZ,
+			want: 0,
+		},
+		{
+			name: "later",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 9, 30, 0, 0, local)},
+			sa:   &withoutTZ,
+			want: +1,
+		},
+		{
+			name: "server without local date time",
+			la:   browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, local)},
+			sa:   &oldServer,
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareDate(&tt.la, tt.sa); got != tt.want {
+				t.Errorf("compareDate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package upload
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+)
+
+// TestUploadFakeServer runs the upload command against the fake immich server, through the actual client
+func TestUploadFakeServer(t *testing.T) {
+	ctx := context.Background()
+	s := fakeimmich.New()
+	defer s.Close()
+
+	run := func(args ...string) {
+		t.Helper()
+		app := cmd.SharedFlags{}
+		args = append([]string{"-server=" + s.URL, "-key=" + s.Key, "-log-file=" + filepath.Join(t.TempDir(), "upload.log"), "-api-retries-delay=1ms"}, args...)
+		err := UploadCommand(ctx, &app, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("-album=the album", "TEST_DATA/folder/high")
+
+	names := []string{}
+	for _, a := range s.Assets() {
+		names = append(names, a.OriginalFileName)
+	}
+	sort.Strings(names)
+	want := []string{
+		"PXL_20231006_063000139",
+		"PXL_20231006_063029647",
+		"PXL_20231006_063108407",
+		"PXL_20231006_063121958",
+		"PXL_20231006_063357420",
+		"PXL_20231006_063528961",
+		"PXL_20231006_063536303",
+		"PXL_20231006_063851485",
+	}
+	if !cmpSlices(names, want) {
+		t.Fatalf("uploaded assets: %v, want %v", names, want)
+	}
+	albums := s.Albums()
+	if len(albums) != 1 || albums[0].Name != "the album" || len(albums[0].AssetIDs) != len(want) {
+		t.Fatalf("unexpected albums: %v", albums)
+	}
+
+	// The second run finds the assets on the server, despite a temporary failure
+	uploads := s.Calls(http.MethodPost, "/asset/upload")
+	s.FailNext(http.MethodPost, "/search/metadata", http.StatusServiceUnavailable, 1)
+	run("-album=the album", "TEST_DATA/folder/high")
+	if n := s.Calls(http.MethodPost, "/asset/upload"); n != uploads {
+		t.Errorf("the assets have been uploaded again: %d uploads, want %d", n, uploads)
+	}
+	if n := len(s.Assets()); n != len(want) {
+		t.Errorf("unexpected number of assets: %d", n)
+	}
+	if albums = s.Albums(); len(albums) != 1 {
+		t.Errorf("unexpected albums: %v", albums)
+	}
+}
+
+// TestUploadTags tags the uploaded assets on the fake immich server
+func TestUploadTags(t *testing.T) {
+	ctx := context.Background()
+	s := fakeimmich.New()
+	defer s.Close()
+
+	run := func(args ...string) {
+		t.Helper()
+		app := cmd.SharedFlags{}
+		args = append([]string{"-server=" + s.URL, "-key=" + s.Key, "-log-file=" + filepath.Join(t.TempDir(), "upload.log")}, args...)
+		err := UploadCommand(ctx, &app, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tagged := func() map[string]int {
+		m := map[string]int{}
+		for _, tg := range s.Tags() {
+			m[tg.Value] = len(tg.AssetIDs)
+		}
+		return m
+	}
+
+	run("-tag=Imported/Test , Run", "-tags-from-folders", "TEST_DATA/folder/high")
+	want := map[string]int{"Imported": 0, "Imported/Test": 8, "Run": 8, "AlbumA": 5, "AlbumB": 3}
+	if got := tagged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags: %v, want %v", got, want)
+	}
+
+	// The assets already on the server are tagged too
+	run("-google-photos", "-tags-from-albums", "-create-albums=false", "TEST_DATA/Takeout1")
+	want["Album test 6-10-23"] = 8 // from the title Album test 6/10/23
+	if got := tagged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags: %v, want %v", got, want)
+	}
+}
+
+// TestUploadForceSidecar checks the sidecars generated with -force-sidecar, and the updates of the assets already on the server
+func TestUploadForceSidecar(t *testing.T) {
+	ctx := context.Background()
+	s := fakeimmich.New()
+	defer s.Close()
+
+	run := func(args ...string) {
+		t.Helper()
+		app := cmd.SharedFlags{}
+		args = append([]string{"-server=" + s.URL, "-key=" + s.Key, "-log-file=" + filepath.Join(t.TempDir(), "upload.log")}, args...)
+		err := UploadCommand(ctx, &app, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("-google-photos", "-force-sidecar", "TEST_DATA/Takeout1")
+	for _, a := range s.Assets() {
+		if !strings.Contains(string(a.Sidecar), "<dc:title>") || !strings.Contains(string(a.Sidecar), "GPSLatitude") {
+			t.Errorf("the sidecar of %s doesn't give the title and the location:\n%s", a.OriginalFileName, a.Sidecar)
+		}
+	}
+
+	// The assets already on the server get no sidecar, they are updated
+	s = fakeimmich.New()
+	defer s.Close()
+	run("TEST_DATA/folder/high")
+	run("-google-photos", "-force-sidecar", "TEST_DATA/Takeout1")
+	for _, a := range s.Assets() {
+		if a.Sidecar != nil || a.OriginalFileName == "PXL_20231006_063528961" {
+			// uploaded by the second run, or not in the takeout
+			continue
+		}
+		if a.Latitude == 0 || a.Longitude == 0 {
+			t.Errorf("the location of %s isn't updated", a.OriginalFileName)
+		}
+	}
+}
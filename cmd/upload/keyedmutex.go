@@ -0,0 +1,41 @@
+package upload
+
+import "sync"
+
+// keyedMutex serializes the goroutines working on the same key.
+// It prevents concurrent workers to upload the same asset twice.
+type keyedMutex struct {
+	mut   sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	waiters int
+}
+
+func (km *keyedMutex) Lock(key string) {
+	km.mut.Lock()
+	if km.locks == nil {
+		km.locks = map[string]*keyedLock{}
+	}
+	l := km.locks[key]
+	if l == nil {
+		l = &keyedLock{}
+		km.locks[key] = l
+	}
+	l.waiters++
+	km.mut.Unlock()
+	l.Lock()
+}
+
+func (km *keyedMutex) Unlock(key string) {
+	km.mut.Lock()
+	l := km.locks[key]
+	l.waiters--
+	if l.waiters == 0 {
+		delete(km.locks, key)
+	}
+	km.mut.Unlock()
+	l.Unlock()
+}
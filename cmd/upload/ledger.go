@@ -0,0 +1,206 @@
+package upload
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/logger"
+)
+
+// Ledger keeps track of the files handled by the upload command.
+//
+// The ledger is an append only file with one JSON entry per line. The last entry of a key wins.
+// Each entry is written as soon as the file is handled, so an interrupted run can be resumed
+// without asking the server again what to do with the files already handled.
+//
+// Albums, tags and stacks are created at the end of the run. Entries are marked as done
+// once they are created. The entries not done are replayed by the next resumed run.
+
+type Ledger struct {
+	mut     sync.Mutex
+	name    string
+	f       *os.File
+	entries map[string]LedgerEntry
+}
+
+type LedgerEntry struct {
+	Key       string        `json:"key"`              // source file system + path + size + modification date
+	ID        string        `json:"id,omitempty"`     // server's asset ID
+	Action    logger.Action `json:"action"`           // outcome of the upload
+	FileName  string        `json:"fileName"`         // source file name
+	DateTaken time.Time     `json:"dateTaken"`        // capture date, needed to rebuild stacks
+	Albums    []string      `json:"albums,omitempty"` // albums to be updated with the asset
+	Tags      []string      `json:"tags,omitempty"`   // tags to be given to the asset
+	Stack     bool          `json:"stack,omitempty"`  // the asset is a candidate for stacks
+	Done      bool          `json:"done,omitempty"`   // albums, tags and stacks are created
+}
+
+// LedgerKey returns the key of the local file in the ledger.
+// The file system is named like in the reports: the same path can be found in several sources.
+func LedgerKey(a *browser.LocalAssetFile) string {
+	return fmt.Sprintf("%s|%s|%d|%d", logger.FSName(a.FSys), a.FileName, a.FileSize, a.FileDate.Unix())
+}
+
+// DefaultLedgerName gives a ledger file name in the user's cache folder.
+// The name depends on the server, the API key and the sources given on the command line.
+func DefaultLedgerName(server, key string, sources []string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs := make([]string, 0, len(sources))
+	for _, s := range sources {
+		a, err := filepath.Abs(s)
+		if err != nil {
+			a = s
+		}
+		abs = append(abs, a)
+	}
+	sort.Strings(abs)
+	h := sha1.New()
+	h.Write([]byte(server + "|" + key + "|" + strings.Join(abs, "|")))
+	return filepath.Join(dir, "immich-go", "ledger-"+hex.EncodeToString(h.Sum(nil))[:16]+".jsonl"), nil
+}
+
+// OpenLedger reads the ledger file when it exists, and opens it for appending new entries
+func OpenLedger(name string) (*Ledger, error) {
+	l := Ledger{
+		name:    name,
+		entries: map[string]LedgerEntry{},
+	}
+	err := os.MkdirAll(filepath.Dir(name), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	err = l.read()
+	if err != nil {
+		return nil, err
+	}
+	l.f, err = os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (l *Ledger) read() error {
+	f, err := os.Open(l.name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var e LedgerEntry
+		// A partial line can be found after a crash, just ignore it
+		if json.Unmarshal(s.Bytes(), &e) != nil || e.Key == "" {
+			continue
+		}
+		l.entries[e.Key] = e
+	}
+	return s.Err()
+}
+
+// Name of the ledger file
+func (l *Ledger) Name() string {
+	return l.name
+}
+
+// Len gives the number of entries in the ledger
+func (l *Ledger) Len() int {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return len(l.entries)
+}
+
+// Get the entry for the given key
+func (l *Ledger) Get(key string) (LedgerEntry, bool) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	e, ok := l.entries[key]
+	return e, ok
+}
+
+// Record writes the entry in the ledger
+func (l *Ledger) Record(e LedgerEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.entries[e.Key] = e
+	_, err = l.f.Write(append(b, '\n'))
+	return err
+}
+
+// Commit marks all entries as done and compacts the ledger file
+func (l *Ledger) Commit() error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	keys := make([]string, 0, len(l.entries))
+	for k := range l.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.name), filepath.Base(l.name)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, k := range keys {
+		e := l.entries[k]
+		e.Done = true
+		l.entries[k] = e
+		err = errors.Join(err, enc.Encode(e))
+	}
+	err = errors.Join(err, w.Flush(), tmp.Close())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	err = l.f.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	err = os.Rename(tmp.Name(), l.name)
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	var err2 error
+	l.f, err2 = os.OpenFile(l.name, os.O_APPEND|os.O_WRONLY, 0o600)
+	return errors.Join(err, err2)
+}
+
+// Close the ledger file
+func (l *Ledger) Close() error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
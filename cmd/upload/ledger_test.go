@@ -0,0 +1,163 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestLedger(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sub", "ledger.jsonl")
+
+	l, err := OpenLedger(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []LedgerEntry{
+		{Key: "a", ID: "1", Action: logger.Uploaded},
+		{Key: "b", ID: "2", Action: logger.Uploaded, Albums: []string{"album"}},
+		{Key: "a", ID: "3", Action: logger.Upgraded},
+	} {
+		if err = l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of a line
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"key":"c","id":`)
+	f.Close()
+
+	l, err = OpenLedger(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", l.Len())
+	}
+	e, ok := l.Get("a")
+	if !ok || e.ID != "3" || e.Action != logger.Upgraded || e.Done {
+		t.Errorf("unexpected entry for a: %# v", pretty.Formatter(e))
+	}
+
+	if err = l.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Record(LedgerEntry{Key: "d", ID: "4", Action: logger.Uploaded}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = OpenLedger(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for k, done := range map[string]bool{"a": true, "b": true, "d": false} {
+		e, ok := l.Get(k)
+		if !ok {
+			t.Errorf("entry %s not found", k)
+			continue
+		}
+		if e.Done != done {
+			t.Errorf("entry %s: expected done=%v", k, done)
+		}
+	}
+}
+
+func TestUploadResume(t *testing.T) {
+	ctx := context.Background()
+	ledger := filepath.Join(t.TempDir(), "ledger.jsonl")
+	args := []string{"-resume", "-ledger=" + ledger, "-album=the album", "TEST_DATA/folder/high"}
+
+	run := func() *icCatchUploadsAssets {
+		ic := &icCatchUploadsAssets{
+			albums: map[string][]string{},
+		}
+		serv := cmd.SharedFlags{
+			Immich: ic,
+			Jnl:    logger.NewJournal(&logger.NoLog{}),
+		}
+		app, err := NewUpCmd(ctx, &serv, args)
+		if err != nil {
+			t.Fatalf("can't instantiate the UploadCmd: %s", err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ic
+	}
+
+	ic := run()
+	if len(ic.assets) != 8 || len(ic.albums["the album"]) != 8 {
+		t.Fatalf("first run: unexpected uploads %d, album %d", len(ic.assets), len(ic.albums["the album"]))
+	}
+
+	// Second run: nothing to do, the server's assets aren't needed
+	ic = run()
+	if len(ic.assets) != 0 || len(ic.albums) != 0 {
+		t.Errorf("second run: unexpected uploads %v, albums %v", ic.assets, ic.albums)
+	}
+	if ic.indexed != 0 {
+		t.Errorf("second run: the server's assets are requested")
+	}
+
+	// Simulate an interruption before the album creation
+	l, err := OpenLedger(ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _ := l.Get(findKey(l, "AlbumA/PXL_20231006_063000139.jpg"))
+	e.Done = false
+	if err = l.Record(e); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	ic = run()
+	if len(ic.assets) != 0 {
+		t.Errorf("third run: unexpected uploads %v", ic.assets)
+	}
+	expected := map[string][]string{"the album": {"AlbumA/PXL_20231006_063000139.jpg"}}
+	if !cmpAlbums(expected, ic.albums) {
+		t.Errorf("third run: expected albums differs")
+		pretty.Ldiff(t, expected, ic.albums)
+	}
+}
+
+func TestLedgerKey(t *testing.T) {
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	a := &browser.LocalAssetFile{FSys: os.DirFS("source1"), FileName: "photos/IMG_0001.jpg", FileSize: 100, FileDate: date}
+	b := &browser.LocalAssetFile{FSys: os.DirFS("source2"), FileName: "photos/IMG_0001.jpg", FileSize: 100, FileDate: date}
+	if LedgerKey(a) == LedgerKey(b) {
+		t.Errorf("the files of two sources have the same key %s", LedgerKey(a))
+	}
+	c := *a
+	c.FSys = os.DirFS("source1")
+	if LedgerKey(a) != LedgerKey(&c) {
+		t.Errorf("the key of the same file differs: %s, %s", LedgerKey(a), LedgerKey(&c))
+	}
+}
+
+func findKey(l *Ledger, fileName string) string {
+	for k, e := range l.entries {
+		if e.FileName == fileName {
+			return k
+		}
+	}
+	return ""
+}
@@ -4,13 +4,18 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"math"
+	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,8 +25,10 @@ import (
 	"github.com/simulot/immich-go/cmd"
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/geotag"
 	"github.com/simulot/immich-go/helpers/myflag"
 	"github.com/simulot/immich-go/helpers/stacking"
+	"github.com/simulot/immich-go/helpers/tzone"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/immich/metadata"
 	"github.com/simulot/immich-go/logger"
@@ -47,6 +54,10 @@ type UpCmd struct {
 	KeepPartner            bool             // Import partner's assets
 	KeepUntitled           bool             // Keep untitled albums
 	UseFolderAsAlbumName   bool             // Use folder's name instead of metadata's title as Album name
+	Tags                   StringList       // Tags given to all assets, like Holidays/2024
+	TagsFromFolders        bool             // Tag the assets with the path of their folder
+	TagsFromKeywords       bool             // Tag the assets with their XMP or IPTC keywords
+	TagsFromAlbums         bool             // Tag the assets with the names of their albums
 	DryRun                 bool             // Display actions but don't change anything
 	ForceSidecar           bool             // Generate a sidecar file for each file (default: TRUE)
 	CreateStacks           bool             // Stack jpg/raw/burst (Default: TRUE)
@@ -54,16 +65,47 @@ type UpCmd struct {
 	StackBurst             bool             // Stack burst (Default: TRUE)
 	DiscardArchived        bool             // Don't import archived assets (Default: FALSE)
 	WhenNoDate             string           // When the date can't be determined use the FILE's date or NOW (default: FILE)
+	TimeZoneFromGPS        bool             // Determine the time zone of the capture from the GPS coordinates when the file doesn't give it
+	Geotag                 StringList       // GPX or KML tracks giving the position of the assets without GPS coordinates
+	GeotagMaxGap           time.Duration    // Maximum delay between the capture and the points of the tracks
+	GeotagOffset           time.Duration    // Added to the camera's time to match the time of the tracks
+	Resume                 bool             // Skip files handled by a previous run (default: FALSE)
+	LedgerFile             string           // Ledger file used to resume an interrupted upload
+	Concurrency            int              // Number of concurrent uploads (default: 1)
+	UseChecksum            bool             // Compare the file's checksum with server's ones before uploading (default: TRUE)
+	Watch                  bool             // Keep running and upload new files of the folders (default: FALSE)
+	WatchStability         time.Duration    // A new file is uploaded once unchanged during this delay
+	WatchPoll              bool             // Poll the folders instead of using the system's notifications (default: FALSE)
+	WatchPollInterval      time.Duration    // Delay between two scans of polled folders
 
 	BrowserConfig Configuration
 
+	watchFolders []string // folders watched by -watch
+
 	AssetIndex       *AssetIndex               // List of assets present on the server
+	indexOnce        sync.Once                 // the server's assets are fetched once
+	indexErr         error                     // error while fetching the server's assets
+	mut              sync.Mutex                // protect the following fields against concurrent workers
 	deleteServerList []*immich.Asset           // List of server assets to remove
 	deleteLocalList  []*browser.LocalAssetFile // List of local assets to remove
 	mediaUploaded    int                       // Count uploaded medias
 	mediaCount       int                       // Count of media on the source
 	updateAlbums     map[string]map[string]any // track immich albums changes
+	assetAlbums      map[string][]string       // albums to be updated, by asset ID
+	updateTags       map[string]map[string]any // assets to be tagged, by tag
+	assetTags        map[string][]string       // tags to be given, by asset ID
+	stackCandidates  []stackCandidate          // uploaded assets to be examined by the stack builder
 	stacks           *stacking.StackBuilder
+	ledger           *Ledger                           // files handled by previous runs
+	tracks           *geotag.Tracks                    // tracks used to geotag the assets
+	nameLocks        keyedMutex                        // serialize the handling of assets with the same name
+	checked          map[string]immich.BulkCheckResult // server's answers for the checksums checked by batches
+}
+
+type stackCandidate struct {
+	id        string
+	fileName  string
+	dateTaken time.Time
 }
 
 func NewUpCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*UpCmd, error) {
@@ -73,6 +115,10 @@ func NewUpCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*UpC
 	app := UpCmd{
 		SharedFlags:  common,
 		updateAlbums: map[string]map[string]any{},
+		assetAlbums:  map[string][]string{},
+		updateTags:   map[string]map[string]any{},
+		assetTags:    map[string][]string{},
+		checked:      map[string]immich.BulkCheckResult{},
 	}
 
 	app.SharedFlags.SetFlags(cmd)
@@ -124,6 +170,22 @@ func NewUpCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*UpC
 		"use-album-folder-as-name",
 		" google-photos only: Use folder name and ignore albums' title (default:FALSE)", myflag.BoolFlagFn(&app.UseFolderAsAlbumName, false))
 
+	cmd.Var(&app.Tags,
+		"tag",
+		"Tag all assets with these tags, separated by a comma. Use / for the levels of the tags, like Holidays/2024")
+	cmd.BoolFunc(
+		"tags-from-folders",
+		"Tag the assets with the path of their folder, like Holidays/2024/Paris (default: FALSE)",
+		myflag.BoolFlagFn(&app.TagsFromFolders, false))
+	cmd.BoolFunc(
+		"tags-from-keywords",
+		"Tag the assets with the keywords of their XMP sidecar, or their XMP or IPTC metadata (default: FALSE)",
+		myflag.BoolFlagFn(&app.TagsFromKeywords, false))
+	cmd.BoolFunc(
+		"tags-from-albums",
+		" google-photos only: Tag the assets with the names of their albums (default: FALSE)",
+		myflag.BoolFlagFn(&app.TagsFromAlbums, false))
+
 	cmd.BoolFunc(
 		"discard-archived",
 		" google-photos only: Do not import archived photos (default FALSE)", myflag.BoolFlagFn(&app.DiscardArchived, false))
@@ -148,11 +210,69 @@ func NewUpCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*UpC
 		"when-no-date",
 		"FILE",
 		" When the date of take can't be determined, use the FILE's date or the current time NOW. (default: FILE)")
-	err = cmd.Parse(args)
+
+	cmd.BoolFunc(
+		"time-zone-from-gps",
+		"Determine the time zone of the capture from the GPS coordinates when the file doesn't give it, estimated near the borders without -time-zone-boundaries (default: FALSE)",
+		myflag.BoolFlagFn(&app.TimeZoneFromGPS, false))
+
+	cmd.Var(&app.Geotag,
+		"geotag",
+		"GPX or KML tracks, separated by a comma, giving the position of the assets without GPS coordinates")
+	cmd.DurationVar(&app.GeotagMaxGap,
+		"geotag-max-gap",
+		10*time.Minute,
+		" geotag only: Maximum delay between the capture and the points of the tracks")
+	cmd.DurationVar(&app.GeotagOffset,
+		"geotag-offset",
+		0,
+		" geotag only: Added to the camera's time to match the time of the tracks, when the camera's clock is wrong")
+
+	cmd.BoolFunc(
+		"resume",
+		"Skip the files handled by a previous run, and finish its albums and stacks (default: FALSE)",
+		myflag.BoolFlagFn(&app.Resume, false))
+	cmd.StringVar(&app.LedgerFile,
+		"ledger",
+		"",
+		"Ledger file used by -resume (default: a file in the user's cache folder, specific to the server and the sources)")
+
+	cmd.BoolFunc(
+		"checksum",
+		"Compute the SHA-1 of new files to detect those already on the server under another name or date (default: TRUE)",
+		myflag.BoolFlagFn(&app.UseChecksum, true))
+
+	cmd.IntVar(&app.Concurrency,
+		"concurrency",
+		1,
+		"Number of files uploaded in parallel (default: 1)")
+
+	cmd.BoolFunc(
+		"watch",
+		"Keep running and upload the files added to the folders (default: FALSE)",
+		myflag.BoolFlagFn(&app.Watch, false))
+	cmd.DurationVar(&app.WatchStability,
+		"watch-stability",
+		10*time.Second,
+		" watch only: Upload a new file once its size hasn't changed during this delay")
+	cmd.BoolFunc(
+		"watch-poll",
+		" watch only: Scan the folders periodically instead of using the system's notifications. Network mounts are always scanned (default: FALSE)",
+		myflag.BoolFlagFn(&app.WatchPoll, false))
+	cmd.DurationVar(&app.WatchPollInterval,
+		"watch-poll-interval",
+		30*time.Second,
+		" watch only: Delay between two scans of the folders")
+
+	err = app.SharedFlags.Parse(cmd, args)
 	if err != nil {
 		return nil, err
 	}
 
+	if app.Concurrency < 1 {
+		return nil, fmt.Errorf("the -concurrency value must be 1 or more")
+	}
+
 	app.WhenNoDate = strings.ToUpper(app.WhenNoDate)
 	switch app.WhenNoDate {
 	case "FILE", "NOW":
@@ -160,6 +280,18 @@ func NewUpCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*UpC
 		return nil, fmt.Errorf("the -when-no-date accepts FILE or NOW")
 	}
 
+	if app.Watch {
+		if app.GooglePhotos {
+			return nil, fmt.Errorf("the -watch option can't be used with -google-photos")
+		}
+		for _, f := range cmd.Args() {
+			if s, err := os.Stat(f); err != nil || !s.IsDir() {
+				return nil, fmt.Errorf("the -watch option needs folders, %q isn't a folder", f)
+			}
+		}
+		app.watchFolders = cmd.Args()
+	}
+
 	app.BrowserConfig.Validate()
 
 	err = app.SharedFlags.Start(ctx)
@@ -175,44 +307,94 @@ func NewUpCmd(ctx context.Context, common *cmd.SharedFlags, args []string) (*UpC
 	if app.CreateStacks || app.StackBurst || app.StackJpgRaws {
 		app.stacks = stacking.NewStackBuilder(app.Immich.SupportedMedia())
 	}
-	app.Jnl.Log.OK("Ask for server's assets...")
-	var list []*immich.Asset
-	err = app.Immich.GetAllAssetsWithFilter(ctx, func(a *immich.Asset) {
-		if a.IsTrashed {
-			return
+
+	if len(app.Geotag) > 0 {
+		app.tracks = geotag.NewTracks(app.GeotagMaxGap, app.GeotagOffset)
+		for _, f := range app.Geotag {
+			err = app.tracks.Load(f)
+			if err != nil {
+				return nil, err
+			}
 		}
-		list = append(list, a)
-	})
-	if err != nil {
-		return nil, err
+		app.Jnl.Log.OK("%d point(s) read from the tracks", app.tracks.Len())
 	}
-	app.Jnl.Log.OK("%d asset(s) received", len(list))
 
-	app.AssetIndex = &AssetIndex{
-		assets: list,
+	if app.TimeZoneFromGPS && !tzone.HasBoundaries() {
+		app.Jnl.Log.Warning("Without -time-zone-boundaries, the time zones of the locations are estimated: they can be wrong near the borders")
+	}
+	if app.Resume && app.DryRun {
+		app.Jnl.Log.Warning("The -resume option is ignored in dry run mode")
+	}
+	if app.Resume && !app.DryRun {
+		if app.LedgerFile == "" {
+			app.LedgerFile, err = DefaultLedgerName(app.Server, app.Key, cmd.Args())
+			if err != nil {
+				return nil, err
+			}
+		}
+		app.ledger, err = OpenLedger(app.LedgerFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't open the ledger: %w", err)
+		}
+		app.Jnl.Log.OK("Resume using the ledger %s (%d file(s) already handled)", app.ledger.Name(), app.ledger.Len())
+	}
+	// A resumed run asks for the server's assets when it meets a file that isn't in the ledger
+	if app.ledger == nil || app.ledger.Len() == 0 {
+		err = app.loadAssetIndex(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
-
-	app.AssetIndex.ReIndex()
-
 	return &app, err
 }
 
+// loadAssetIndex gets the server's assets, once
+func (app *UpCmd) loadAssetIndex(ctx context.Context) error {
+	app.indexOnce.Do(func() {
+		if app.AssetIndex != nil {
+			return
+		}
+		app.Jnl.Log.OK("Ask for server's assets...")
+		var list []*immich.Asset
+		app.indexErr = app.Immich.GetAllAssetsWithFilter(ctx, func(a *immich.Asset) {
+			if a.IsTrashed {
+				return
+			}
+			list = append(list, a)
+		})
+		if app.indexErr != nil {
+			return
+		}
+		app.Jnl.Log.OK("%d asset(s) received", len(list))
+		app.AssetIndex = NewAssetIndex(list)
+	})
+	return app.indexErr
+}
+
 func UploadCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
 	app, err := NewUpCmd(ctx, common, args)
 	if err != nil {
 		return err
 	}
-	return app.Run(ctx, app.fsys)
+	if app.Watch {
+		return app.RunWatch(ctx, app.watchFolders)
+	}
+	err = app.Run(ctx, app.fsys)
+	return errors.Join(err, fshelper.CloseFSs(app.fsys))
 }
 
 func (app *UpCmd) journalAsset(a *browser.LocalAssetFile, action logger.Action, comment ...string) {
-	app.Jnl.AddEntry(a.FileName, action, comment...)
+	app.Jnl.AddFileEntry(a.FSys, a.FileName, action, comment...)
 }
 
 func (app *UpCmd) Run(ctx context.Context, fsyss []fs.FS) error {
 	var browser browser.Browser
 	var err error
 
+	if app.ledger != nil {
+		defer app.ledger.Close()
+	}
+
 	switch {
 	case app.GooglePhotos:
 		app.Jnl.Log.Message(logger.OK, "Browsing google take out archive...")
@@ -228,29 +410,106 @@ func (app *UpCmd) Run(ctx context.Context, fsyss []fs.FS) error {
 	}
 	app.Jnl.Log.Message(logger.OK, "Done.")
 
-	assetChan := browser.Browse(ctx)
-assetLoop:
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
+	app.handleAssets(ctx, browser.Browse(ctx))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	err = app.finish(ctx)
+	app.Jnl.Report()
+	return err
+}
 
-		case a, ok := <-assetChan:
-			if !ok {
-				break assetLoop
-			}
-			if a.Err != nil {
-				app.journalAsset(a, logger.ERROR, a.Err.Error())
-			} else {
-				err = app.handleAsset(ctx, a)
-				if err != nil {
-					app.journalAsset(a, logger.ERROR, err.Error())
+// RunWatch uploads the files of the folders, then the files added later, until the context is cancelled.
+// Albums and stacks are updated after each batch of new files.
+func (app *UpCmd) RunWatch(ctx context.Context, folders []string) error {
+	if app.ledger != nil {
+		defer app.ledger.Close()
+	}
+	b, err := files.NewLocalFiles(ctx, app.Jnl)
+	if err != nil {
+		return err
+	}
+	b.SetSupportedMedia(app.Immich.SupportedMedia())
+	b.SetWhenNoDate(app.WhenNoDate)
+	b.SetTimeZoneFromGPS(app.TimeZoneFromGPS)
+
+	app.Jnl.Log.OK("Watching %s, press Ctrl+C to stop", strings.Join(folders, ", "))
+	batches := b.Watch(ctx, folders, files.WatchOptions{
+		Stability:    app.WatchStability,
+		PollInterval: app.WatchPollInterval,
+		Poll:         app.WatchPoll,
+	})
+	for batch := range batches {
+		app.Jnl.Log.OK("%d new file(s)", len(batch))
+		assetChan := make(chan *browser.LocalAssetFile)
+		go func() {
+			defer close(assetChan)
+			for _, a := range batch {
+				select {
+				case <-ctx.Done():
+					return
+				case assetChan <- a:
 				}
 			}
+		}()
+		app.handleAssets(ctx, assetChan)
+		if ctx.Err() != nil {
+			break
+		}
+		err = app.finish(ctx)
+		if err != nil {
+			app.Jnl.Log.Error(err.Error())
 		}
+		app.resetBatch()
+	}
+	app.Jnl.Report()
+	return nil
+}
+
+// handleAssets handles the assets of the channel with concurrent workers
+func (app *UpCmd) handleAssets(ctx context.Context, assetChan chan *browser.LocalAssetFile) {
+	if app.UseChecksum {
+		assetChan = app.checkChecksums(ctx, assetChan)
+	}
+	wg := sync.WaitGroup{}
+	for w := 0; w < app.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case a, ok := <-assetChan:
+					if !ok {
+						return
+					}
+					if a.Err != nil {
+						app.journalAsset(a, logger.ERROR, a.Err.Error())
+					} else {
+						err := app.handleAsset(ctx, a)
+						if err != nil {
+							app.journalAsset(a, logger.ERROR, err.Error())
+						}
+					}
+				}
+			}
+		}()
 	}
+	wg.Wait()
+}
 
+// finish creates the stacks and the albums, and deletes the replaced assets
+func (app *UpCmd) finish(ctx context.Context) error {
+	var err error
 	if app.CreateStacks {
+		// Feed the stack builder in a predictable order, whatever the order of the uploads
+		sort.Slice(app.stackCandidates, func(i, j int) bool {
+			return app.stackCandidates[i].fileName < app.stackCandidates[j].fileName
+		})
+		for _, c := range app.stackCandidates {
+			app.stacks.ProcessAsset(c.id, c.fileName, c.dateTaken)
+		}
 		stacks := app.stacks.Stacks()
 		if len(stacks) > 0 {
 			app.Jnl.Log.OK("Creating stacks")
@@ -273,11 +532,31 @@ assetLoop:
 		}
 	}
 
+	albumsDone := true
 	if app.CreateAlbums || app.CreateAlbumAfterFolder || (app.KeepPartner && app.PartnerAlbum != "") || app.ImportIntoAlbum != "" {
 		app.Jnl.Log.OK("Managing albums")
 		err = app.ManageAlbums(ctx)
 		if err != nil {
 			app.Jnl.Log.Error(err.Error())
+			albumsDone = false
+			err = nil
+		}
+	}
+
+	if len(app.updateTags) > 0 {
+		app.Jnl.Log.OK("Managing tags")
+		err = app.ManageTags(ctx)
+		if err != nil {
+			app.Jnl.Log.Error(err.Error())
+			albumsDone = false
+			err = nil
+		}
+	}
+
+	if app.ledger != nil && albumsDone {
+		err = app.ledger.Commit()
+		if err != nil {
+			app.Jnl.Log.Error("can't update the ledger: %s", err)
 			err = nil
 		}
 	}
@@ -296,85 +575,90 @@ assetLoop:
 	if len(app.deleteLocalList) > 0 {
 		err = app.DeleteLocalAssets()
 	}
-
-	app.Jnl.Report()
-
 	return err
 }
 
+// resetBatch forgets the albums, stacks and deletions already done by finish
+func (app *UpCmd) resetBatch() {
+	app.updateAlbums = map[string]map[string]any{}
+	app.assetAlbums = map[string][]string{}
+	app.updateTags = map[string]map[string]any{}
+	app.assetTags = map[string][]string{}
+	app.stackCandidates = nil
+	app.deleteServerList = nil
+	app.deleteLocalList = nil
+	app.checked = map[string]immich.BulkCheckResult{}
+	if app.stacks != nil {
+		app.stacks = stacking.NewStackBuilder(app.Immich.SupportedMedia())
+	}
+}
+
 func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) error {
 	const willBeAddedToAlbum = "Will be added to the album: "
 	defer func() {
 		a.Close()
 	}()
+	app.mut.Lock()
 	app.mediaCount++
+	app.mut.Unlock()
 
 	// ext := path.Ext(a.FileName)
 	// if _, err := fshelper.MimeFromExt(ext); err != nil {
 	// 	app.journalAsset(a, logger.NOT_SELECTED, "not recognized extension")
 	// 	return nil
 	// }
-	ext := path.Ext(a.FileName)
-	if app.BrowserConfig.ExcludeExtensions.Exclude(ext) {
-		app.journalAsset(a, logger.NotSelected, "extension excluded")
-		return nil
-	}
-	if !app.BrowserConfig.SelectExtensions.Include(ext) {
-		app.journalAsset(a, logger.NotSelected, "extension not selected")
+	if reason := app.notSelected(a); reason != "" {
+		app.journalAsset(a, logger.NotSelected, reason)
 		return nil
 	}
 
-	if !app.KeepPartner && a.FromPartner {
-		app.journalAsset(a, logger.NotSelected, "partners asset excluded")
-		return nil
-	}
-
-	if !app.KeepTrashed && a.Trashed {
-		app.journalAsset(a, logger.NotSelected, "trashed asset excluded")
-		return nil
-	}
-
-	if app.ImportFromAlbum != "" && !app.isInAlbum(a, app.ImportFromAlbum) {
-		app.journalAsset(a, logger.NotSelected, "asset excluded because not from the required album")
-		return nil
+	if !app.KeepUntitled {
+		a.Albums = gen.Filter(a.Albums, func(i browser.LocalAlbum) bool {
+			return i.Name != ""
+		})
 	}
 
-	if app.DiscardArchived && a.Archived {
-		app.journalAsset(a, logger.NotSelected, "asset excluded because archives are discarded")
-		return nil
-	}
+	app.Jnl.Log.DebugObject("handleAsset: LocalAssetFile=", a)
 
-	if app.DateRange.IsSet() {
-		d := a.DateTaken
-		if d.IsZero() {
-			app.journalAsset(a, logger.NotSelected, "asset excluded because the date of capture is unknown and a date range is given")
-			return nil
-		}
-		if !app.DateRange.InRange(d) {
-			app.journalAsset(a, logger.NotSelected, "asset excluded because the date of capture out of the date range")
+	if app.ledger != nil {
+		if e, ok := app.ledger.Get(LedgerKey(a)); ok {
+			app.resumeAsset(a, e)
 			return nil
 		}
 	}
 
-	if !app.KeepUntitled {
-		a.Albums = gen.Filter(a.Albums, func(i browser.LocalAlbum) bool {
-			return i.Name != ""
-		})
+	err := app.loadAssetIndex(ctx)
+	if err != nil {
+		return err
 	}
 
-	app.Jnl.Log.DebugObject("handleAsset: LocalAssetFile=", a)
+	geotagged := app.geotag(a)
+
+	// Assets with the same name are handled one after the other to detect duplicates
+	name := strings.ToUpper(path.Base(a.Title))
+	app.nameLocks.Lock(name)
+	defer app.nameLocks.Unlock(name)
 
 	advice, err := app.AssetIndex.ShouldUpload(a)
 	if err != nil {
 		return err
 	}
+	if advice.Advice == NotOnServer && app.UseChecksum {
+		advice, err = app.checkContent(ctx, a)
+		if err != nil {
+			return err
+		}
+	}
 
 	var ID string
+	var resp immich.AssetResponse
 	switch advice.Advice {
 	case NotOnServer:
-		ID, err = app.UploadAsset(ctx, a)
+		app.uploadLivePhotoVideo(ctx, a)
+		resp, err = app.UploadAsset(ctx, a)
+		ID = resp.ID
 		if app.Delete && err == nil {
-			app.deleteLocalList = append(app.deleteLocalList, a)
+			app.deleteLocal(a)
 		}
 	case SmallerOnServer:
 		app.journalAsset(a, logger.Upgraded, advice.Message)
@@ -383,14 +667,16 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 			app.journalAsset(a, logger.INFO, willBeAddedToAlbum+al.AlbumName)
 			a.AddAlbum(browser.LocalAlbum{Name: al.AlbumName})
 		}
-		ID, err = app.UploadAsset(ctx, a)
+		app.uploadLivePhotoVideo(ctx, a)
+		resp, err = app.UploadAsset(ctx, a)
+		ID = resp.ID
 		if err != nil {
-			app.deleteServerList = append(app.deleteServerList, advice.ServerAsset)
+			app.deleteServer(advice.ServerAsset)
 			if app.Delete {
-				app.deleteLocalList = append(app.deleteLocalList, a)
+				app.deleteLocal(a)
 			}
 		}
-	case SameOnServer:
+	case SameOnServer, SameContentOnServer:
 		// Set add the server asset into albums determined locally
 		if !advice.ServerAsset.JustUploaded {
 			app.journalAsset(a, logger.ServerDuplicate, advice.Message)
@@ -414,9 +700,10 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		}
 		if !advice.ServerAsset.JustUploaded {
 			if app.Delete {
-				app.deleteLocalList = append(app.deleteLocalList, a)
+				app.deleteLocal(a)
 			}
 		} else {
+			app.recordAsset(a, ID, logger.LocalDuplicate, false)
 			return nil
 		}
 	case BetterOnServer:
@@ -481,21 +768,358 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		}
 	}
 
-	shouldUpdate := a.Description != ""
-	shouldUpdate = shouldUpdate || a.Favorite
-	shouldUpdate = shouldUpdate || a.Longitude != 0 || a.Latitude != 0
-	shouldUpdate = shouldUpdate || a.Archived
+	if tags := app.assetTagValues(a); len(tags) > 0 {
+		app.journalAsset(a, logger.INFO, "Will be tagged with: "+strings.Join(tags, ", "))
+		for _, t := range tags {
+			app.AddToTag(ID, t)
+		}
+	}
+
+	// The sidecar generated with -force-sidecar gives the description and the location to the server,
+	// but only when the file is uploaded
+	sidecarSent := app.ForceSidecar && resp.ID != "" && !resp.Duplicate
+	shouldUpdate := a.Favorite || a.Archived || geotagged
+	if !sidecarSent {
+		shouldUpdate = shouldUpdate || a.Description != ""
+		// The server reads the location from the local files, but not from Google Photos' JSON
+		shouldUpdate = shouldUpdate || app.GooglePhotos && (a.Longitude != 0 || a.Latitude != 0)
+	}
 
 	if !app.DryRun && shouldUpdate {
 		_, err := app.Immich.UpdateAsset(ctx, ID, a)
 		if err != nil {
-			app.Jnl.Log.Error("can't update the asset '%s': ", err)
+			app.Jnl.Log.Warning("can't update the asset %s: %s", a.FileName, err)
 		}
 	}
 
+	var action logger.Action
+	switch advice.Advice {
+	case NotOnServer:
+		action = logger.Uploaded
+		if resp.Duplicate {
+			action = logger.ServerDuplicate
+		}
+	case SmallerOnServer:
+		action = logger.Upgraded
+	case SameOnServer, SameContentOnServer:
+		action = logger.ServerDuplicate
+	case BetterOnServer:
+		action = logger.ServerBetter
+	}
+	app.recordAsset(a, ID, action, resp.ID != "" && !resp.Duplicate)
 	return nil
 }
 
+// geotag sets the position of assets without GPS coordinates from the tracks.
+// The position is given to the server by a generated sidecar, and by an update of the asset.
+func (app *UpCmd) geotag(a *browser.LocalAssetFile) bool {
+	if app.tracks == nil || a.Latitude != 0 || a.Longitude != 0 {
+		return false
+	}
+	p, ok := app.tracks.Locate(a.DateTaken)
+	if !ok {
+		return false
+	}
+	a.Latitude, a.Longitude, a.Altitude = p.Latitude, p.Longitude, p.Elevation
+	if a.SideCar == nil {
+		a.SideCar = &metadata.SideCar{
+			FileName:  a.FileName + ".xmp",
+			DateTaken: a.DateTaken,
+			TimeZone:  a.TimeZone,
+			Latitude:  a.Latitude,
+			Longitude: a.Longitude,
+			Elevation: a.Altitude,
+		}
+	}
+	app.journalAsset(a, logger.Geotagged, fmt.Sprintf("%.6f, %.6f", a.Latitude, a.Longitude))
+	return true
+}
+
+// uploadLivePhotoVideo uploads the video part of a live photo before its image.
+// The image is linked to the video with the video's ID.
+func (app *UpCmd) uploadLivePhotoVideo(ctx context.Context, a *browser.LocalAssetFile) {
+	v := a.LivePhoto
+	if v == nil {
+		return
+	}
+	defer v.Close()
+
+	advice, err := app.AssetIndex.ShouldUpload(v)
+	if err != nil {
+		app.journalAsset(v, logger.ERROR, err.Error())
+		return
+	}
+	var ID string
+	switch advice.Advice {
+	case NotOnServer, SmallerOnServer:
+		var resp immich.AssetResponse
+		if !app.DryRun {
+			resp, err = app.Immich.AssetUpload(ctx, v)
+			if err != nil {
+				app.journalAsset(v, logger.ServerError, err.Error())
+				return
+			}
+		} else {
+			resp.ID = uuid.NewString()
+		}
+		ID = resp.ID
+		if resp.Duplicate {
+			app.journalAsset(v, logger.ServerDuplicate, "already on the server")
+			break
+		}
+		app.journalAsset(v, logger.Uploaded, v.Title)
+		app.AssetIndex.AddLocalAsset(v, ID)
+		app.mut.Lock()
+		app.mediaUploaded += 1
+		app.mut.Unlock()
+	default:
+		ID = advice.ServerAsset.ID
+		app.journalAsset(v, logger.ServerDuplicate, advice.Message)
+	}
+	app.Jnl.SetFileAsset(v.FSys, v.FileName, ID, nil)
+	a.LivePhotoID = ID
+}
+
+// recordAsset writes the outcome of the asset in the journal and the ledger
+func (app *UpCmd) recordAsset(a *browser.LocalAssetFile, ID string, action logger.Action, stack bool) {
+	app.mut.Lock()
+	albums := slices.Clone(app.assetAlbums[ID])
+	tags := slices.Clone(app.assetTags[ID])
+	app.mut.Unlock()
+	app.Jnl.SetFileAsset(a.FSys, a.FileName, ID, albums)
+	if app.ledger == nil {
+		return
+	}
+	err := app.ledger.Record(LedgerEntry{
+		Key:       LedgerKey(a),
+		ID:        ID,
+		Action:    action,
+		FileName:  a.FileName,
+		DateTaken: a.DateTaken,
+		Albums:    albums,
+		Tags:      tags,
+		Stack:     stack,
+	})
+	if err != nil {
+		app.Jnl.Log.Error("can't write the ledger: %s", err)
+	}
+}
+
+// resumeAsset skips an asset handled by a previous run.
+// The albums, the tags and the stacks of the asset are rebuilt when the previous run was interrupted before their creation.
+func (app *UpCmd) resumeAsset(a *browser.LocalAssetFile, e LedgerEntry) {
+	app.journalAsset(a, logger.Resumed, string(e.Action))
+	app.Jnl.SetFileAsset(a.FSys, a.FileName, e.ID, e.Albums)
+	if e.Done || e.ID == "" {
+		return
+	}
+	for _, al := range e.Albums {
+		app.AddToAlbum(e.ID, al)
+	}
+	for _, t := range e.Tags {
+		app.AddToTag(e.ID, t)
+	}
+	if e.Stack && app.CreateStacks {
+		app.stackAsset(e.ID, e.FileName, e.DateTaken)
+	}
+}
+
+// stackAsset keeps the asset for the stack builder
+func (app *UpCmd) stackAsset(id string, fileName string, dateTaken time.Time) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	app.stackCandidates = append(app.stackCandidates, stackCandidate{id: id, fileName: fileName, dateTaken: dateTaken})
+}
+
+func (app *UpCmd) deleteLocal(a *browser.LocalAssetFile) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	app.deleteLocalList = append(app.deleteLocalList, a)
+}
+
+func (app *UpCmd) deleteServer(sa *immich.Asset) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	app.deleteServerList = append(app.deleteServerList, sa)
+}
+
+// checkBatchSize is the number of files whose checksums are checked with one call to the server
+const checkBatchSize = 100
+
+// checkChecksums passes the assets of the channel to the workers by batches of checkBatchSize files,
+// once the checksums of the new files of the batch are checked with the server.
+func (app *UpCmd) checkChecksums(ctx context.Context, in chan *browser.LocalAssetFile) chan *browser.LocalAssetFile {
+	out := make(chan *browser.LocalAssetFile)
+	go func() {
+		defer close(out)
+		batch := []*browser.LocalAssetFile{}
+		flush := func() bool {
+			app.checkBatch(ctx, batch)
+			for _, a := range batch {
+				select {
+				case <-ctx.Done():
+					return false
+				case out <- a:
+				}
+			}
+			batch = batch[:0]
+			return true
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case a, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				batch = append(batch, a)
+				if len(batch) >= checkBatchSize && !flush() {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// checkBatch computes the checksums of the batch's files that are unknown from the server's index,
+// and checks them with a single call to the server.
+// The files are closed once their checksum is computed: they are read again when uploaded.
+func (app *UpCmd) checkBatch(ctx context.Context, batch []*browser.LocalAssetFile) {
+	todo := []*browser.LocalAssetFile{}
+	for _, a := range batch {
+		if a.Err != nil || app.notSelected(a) != "" {
+			continue
+		}
+		if app.ledger != nil {
+			if _, ok := app.ledger.Get(LedgerKey(a)); ok {
+				continue
+			}
+		}
+		if app.loadAssetIndex(ctx) != nil {
+			return
+		}
+		if advice, err := app.AssetIndex.ShouldUpload(a); err == nil && advice.Advice == NotOnServer {
+			todo = append(todo, a)
+		}
+	}
+	if len(todo) == 0 {
+		return
+	}
+
+	work := make(chan *browser.LocalAssetFile)
+	wg := sync.WaitGroup{}
+	for w := 0; w < app.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range work {
+				// A failure is reported when the file is handled
+				_, _ = a.ComputeChecksum()
+				_ = a.Close()
+			}
+		}()
+	}
+	for _, a := range todo {
+		work <- a
+	}
+	close(work)
+	wg.Wait()
+
+	items := []immich.BulkCheckItem{}
+	seen := map[string]bool{}
+	for _, a := range todo {
+		if a.Checksum == "" || seen[a.Checksum] || app.AssetIndex.ByChecksum(a.Checksum) != nil {
+			continue
+		}
+		seen[a.Checksum] = true
+		items = append(items, immich.BulkCheckItem{ID: a.Checksum, Checksum: a.Checksum})
+	}
+	if len(items) == 0 {
+		return
+	}
+	rr, err := app.Immich.CheckBulkUpload(ctx, items)
+	if err != nil {
+		app.Jnl.Log.Warning("can't check the checksums of %d files: %s", len(items), err)
+		return
+	}
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	for _, r := range rr {
+		app.checked[r.ID] = r
+	}
+}
+
+// checkContent compares the checksum of the file with the checksums of the server's assets
+func (app *UpCmd) checkContent(ctx context.Context, a *browser.LocalAssetFile) (*Advice, error) {
+	checksum, err := a.ComputeChecksum()
+	if err != nil {
+		return nil, err
+	}
+	if sa := app.AssetIndex.ByChecksum(checksum); sa != nil {
+		return app.AssetIndex.adviceSameContentOnServer(sa), nil
+	}
+
+	// The asset can be unknown from the index, when trashed or uploaded by another session
+	app.mut.Lock()
+	r, ok := app.checked[checksum]
+	app.mut.Unlock()
+	if !ok {
+		rr, err := app.Immich.CheckBulkUpload(ctx, []immich.BulkCheckItem{{ID: checksum, Checksum: checksum}})
+		if err != nil {
+			app.Jnl.Log.Warning("can't check the checksum of %s: %s", a.FileName, err)
+			return app.AssetIndex.adviceNotOnServer(), nil
+		}
+		if len(rr) > 0 {
+			r = rr[0]
+		}
+	}
+	if r.Action == "reject" && r.Reason == "duplicate" && r.AssetID != "" {
+		return app.AssetIndex.adviceSameContentOnServer(&immich.Asset{ID: r.AssetID, IsTrashed: r.IsTrashed, Checksum: checksum}), nil
+	}
+	return app.AssetIndex.adviceNotOnServer(), nil
+}
+
+// notSelected gives the reason why the options exclude the asset, or an empty string when it's selected
+func (app *UpCmd) notSelected(a *browser.LocalAssetFile) string {
+	ext := path.Ext(a.FileName)
+	if app.BrowserConfig.ExcludeExtensions.Exclude(ext) {
+		return "extension excluded"
+	}
+	if !app.BrowserConfig.SelectExtensions.Include(ext) {
+		return "extension not selected"
+	}
+
+	if !app.KeepPartner && a.FromPartner {
+		return "partners asset excluded"
+	}
+
+	if !app.KeepTrashed && a.Trashed {
+		return "trashed asset excluded"
+	}
+
+	if app.ImportFromAlbum != "" && !app.isInAlbum(a, app.ImportFromAlbum) {
+		return "asset excluded because not from the required album"
+	}
+
+	if app.DiscardArchived && a.Archived {
+		return "asset excluded because archives are discarded"
+	}
+
+	if app.DateRange.IsSet() {
+		d := a.DateTaken
+		if d.IsZero() {
+			return "asset excluded because the date of capture is unknown and a date range is given"
+		}
+		if !app.DateRange.InRange(d) {
+			return "asset excluded because the date of capture out of the date range"
+		}
+	}
+	return ""
+}
+
 func (app *UpCmd) isInAlbum(a *browser.LocalAssetFile, album string) bool {
 	for _, al := range a.Albums {
 		if app.albumName(al) == album {
@@ -507,7 +1131,11 @@ func (app *UpCmd) isInAlbum(a *browser.LocalAssetFile, album string) bool {
 
 func (app *UpCmd) ReadGoogleTakeOut(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
 	app.Delete = false
-	return gp.NewTakeout(ctx, app.Jnl, app.Immich.SupportedMedia(), fsyss...)
+	to, err := gp.NewTakeout(ctx, app.Jnl, app.Immich.SupportedMedia(), fsyss...)
+	if err != nil {
+		return nil, err
+	}
+	return to.SetTimeZoneFromGPS(app.TimeZoneFromGPS), nil
 }
 
 func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
@@ -517,23 +1145,31 @@ func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browse
 	}
 	b.SetSupportedMedia(app.Immich.SupportedMedia())
 	b.SetWhenNoDate(app.WhenNoDate)
+	b.SetTimeZoneFromGPS(app.TimeZoneFromGPS)
 	return b, nil
 }
 
 // UploadAsset upload the asset on the server
 // Add the assets into listed albums
-// return ID of the asset
+// return the server's response
 
-func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (string, error) {
+func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
 	var resp immich.AssetResponse
 	var err error
 	if !app.DryRun {
 		if app.ForceSidecar {
 			sc := metadata.SideCar{}
 			sc.DateTaken = a.DateTaken
+			sc.TimeZone = a.TimeZone
 			sc.Latitude = a.Latitude
 			sc.Longitude = a.Longitude
 			sc.Elevation = a.Altitude
+			if app.GooglePhotos {
+				sc.Title = a.Title
+			}
+			sc.Description = a.Description
+			sc.Rating = a.Rating
+			sc.Keywords = a.Keywords
 			sc.FileName = a.FileName + ".xmp"
 			a.SideCar = &sc
 		}
@@ -544,20 +1180,22 @@ func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (s
 	}
 	if err != nil {
 		app.journalAsset(a, logger.ServerError, err.Error())
-		return "", err
+		return resp, err
 	}
 	if !resp.Duplicate {
 		app.journalAsset(a, logger.Uploaded, a.Title)
 		app.AssetIndex.AddLocalAsset(a, resp.ID)
+		app.mut.Lock()
 		app.mediaUploaded += 1
+		app.mut.Unlock()
 		if app.CreateStacks {
-			app.stacks.ProcessAsset(resp.ID, a.FileName, a.DateTaken)
+			app.stackAsset(resp.ID, a.FileName, a.DateTaken)
 		}
 	} else {
 		app.journalAsset(a, logger.ServerDuplicate, "already on the server")
 	}
 
-	return resp.ID, nil
+	return resp, nil
 }
 
 func (app *UpCmd) albumName(al browser.LocalAlbum) string {
@@ -574,14 +1212,68 @@ func (app *UpCmd) albumName(al browser.LocalAlbum) string {
 }
 
 func (app *UpCmd) AddToAlbum(id string, album string) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
 	l := app.updateAlbums[album]
 	if l == nil {
 		l = map[string]any{}
 	}
+	if _, exists := l[id]; !exists {
+		app.assetAlbums[id] = append(app.assetAlbums[id], album)
+	}
 	l[id] = nil
 	app.updateAlbums[album] = l
 }
 
+// assetTagValues gives the tags of the asset, according to the options
+func (app *UpCmd) assetTagValues(a *browser.LocalAssetFile) []string {
+	values := append([]string{}, app.Tags...)
+	if app.TagsFromFolders {
+		values = append(values, path.Dir(a.FileName))
+	}
+	if app.TagsFromKeywords {
+		values = append(values, a.Keywords...)
+	}
+	if app.TagsFromAlbums {
+		for _, al := range a.Albums {
+			// The album names, like "Trip 6/10/23", aren't paths
+			values = append(values, strings.ReplaceAll(app.albumName(al), "/", "-"))
+		}
+	}
+	tags := []string{}
+	for _, v := range values {
+		if v = cleanTag(v); v != "" && !slices.Contains(tags, v) {
+			tags = append(tags, v)
+		}
+	}
+	return tags
+}
+
+// cleanTag removes the spaces and the empty levels of the tag, like in " Holidays//2024/"
+func cleanTag(v string) string {
+	levels := []string{}
+	for _, l := range strings.Split(v, "/") {
+		if l = strings.TrimSpace(l); l != "" && l != "." {
+			levels = append(levels, l)
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+func (app *UpCmd) AddToTag(id string, tag string) {
+	app.mut.Lock()
+	defer app.mut.Unlock()
+	l := app.updateTags[tag]
+	if l == nil {
+		l = map[string]any{}
+	}
+	if _, exists := l[id]; !exists {
+		app.assetTags[id] = append(app.assetTags[id], tag)
+	}
+	l[id] = nil
+	app.updateTags[tag] = l
+}
+
 func (app *UpCmd) DeleteLocalAssets() error {
 	app.Jnl.Log.OK("%d local assets to delete.", len(app.deleteLocalList))
 
@@ -664,6 +1356,50 @@ func (app *UpCmd) ManageAlbums(ctx context.Context) error {
 	return nil
 }
 
+// ManageTags creates the missing tags with their parents, and tags the assets
+func (app *UpCmd) ManageTags(ctx context.Context) error {
+	values := gen.MapKeys(app.updateTags)
+	sort.Strings(values)
+	if app.DryRun {
+		for _, v := range values {
+			app.Jnl.Log.OK("Tag %d asset(s) with %q skipped - dry run mode", len(app.updateTags[v]), v)
+		}
+		return nil
+	}
+	tags, err := app.Immich.UpsertTags(ctx, values)
+	if err != nil {
+		return fmt.Errorf("can't create the tags on the server: %w", err)
+	}
+	ids := map[string]string{}
+	for _, t := range tags {
+		ids[t.Value] = t.ID
+	}
+	for _, v := range values {
+		id, ok := ids[v]
+		if !ok {
+			app.Jnl.Log.Warning("the server hasn't created the tag %q", v)
+			continue
+		}
+		rr, err := app.Immich.TagAssets(ctx, id, gen.MapKeys(app.updateTags[v]))
+		if err != nil {
+			return fmt.Errorf("can't tag the assets with %q: %w", v, err)
+		}
+		added := 0
+		for _, r := range rr {
+			if r.Success {
+				added++
+			}
+			if !r.Success && r.Error != "duplicate" {
+				app.Jnl.Log.Warning("%s: %s", r.ID, r.Error)
+			}
+		}
+		if added > 0 {
+			app.Jnl.Log.OK("%d asset(s) tagged with %q", added, v)
+		}
+	}
+	return nil
+}
+
 // - - go:generate stringer -type=AdviceCode
 type AdviceCode int
 
@@ -681,6 +1417,8 @@ func (a AdviceCode) String() string {
 		return "SameOnServer"
 	case NotOnServer:
 		return "NotOnServer"
+	case SameContentOnServer:
+		return "SameContentOnServer"
 	}
 	return fmt.Sprintf("advice(%d)", a)
 }
@@ -691,6 +1429,7 @@ const (
 	BetterOnServer
 	SameOnServer
 	NotOnServer
+	SameContentOnServer // identical content under a different name or date
 )
 
 type Advice struct {
@@ -740,6 +1479,21 @@ func (ai *AssetIndex) adviceBetterOnServer(sa *immich.Asset) *Advice {
 	}
 }
 
+func (ai *AssetIndex) adviceSameContentOnServer(sa *immich.Asset) *Advice {
+	msg := fmt.Sprintf("An asset with the same content exists on the server with the name:%q and date:%q. No need to upload.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime))
+	switch {
+	case sa.IsTrashed:
+		msg = "An asset with the same content exists in the server's trash. No need to upload."
+	case sa.OriginalFileName == "":
+		msg = "An asset with the same content exists on the server. No need to upload."
+	}
+	return &Advice{
+		Advice:      SameContentOnServer,
+		Message:     msg,
+		ServerAsset: sa,
+	}
+}
+
 func (ai *AssetIndex) adviceNotOnServer() *Advice {
 	return &Advice{
 		Advice:  NotOnServer,
@@ -753,6 +1507,9 @@ func (ai *AssetIndex) adviceNotOnServer() *Advice {
 // The server may have the asset, but in lower resolution. Compare the taken date and resolution
 
 func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error) {
+	ai.lock.RLock()
+	defer ai.lock.RUnlock()
+
 	filename := la.Title
 	if path.Ext(filename) == "" {
 		filename += path.Ext(la.FileName)
@@ -778,11 +1535,10 @@ func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error)
 	}
 
 	if len(l) > 0 {
-		dateTaken := la.DateTaken
 		size := int(la.Size())
 
 		for _, sa = range l {
-			compareDate := compareDate(dateTaken, sa.ExifInfo.DateTimeOriginal.Time)
+			compareDate := compareDate(la, sa)
 			compareSize := size - sa.ExifInfo.FileSizeInByte
 
 			switch {
@@ -798,8 +1554,15 @@ func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error)
 	return ai.adviceNotOnServer(), nil
 }
 
-func compareDate(d1 time.Time, d2 time.Time) int {
-	diff := d1.Sub(d2)
+// compareDate compares the capture dates of the local file and the server's asset.
+// The instants are compared when both time zones are known, the wall clock times otherwise.
+func compareDate(la *browser.LocalAssetFile, sa *immich.Asset) int {
+	var diff time.Duration
+	if la.TimeZone != nil && sa.ExifInfo.Location() != nil {
+		diff = la.DateTaken.Sub(sa.ExifInfo.DateTimeOriginal.Time)
+	} else {
+		diff = immich.WallClock(la.DateTaken, la.TimeZone).Sub(sa.WallClock())
+	}
 
 	switch {
 	case diff < -5*time.Minute:
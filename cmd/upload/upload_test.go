@@ -3,11 +3,20 @@ package upload
 import (
 	"cmp"
 	"context"
+	"crypto/sha1"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kr/pretty"
 	"github.com/simulot/immich-go/browser"
@@ -23,10 +32,30 @@ func (c *stubIC) GetAllAssetsWithFilter(context.Context, func(*immich.Asset)) er
 	return nil
 }
 
+func (c *stubIC) GetAssetsUpdatedAfter(context.Context, time.Time, func(*immich.Asset)) error {
+	return nil
+}
+
+func (c *stubIC) GetDeletedAssets(context.Context, time.Time) ([]string, bool, error) {
+	return nil, false, nil
+}
+
 func (c *stubIC) AssetUpload(context.Context, *browser.LocalAssetFile) (immich.AssetResponse, error) {
 	return immich.AssetResponse{}, nil
 }
 
+func (c *stubIC) CheckBulkUpload(context.Context, []immich.BulkCheckItem) ([]immich.BulkCheckResult, error) {
+	return nil, nil
+}
+
+func (c *stubIC) DownloadAsset(context.Context, string) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (c *stubIC) GetAlbumInfo(context.Context, string) (immich.AlbumContent, error) {
+	return immich.AlbumContent{}, nil
+}
+
 func (c *stubIC) DeleteAssets(context.Context, []string, bool) error {
 	return nil
 }
@@ -55,6 +84,10 @@ func (c *stubIC) UpdateAsset(ctx context.Context, id string, a *browser.LocalAss
 	return nil, nil
 }
 
+func (c *stubIC) UpdateAssetFields(ctx context.Context, id string, param immich.AssetUpdate) (*immich.Asset, error) {
+	return nil, nil
+}
+
 func (c *stubIC) EnableAppTrace(bool) {}
 
 func (c *stubIC) GetServerStatistics(ctx context.Context) (immich.ServerStatistics, error) {
@@ -85,6 +118,22 @@ func (c *stubIC) DeleteAlbum(ctx context.Context, id string) error {
 	return nil
 }
 
+func (c *stubIC) GetAllTags(ctx context.Context) ([]immich.Tag, error) {
+	return nil, nil
+}
+
+func (c *stubIC) CreateTag(ctx context.Context, name string, parentID string) (immich.Tag, error) {
+	return immich.Tag{}, nil
+}
+
+func (c *stubIC) UpsertTags(ctx context.Context, values []string) ([]immich.Tag, error) {
+	return nil, nil
+}
+
+func (c *stubIC) TagAssets(ctx context.Context, tagID string, assets []string) ([]immich.UpdateAlbumResult, error) {
+	return nil, nil
+}
+
 func (c *stubIC) SupportedMedia() immich.SupportedMedia {
 	return immich.DefaultSupportedMedia
 }
@@ -92,11 +141,22 @@ func (c *stubIC) SupportedMedia() immich.SupportedMedia {
 type icCatchUploadsAssets struct {
 	stubIC
 
-	assets []string
-	albums map[string][]string
+	mut     sync.Mutex
+	assets  []string
+	albums  map[string][]string
+	indexed int // number of requests of the server's assets
+}
+
+func (c *icCatchUploadsAssets) GetAllAssetsWithFilter(context.Context, func(*immich.Asset)) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.indexed++
+	return nil
 }
 
 func (c *icCatchUploadsAssets) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	c.assets = append(c.assets, a.FileName)
 	return immich.AssetResponse{
 		ID: a.FileName,
@@ -111,6 +171,8 @@ func (c *icCatchUploadsAssets) CreateAlbum(ctx context.Context, album string, id
 	if album == "" {
 		panic("can't create album without name")
 	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	if c.albums == nil {
 		c.albums = map[string][]string{}
 	}
@@ -447,6 +509,59 @@ func TestUpload(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "concurrent uploads, album after folder",
+			args: []string{
+				"-concurrency=4",
+				"-create-album-folder",
+				"TEST_DATA/folder/high",
+			},
+			expectedErr: false,
+			expectedAssets: []string{
+				"AlbumA/PXL_20231006_063000139.jpg",
+				"AlbumA/PXL_20231006_063029647.jpg",
+				"AlbumA/PXL_20231006_063108407.jpg",
+				"AlbumA/PXL_20231006_063121958.jpg",
+				"AlbumA/PXL_20231006_063357420.jpg",
+				"AlbumB/PXL_20231006_063528961.jpg",
+				"AlbumB/PXL_20231006_063536303.jpg",
+				"AlbumB/PXL_20231006_063851485.jpg",
+			},
+			expectedAlbums: map[string][]string{
+				"AlbumA": {
+					"AlbumA/PXL_20231006_063000139.jpg",
+					"AlbumA/PXL_20231006_063029647.jpg",
+					"AlbumA/PXL_20231006_063108407.jpg",
+					"AlbumA/PXL_20231006_063121958.jpg",
+					"AlbumA/PXL_20231006_063357420.jpg",
+				},
+				"AlbumB": {
+					"AlbumB/PXL_20231006_063528961.jpg",
+					"AlbumB/PXL_20231006_063536303.jpg",
+					"AlbumB/PXL_20231006_063851485.jpg",
+				},
+			},
+		},
+		{
+			name: "concurrent uploads, google photos",
+			args: []string{
+				"-concurrency=4",
+				"-google-photos",
+				"-partner-album=partner",
+				"TEST_DATA/Takeout2",
+			},
+			expectedErr: false,
+			expectedAssets: []string{
+				"Google Photos/Photos from 2023/PXL_20231006_063528961.jpg",
+				"Google Photos/Photos from 2023/PXL_20231006_063000139.jpg",
+				"Google Photos/Sans titre(9)/PXL_20231006_063108407.jpg",
+			},
+			expectedAlbums: map[string][]string{
+				"partner": {
+					"Google Photos/Photos from 2023/PXL_20231006_063000139.jpg",
+				},
+			},
+		},
 		// {
 		// 	name: "google photo, homonyms, keep partner",
 		// 	args: []string{
@@ -525,3 +640,279 @@ func cmpSlices[T cmp.Ordered](a, b []T) bool {
 	slices.Sort(b)
 	return reflect.DeepEqual(a, b)
 }
+
+type icWithChecksums struct {
+	icCatchUploadsAssets
+	serverAssets []*immich.Asset
+	rejected     map[string]string // checksum -> server ID
+	checks       [][]immich.BulkCheckItem
+}
+
+func (c *icWithChecksums) GetAllAssetsWithFilter(ctx context.Context, fn func(*immich.Asset)) error {
+	for _, a := range c.serverAssets {
+		fn(a)
+	}
+	return nil
+}
+
+func (c *icWithChecksums) CheckBulkUpload(ctx context.Context, items []immich.BulkCheckItem) ([]immich.BulkCheckResult, error) {
+	c.mut.Lock()
+	c.checks = append(c.checks, items)
+	c.mut.Unlock()
+	rr := []immich.BulkCheckResult{}
+	for _, i := range items {
+		r := immich.BulkCheckResult{ID: i.ID, Action: "accept"}
+		if id, ok := c.rejected[i.Checksum]; ok {
+			r.Action, r.Reason, r.AssetID = "reject", "duplicate", id
+		}
+		rr = append(rr, r)
+	}
+	return rr, nil
+}
+
+func TestUploadChecksum(t *testing.T) {
+	const file = "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha1.Sum(b)
+	checksum := base64.StdEncoding.EncodeToString(h[:])
+
+	testCases := []struct {
+		name           string
+		args           []string
+		serverAssets   []*immich.Asset
+		rejected       map[string]string
+		expectedAssets []string
+	}{
+		{
+			name: "renamed file in the index",
+			args: []string{file},
+			serverAssets: []*immich.Asset{
+				{ID: "1", OriginalFileName: "renamed", OriginalPath: "upload/renamed.jpg", Checksum: checksum},
+			},
+		},
+		{
+			name:     "file known by the bulk check",
+			args:     []string{file},
+			rejected: map[string]string{checksum: "1"},
+		},
+		{
+			name: "checksum disabled",
+			args: []string{"-checksum=false", file},
+			serverAssets: []*immich.Asset{
+				{ID: "1", OriginalFileName: "renamed", OriginalPath: "upload/renamed.jpg", Checksum: checksum},
+			},
+			expectedAssets: []string{"PXL_20231006_063000139.jpg"},
+		},
+		{
+			name:           "new file",
+			args:           []string{file},
+			expectedAssets: []string{"PXL_20231006_063000139.jpg"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icWithChecksums{
+				serverAssets: tc.serverAssets,
+				rejected:     tc.rejected,
+			}
+			ctx := context.Background()
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    logger.NewJournal(&logger.NoLog{}),
+			}
+			app, err := NewUpCmd(ctx, &serv, tc.args)
+			if err != nil {
+				t.Fatalf("can't instantiate the UploadCmd: %s", err)
+			}
+			err = app.Run(ctx, app.fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmpSlices(tc.expectedAssets, ic.assets) {
+				t.Errorf("expected upload differs ")
+				pretty.Ldiff(t, tc.expectedAssets, ic.assets)
+			}
+		})
+	}
+}
+
+func TestUploadChecksumBatch(t *testing.T) {
+	dir := t.TempDir()
+	checksums := map[string]string{}
+	for i := 0; i < checkBatchSize+5; i++ {
+		name := fmt.Sprintf("IMG_%04d.jpg", i)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		h := sha1.Sum([]byte(name))
+		checksums[name] = base64.StdEncoding.EncodeToString(h[:])
+	}
+	// IMG_0001.jpg is known by the server, IMG_0002.jpg is in the index
+	ic := &icWithChecksums{
+		serverAssets: []*immich.Asset{
+			{ID: "2", OriginalFileName: "renamed", OriginalPath: "upload/renamed.jpg", Checksum: checksums["IMG_0002.jpg"]},
+		},
+		rejected: map[string]string{checksums["IMG_0001.jpg"]: "1"},
+	}
+	ctx := context.Background()
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    logger.NewJournal(&logger.NoLog{}),
+	}
+	app, err := NewUpCmd(ctx, &serv, []string{"-concurrency=4", dir})
+	if err != nil {
+		t.Fatalf("can't instantiate the UploadCmd: %s", err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ic.assets) != checkBatchSize+3 {
+		t.Errorf("%d files uploaded, want %d", len(ic.assets), checkBatchSize+3)
+	}
+	for _, a := range ic.assets {
+		if a == "IMG_0001.jpg" || a == "IMG_0002.jpg" {
+			t.Errorf("%s is uploaded", a)
+		}
+	}
+	if len(ic.checks) != 2 || len(ic.checks[0])+len(ic.checks[1]) != checkBatchSize+4 {
+		t.Errorf("expected 2 checks of %d files, got %d checks", checkBatchSize+4, len(ic.checks))
+	}
+}
+
+type icCatchLivePhotos struct {
+	icCatchUploadsAssets
+	livePhotoIDs map[string]string // live photo video ID by uploaded file
+}
+
+func (c *icCatchLivePhotos) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.mut.Lock()
+	c.livePhotoIDs[a.FileName] = a.LivePhotoID
+	c.mut.Unlock()
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestUploadLivePhotos(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"IMG_0001.HEIC", "IMG_0001.MOV", "IMG_0002.HEIC"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ic := &icCatchLivePhotos{livePhotoIDs: map[string]string{}}
+	ctx := context.Background()
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    logger.NewJournal(&logger.NoLog{}),
+	}
+	app, err := NewUpCmd(ctx, &serv, []string{"-checksum=false", dir})
+	if err != nil {
+		t.Fatalf("can't instantiate the UploadCmd: %s", err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"IMG_0001.MOV":  "",
+		"IMG_0001.HEIC": "IMG_0001.MOV",
+		"IMG_0002.HEIC": "",
+	}
+	if !reflect.DeepEqual(expected, ic.livePhotoIDs) {
+		t.Errorf("expected live photo links differ")
+		pretty.Ldiff(t, expected, ic.livePhotoIDs)
+	}
+	if i := slices.Index(ic.assets, "IMG_0001.MOV"); i < 0 || i > slices.Index(ic.assets, "IMG_0001.HEIC") {
+		t.Errorf("the video must be uploaded before the image: %v", ic.assets)
+	}
+}
+
+type icCatchGeotag struct {
+	icCatchUploadsAssets
+	sidecars map[string]string  // generated sidecar by uploaded file
+	updates  map[string]float64 // updated latitude by asset ID
+}
+
+func (c *icCatchGeotag) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	if a.SideCar != nil {
+		b, err := a.SideCar.Bytes()
+		if err != nil {
+			return immich.AssetResponse{}, err
+		}
+		c.mut.Lock()
+		c.sidecars[a.FileName] = string(b)
+		c.mut.Unlock()
+	}
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func (c *icCatchGeotag) UpdateAsset(ctx context.Context, id string, a *browser.LocalAssetFile) (*immich.Asset, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.updates[id] = a.Latitude
+	return nil, nil
+}
+
+func TestUploadGeotag(t *testing.T) {
+	track := filepath.Join(t.TempDir(), "track.gpx")
+	err := os.WriteFile(track, []byte(`<gpx><trk><trkseg>
+<trkpt lat="48.85" lon="2.29"><time>2023-10-06T06:29:00Z</time></trkpt>
+<trkpt lat="48.87" lon="2.31"><time>2023-10-06T06:31:00Z</time></trkpt>
+</trkseg></trk></gpx>`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		args    []string
+		updates map[string]float64
+	}{
+		{
+			name:    "in the track",
+			args:    []string{"-geotag=" + track},
+			updates: map[string]float64{"PXL_20231006_063000139.jpg": 48.86},
+		},
+		{
+			name:    "camera clock too late",
+			args:    []string{"-geotag=" + track, "-geotag-offset=1h"},
+			updates: map[string]float64{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icCatchGeotag{sidecars: map[string]string{}, updates: map[string]float64{}}
+			ctx := context.Background()
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    logger.NewJournal(&logger.NoLog{}),
+			}
+			app, err := NewUpCmd(ctx, &serv, append(tc.args, "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"))
+			if err != nil {
+				t.Fatalf("can't instantiate the UploadCmd: %s", err)
+			}
+			err = app.Run(ctx, app.fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.updates, ic.updates) {
+				t.Errorf("unexpected updates")
+				pretty.Ldiff(t, tc.updates, ic.updates)
+			}
+			sc, ok := ic.sidecars["PXL_20231006_063000139.jpg"]
+			if len(tc.updates) > 0 && (!ok || !strings.Contains(sc, "<exif:GPSLatitude>48,51.600000N</exif:GPSLatitude>")) {
+				t.Errorf("unexpected sidecar: %s", sc)
+			}
+			if len(tc.updates) == 0 && ok {
+				t.Errorf("unexpected sidecar: %s", sc)
+			}
+		})
+	}
+}
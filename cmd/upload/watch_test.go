@@ -0,0 +1,84 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestUploadWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name string) {
+		t.Helper()
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("trip/PXL_20231006_063000139.jpg")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ic := &icCatchUploadsAssets{
+		albums: map[string][]string{},
+	}
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    logger.NewJournal(&logger.NoLog{}),
+	}
+	app, err := NewUpCmd(ctx, &serv, []string{"-watch", "-watch-poll", "-watch-poll-interval=50ms", "-watch-stability=100ms", "-create-album-folder", "-checksum=false", dir})
+	if err != nil {
+		t.Fatalf("can't instantiate the UploadCmd: %s", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- app.RunWatch(ctx, app.watchFolders)
+	}()
+
+	// waitFor waits until the uploads and albums are the expected ones
+	waitFor := func(assets []string, albums map[string][]string) {
+		t.Helper()
+		for {
+			ic.mut.Lock()
+			ok := cmpSlices(assets, ic.assets) && cmpAlbums(albums, ic.albums)
+			ic.mut.Unlock()
+			if ok {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				ic.mut.Lock()
+				defer ic.mut.Unlock()
+				t.Errorf("expected uploads and albums differ")
+				pretty.Ldiff(t, assets, ic.assets)
+				pretty.Ldiff(t, albums, ic.albums)
+				t.FailNow()
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}
+
+	waitFor([]string{"trip/PXL_20231006_063000139.jpg"},
+		map[string][]string{"trip": {"trip/PXL_20231006_063000139.jpg"}})
+
+	writeFile("party/PXL_20231007_210000000.jpg")
+	waitFor([]string{"trip/PXL_20231006_063000139.jpg", "party/PXL_20231007_210000000.jpg"},
+		map[string][]string{
+			"trip":  {"trip/PXL_20231006_063000139.jpg"},
+			"party": {"party/PXL_20231007_210000000.jpg"},
+		})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
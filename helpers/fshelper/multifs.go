@@ -2,20 +2,67 @@ package fshelper
 
 import (
 	"archive/zip"
+	"errors"
+	"io"
 	"io/fs"
+	"strings"
 
 	"github.com/yalue/merged_fs"
 )
 
-func multiZip(names ...string) (fs.FS, error) {
+// mergedArchives gives the merged content of archives, like a takeout split in several parts
+type mergedArchives struct {
+	fs.FS
+	archives []io.Closer
+	names    []string // archive files
+}
+
+// String gives the names of the archives, it names the file system in the reports
+func (m *mergedArchives) String() string {
+	return strings.Join(m.names, ", ")
+}
+
+func (m *mergedArchives) Close() error {
+	var err error
+	for _, a := range m.archives {
+		err = errors.Join(err, a.Close())
+	}
+	return err
+}
+
+func multiArchives(zips []string, tgzs []string) (fs.FS, error) {
+	m := &mergedArchives{}
 	fss := []fs.FS{}
 
-	for _, p := range names {
+	for _, p := range zips {
 		fsys, err := zip.OpenReader(p)
 		if err != nil {
-			return nil, err
+			return nil, errors.Join(err, m.Close())
 		}
+		m.archives = append(m.archives, fsys)
+		m.names = append(m.names, p)
 		fss = append(fss, fsys)
 	}
-	return merged_fs.MergeMultiple(fss...), nil
+	for _, p := range tgzs {
+		fsys, err := newTgzFS(p)
+		if err != nil {
+			return nil, errors.Join(err, m.Close())
+		}
+		m.archives = append(m.archives, fsys)
+		m.names = append(m.names, p)
+		fss = append(fss, fsys)
+	}
+	m.FS = merged_fs.MergeMultiple(fss...)
+	return m, nil
+}
+
+// CloseFSs closes the file systems that need it, like archives
+func CloseFSs(fsyss []fs.FS) error {
+	var err error
+	for _, fsys := range fsyss {
+		if c, ok := fsys.(io.Closer); ok {
+			err = errors.Join(err, c.Close())
+		}
+	}
+	return err
 }
@@ -8,8 +8,6 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
-
-	"github.com/simulot/immich-go/helpers/gen"
 )
 
 type argParser struct {
@@ -17,14 +15,13 @@ type argParser struct {
 	files        []string
 	paths        map[string][]string
 	zips         []string
-	unsupported  map[string]any
+	tgzs         []string
 	err          error
 }
 
 func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 	p := argParser{
 		googlePhotos: googlePhoto,
-		unsupported:  map[string]any{},
 		paths:        map[string][]string{},
 	}
 
@@ -44,7 +41,7 @@ func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 			}
 
 			for _, g := range globs {
-				if p.googlePhotos && strings.ToLower(path.Ext(g)) != ".zip" {
+				if p.googlePhotos && !isArchive(g) {
 					return nil, fmt.Errorf("wildcard '%s' not allowed with the google-photos options", filepath.Base(f))
 				}
 				p.handleFile(g)
@@ -73,20 +70,14 @@ func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 		}
 	}
 
-	if len(p.zips) > 0 {
-		f, err := multiZip(p.zips...)
+	if len(p.zips) > 0 || len(p.tgzs) > 0 {
+		f, err := multiArchives(p.zips, p.tgzs)
 		if err != nil {
 			p.err = errors.Join(err)
 		} else {
 			fsys = append(fsys, f)
 		}
 	}
-	if len(p.unsupported) > 0 {
-		keys := gen.MapKeys(p.unsupported)
-		for _, k := range keys {
-			p.err = errors.Join(fmt.Errorf("files with extension '%s' are not supported. Check the discussion here https://github.com/simulot/immich-go/discussions/109", k))
-		}
-	}
 	return fsys, p.err
 }
 
@@ -107,8 +98,8 @@ func (p *argParser) handleFile(f string) {
 		p.zips = append(p.zips, f)
 		return
 	}
-	if ext == ".tgz" {
-		p.unsupported[ext] = nil
+	if isTgz(f) {
+		p.tgzs = append(p.tgzs, f)
 		return
 	}
 	if p.googlePhotos {
@@ -116,3 +107,12 @@ func (p *argParser) handleFile(f string) {
 	}
 	p.files = append(p.files, f)
 }
+
+func isTgz(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz")
+}
+
+func isArchive(name string) bool {
+	return strings.ToLower(path.Ext(name)) == ".zip" || isTgz(name)
+}
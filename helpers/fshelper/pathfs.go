@@ -27,6 +27,11 @@ func newPathFS(dir string, files []string) (*pathFS, error) {
 	}, nil
 }
 
+// String gives the folder, it names the file system in the reports
+func (fsys pathFS) String() string {
+	return fsys.dir
+}
+
 func (fsys pathFS) listed(name string) bool {
 	if len(fsys.files) > 0 {
 		ext := path.Ext(name)
@@ -36,6 +36,11 @@ func DirRemoveFS(name string) fs.FS {
 	return fsys
 }
 
+// String gives the folder, it names the file system in the reports
+func (fsys dirRemoveFS) String() string {
+	return fsys.dir
+}
+
 func (fsys dirRemoveFS) Remove(name string) error {
 	return os.Remove(filepath.Join(fsys.dir, name))
 }
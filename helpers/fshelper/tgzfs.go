@@ -0,0 +1,542 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	tgzFS gives access to the files of a .tgz archive, the format of big Google takeouts.
+
+	A gzip stream can't be read randomly. The archive is read once to index its members,
+	the small JSON files are kept in memory because they are all read by the takeout's first pass.
+	Beyond the memory limit, they are extracted into the spool directory during the same pass.
+
+	The other files are extracted into a spool directory when they are read. Reaching a file
+	extracts the files placed before it in the archive, as long as the spool has room for them.
+	They can be read later without decompressing the archive again from the beginning.
+
+	The spool directory is placed in the user's cache directory, beside the other temporary files,
+	because the system's temporary directory is often kept in memory.
+	The files are read in the order of the walk of the file system, by name, not in the order of the archive.
+	When the spool is full, the files already read are removed first, the least recently used first,
+	then the files coming last in the walk. A skipped file takes the place of the files coming after it
+	in the walk. So, each decompression of the archive extracts the next files of the walk, as many as
+	the spool can hold: the whole reading costs about one decompression of the archive per spool size.
+*/
+
+const (
+	tgzMemoryLimit = 4 * 1024 * 1024        // JSON files kept in memory are smaller than this
+	tgzMemoryTotal = 256 * 1024 * 1024      // bytes of the JSON files kept in memory
+	tgzSpoolLimit  = 4 * 1024 * 1024 * 1024 // bytes kept in the spool directory
+)
+
+type tgzFS struct {
+	name string // archive file
+
+	mut     sync.Mutex
+	entries map[string]*tgzEntry // files and directories by path
+	memory  int64                // bytes of the JSON files kept in memory
+	memMax  int64                // memory limit
+	stream  *tgzStream           // current position in the archive
+	spool   string               // spool directory, created when needed
+	spooled int64                // bytes in the spool
+	lru     []*tgzEntry          // spooled files, the least recently used first
+	limit   int64                // spool limit
+	rewinds int                  // number of times the archive is decompressed again from the beginning
+}
+
+type tgzEntry struct {
+	name     string // path in the archive
+	index    int    // position of the member in the archive, -1 for directories
+	rank     int    // position of the file in the walk of the file system
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	children []*tgzEntry // content of directories
+
+	data    []byte // file kept in memory
+	spooled string // path of the extracted file
+	opened  int    // number of readers of the extracted file
+	read    bool   // the extracted file has been read
+}
+
+type tgzStream struct {
+	f     *os.File
+	tr    *tar.Reader
+	index int // position of the next member
+}
+
+func newTgzFS(name string) (*tgzFS, error) {
+	return newTgzFSWithLimits(name, tgzMemoryTotal, tgzSpoolLimit)
+}
+
+// newTgzFSWithLimits indexes the archive, keeping up to memory bytes of JSON files in memory, and spool bytes of files in the spool directory
+func newTgzFSWithLimits(name string, memory, spool int64) (*tgzFS, error) {
+	fsys := &tgzFS{
+		name: name,
+		entries: map[string]*tgzEntry{
+			".": {name: ".", index: -1, mode: fs.ModeDir | 0o555},
+		},
+		memMax: memory,
+		limit:  spool,
+	}
+	err := fsys.index()
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// index reads the whole archive to list its members
+func (fsys *tgzFS) index() error {
+	s, err := openTgzStream(fsys.name)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	for {
+		h, err := s.tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("can't read the archive %s: %w", fsys.name, err)
+		}
+		index := s.index
+		s.index++
+
+		name := strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		if name == "" || !fs.ValidPath(name) {
+			continue
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			d := fsys.dir(name)
+			d.modTime = h.ModTime
+		case tar.TypeReg:
+			e := &tgzEntry{
+				name:    name,
+				index:   index,
+				size:    h.Size,
+				mode:    fs.FileMode(h.Mode).Perm(),
+				modTime: h.ModTime,
+			}
+			if strings.ToLower(path.Ext(name)) == ".json" {
+				switch {
+				case h.Size <= tgzMemoryLimit && fsys.memory+h.Size <= fsys.memMax:
+					e.data, err = io.ReadAll(s.tr)
+					if err != nil {
+						return fmt.Errorf("can't read the archive %s: %w", fsys.name, err)
+					}
+					fsys.memory += h.Size
+				case fsys.spooled+h.Size <= fsys.limit:
+					err = fsys.spoolFile(e, s.tr)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			if _, exists := fsys.entries[name]; !exists {
+				parent := fsys.dir(path.Dir(name))
+				parent.children = append(parent.children, e)
+			}
+			fsys.entries[name] = e
+		}
+	}
+
+	for _, e := range fsys.entries {
+		sort.Slice(e.children, func(i, j int) bool {
+			return e.children[i].name < e.children[j].name
+		})
+	}
+	fsys.rank(fsys.entries["."], 0)
+	return nil
+}
+
+// rank numbers the files of the directory in the order of the walk of the file system, and gives the next number
+func (fsys *tgzFS) rank(d *tgzEntry, next int) int {
+	for _, e := range d.children {
+		if e.IsDir() {
+			next = fsys.rank(e, next)
+			continue
+		}
+		e.rank = next
+		next++
+	}
+	return next
+}
+
+// dir gives the directory entry, and creates it and its parents when needed
+func (fsys *tgzFS) dir(name string) *tgzEntry {
+	if d, ok := fsys.entries[name]; ok {
+		return d
+	}
+	d := &tgzEntry{name: name, index: -1, mode: fs.ModeDir | 0o555}
+	fsys.entries[name] = d
+	parent := fsys.dir(path.Dir(name))
+	parent.children = append(parent.children, d)
+	return d
+}
+
+func (fsys *tgzFS) entry(op, name string) (*tgzEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := fsys.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+// Open gives the file or the directory.
+// The file is extracted on the first read.
+func (fsys *tgzFS) Open(name string) (fs.File, error) {
+	e, err := fsys.entry("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsDir() {
+		return &tgzDir{entry: e}, nil
+	}
+	return &tgzFile{fsys: fsys, entry: e}, nil
+}
+
+func (fsys *tgzFS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.entry("stat", name)
+}
+
+func (fsys *tgzFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := fsys.entry("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return e.dirEntries(), nil
+}
+
+// Close stops the reading of the archive and removes the spool directory
+func (fsys *tgzFS) Close() error {
+	fsys.mut.Lock()
+	defer fsys.mut.Unlock()
+	var err error
+	if fsys.stream != nil {
+		err = fsys.stream.close()
+		fsys.stream = nil
+	}
+	if fsys.spool != "" {
+		err = errors.Join(err, os.RemoveAll(fsys.spool))
+		fsys.spool = ""
+	}
+	return err
+}
+
+// open gives a reader on the file's content
+func (fsys *tgzFS) open(e *tgzEntry) (io.ReadCloser, error) {
+	if e.data != nil {
+		return io.NopCloser(bytes.NewReader(e.data)), nil
+	}
+	fsys.mut.Lock()
+	defer fsys.mut.Unlock()
+	err := fsys.extract(e)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(e.spooled)
+	if err != nil {
+		return nil, err
+	}
+	e.opened++
+	e.read = true
+	return f, nil
+}
+
+func (fsys *tgzFS) release(e *tgzEntry) {
+	fsys.mut.Lock()
+	defer fsys.mut.Unlock()
+	e.opened--
+}
+
+// extract the file into the spool directory. The archive is read from the beginning when the file is placed before the current position.
+func (fsys *tgzFS) extract(e *tgzEntry) error {
+	if e.spooled != "" {
+		fsys.touch(e)
+		return nil
+	}
+	if fsys.stream == nil || fsys.stream.index > e.index {
+		if fsys.stream != nil {
+			_ = fsys.stream.close()
+			fsys.stream = nil
+			fsys.rewinds++
+		}
+		s, err := openTgzStream(fsys.name)
+		if err != nil {
+			return err
+		}
+		fsys.stream = s
+	}
+
+	for {
+		h, err := fsys.stream.tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("can't extract %s from the archive %s: %w", e.name, fsys.name, err)
+		}
+		index := fsys.stream.index
+		fsys.stream.index++
+		if index == e.index {
+			fsys.makeRoom(e.size, -1)
+			return fsys.spoolFile(e, fsys.stream.tr)
+		}
+
+		// Keep the skipped file when there is room for it, or when it comes before spooled files in the walk
+		name := strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		skipped, ok := fsys.entries[name]
+		if ok && skipped.index == index && skipped.data == nil && skipped.spooled == "" && fsys.makeRoom(skipped.size, skipped.rank) {
+			err = fsys.spoolFile(skipped, fsys.stream.tr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// spoolFile copies the current member of the archive into the spool directory
+func (fsys *tgzFS) spoolFile(e *tgzEntry, r io.Reader) error {
+	if fsys.spool == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(dir, "github.com/simulot/immich-go")
+		err = os.MkdirAll(dir, 0o700)
+		if err != nil {
+			return err
+		}
+		dir, err = os.MkdirTemp(dir, "tgz-")
+		if err != nil {
+			return err
+		}
+		fsys.spool = dir
+	}
+	name := filepath.Join(fsys.spool, strconv.Itoa(e.index))
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		_ = os.Remove(name)
+		return fmt.Errorf("can't extract %s from the archive %s: %w", e.name, fsys.name, err)
+	}
+	e.spooled = name
+	fsys.spooled += e.size
+	fsys.lru = append(fsys.lru, e)
+	return nil
+}
+
+// makeRoom removes files from the spool, the files already read first, the least recently used first,
+// then the files placed after the rank in the walk, the last ones first. It tells if there is room for the size.
+// The rank -1 makes room for the file to read: any file can be removed.
+func (fsys *tgzFS) makeRoom(size int64, rank int) bool {
+	if fsys.spooled+size <= fsys.limit {
+		return true
+	}
+	candidates := []*tgzEntry{}
+	for _, e := range fsys.lru {
+		if e.opened == 0 && e.read {
+			candidates = append(candidates, e)
+		}
+	}
+	unread := []*tgzEntry{}
+	for _, e := range fsys.lru {
+		if e.opened == 0 && !e.read && e.rank > rank {
+			unread = append(unread, e)
+		}
+	}
+	sort.Slice(unread, func(i, j int) bool {
+		return unread[i].rank > unread[j].rank
+	})
+	candidates = append(candidates, unread...)
+
+	// Don't remove files for nothing
+	room := fsys.limit - fsys.spooled
+	for _, e := range candidates {
+		room += e.size
+	}
+	if rank >= 0 && room < size {
+		return false
+	}
+
+	removed := map[*tgzEntry]bool{}
+	for _, e := range candidates {
+		if fsys.spooled+size <= fsys.limit {
+			break
+		}
+		_ = os.Remove(e.spooled)
+		e.spooled = ""
+		fsys.spooled -= e.size
+		removed[e] = true
+	}
+	kept := fsys.lru[:0]
+	for _, e := range fsys.lru {
+		if !removed[e] {
+			kept = append(kept, e)
+		}
+	}
+	fsys.lru = kept
+	return fsys.spooled+size <= fsys.limit
+}
+
+// touch moves the file at the end of the least recently used list
+func (fsys *tgzFS) touch(e *tgzEntry) {
+	for i, l := range fsys.lru {
+		if l == e {
+			fsys.lru = append(append(fsys.lru[:i], fsys.lru[i+1:]...), e)
+			return
+		}
+	}
+}
+
+func openTgzStream(name string) (*tgzStream, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("can't read the archive %s: %w", name, err)
+	}
+	return &tgzStream{f: f, tr: tar.NewReader(gz)}, nil
+}
+
+func (s *tgzStream) close() error {
+	return s.f.Close()
+}
+
+// tgzEntry implements fs.FileInfo and fs.DirEntry
+
+func (e *tgzEntry) Name() string {
+	return path.Base(e.name)
+}
+
+func (e *tgzEntry) Size() int64 {
+	return e.size
+}
+
+func (e *tgzEntry) Mode() fs.FileMode {
+	return e.mode
+}
+
+func (e *tgzEntry) ModTime() time.Time {
+	return e.modTime
+}
+
+func (e *tgzEntry) IsDir() bool {
+	return e.mode.IsDir()
+}
+
+func (e *tgzEntry) Sys() any {
+	return nil
+}
+
+func (e *tgzEntry) Type() fs.FileMode {
+	return e.mode.Type()
+}
+
+func (e *tgzEntry) Info() (fs.FileInfo, error) {
+	return e, nil
+}
+
+func (e *tgzEntry) dirEntries() []fs.DirEntry {
+	l := make([]fs.DirEntry, 0, len(e.children))
+	for _, c := range e.children {
+		l = append(l, c)
+	}
+	return l
+}
+
+// tgzFile is a file of the archive
+type tgzFile struct {
+	fsys  *tgzFS
+	entry *tgzEntry
+	r     io.ReadCloser
+}
+
+func (f *tgzFile) Stat() (fs.FileInfo, error) {
+	return f.entry, nil
+}
+
+func (f *tgzFile) Read(b []byte) (int, error) {
+	if f.r == nil {
+		r, err := f.fsys.open(f.entry)
+		if err != nil {
+			return 0, err
+		}
+		f.r = r
+	}
+	return f.r.Read(b)
+}
+
+func (f *tgzFile) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	err := f.r.Close()
+	if f.entry.data == nil {
+		f.fsys.release(f.entry)
+	}
+	f.r = nil
+	return err
+}
+
+// tgzDir is a directory of the archive
+type tgzDir struct {
+	entry *tgzEntry
+	pos   int
+}
+
+func (d *tgzDir) Stat() (fs.FileInfo, error) {
+	return d.entry, nil
+}
+
+func (d *tgzDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *tgzDir) Close() error {
+	return nil
+}
+
+func (d *tgzDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	l := d.entry.dirEntries()[d.pos:]
+	if n > 0 {
+		if len(l) == 0 {
+			return nil, io.EOF
+		}
+		l = l[:min(n, len(l))]
+	}
+	d.pos += len(l)
+	return l, nil
+}
@@ -0,0 +1,266 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tgzMember struct {
+	name    string
+	content string
+}
+
+func writeTgz(t *testing.T, name string, members []tgzMember) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		err = tw.WriteHeader(&tar.Header{
+			Name:     m.name,
+			Mode:     0o644,
+			Size:     int64(len(m.content)),
+			ModTime:  time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(m.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var takeoutPart1 = []tgzMember{
+	{"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg", "image 1"},
+	{"Takeout/Google Photos/Album/metadata.json", `{"title":"Album"}`},
+	{"Takeout/Google Photos/Album/PXL_20231006_063029647.jpg", "image 2"},
+	{"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg.json", `{"title":"PXL_20231006_063000139.jpg"}`},
+}
+
+var takeoutPart2 = []tgzMember{
+	{"./Takeout/Google Photos/Album/PXL_20231006_063029647.jpg.json", `{"title":"PXL_20231006_063029647.jpg"}`},
+	{"./Takeout/Google Photos/Photos from 2023/PXL_20231006_063108407.jpg", "image 3"},
+}
+
+func walk(t *testing.T, fsys fs.FS) []string {
+	t.Helper()
+	names := []string{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestTgzFS(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "takeout-001.tgz")
+	writeTgz(t, name, takeoutPart1)
+	fsys, err := newTgzFS(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	fsys.limit = 10 // keep only one image in the spool
+
+	expected := []string{
+		"Takeout/Google Photos/Album/PXL_20231006_063029647.jpg",
+		"Takeout/Google Photos/Album/metadata.json",
+		"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg",
+		"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg.json",
+	}
+	if got := walk(t, fsys); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected files %v, got %v", expected, got)
+	}
+
+	// Read the files in the reverse order of the archive, and twice
+	for i := 0; i < 2; i++ {
+		for j := len(takeoutPart1) - 1; j >= 0; j-- {
+			m := takeoutPart1[j]
+			b, err := fs.ReadFile(fsys, m.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != m.content {
+				t.Errorf("%s: expected %q, got %q", m.name, m.content, string(b))
+			}
+		}
+	}
+
+	s, err := fs.Stat(fsys, takeoutPart1[0].name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != int64(len(takeoutPart1[0].content)) || s.Name() != "PXL_20231006_063000139.jpg" {
+		t.Errorf("unexpected file info: %s %d", s.Name(), s.Size())
+	}
+	if _, err = fsys.Open("Takeout/missing.jpg"); err == nil {
+		t.Errorf("expecting an error for a missing file")
+	}
+
+	spool := fsys.spool
+	if err = fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(spool); err == nil {
+		t.Errorf("the spool directory %s must be removed", spool)
+	}
+}
+
+func TestTgzFSSpool(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "takeout-001.tgz")
+	members := []tgzMember{
+		{"Takeout/A.jpg", "image A"},
+		{"Takeout/B.jpg", "image B"},
+		{"Takeout/C.jpg", "image C"},
+	}
+	writeTgz(t, name, members)
+	fsys, err := newTgzFS(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	fsys.limit = 14 // two images in the spool
+
+	// A is extracted while reaching B, and is kept when C needs room: B is already read
+	for _, i := range []int{1, 2, 0} {
+		b, err := fs.ReadFile(fsys, members[i].name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != members[i].content {
+			t.Errorf("%s: expected %q, got %q", members[i].name, members[i].content, string(b))
+		}
+	}
+	if fsys.rewinds != 0 {
+		t.Errorf("the archive is decompressed again %d times", fsys.rewinds)
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fsys.spool, filepath.Join(cache, "github.com/simulot/immich-go")) {
+		t.Errorf("the spool directory %s isn't in the user's cache directory", fsys.spool)
+	}
+}
+
+func TestTgzFSWalkOrder(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "takeout-001.tgz")
+	members := []tgzMember{}
+	for i := 19; i >= 0; i-- {
+		members = append(members, tgzMember{fmt.Sprintf("Takeout/F%02d.jpg", i), fmt.Sprintf("image %02d", i)})
+	}
+	writeTgz(t, name, members)
+	fsys, err := newTgzFSWithLimits(name, tgzMemoryTotal, 40) // five images in the spool
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	// The walk reads the files in the reverse order of the archive
+	for _, n := range walk(t, fsys) {
+		b, err := fs.ReadFile(fsys, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "image " + strings.TrimSuffix(strings.TrimPrefix(n, "Takeout/F"), ".jpg"); string(b) != want {
+			t.Errorf("%s: expected %q, got %q", n, want, string(b))
+		}
+	}
+	if fsys.rewinds > 3 {
+		t.Errorf("the archive is decompressed again %d times, expected 3", fsys.rewinds)
+	}
+}
+
+func TestTgzFSMemoryLimit(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "takeout-001.tgz")
+	writeTgz(t, name, takeoutPart1)
+	fsys, err := newTgzFSWithLimits(name, 20, tgzSpoolLimit) // one JSON file in memory
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	album := fsys.entries["Takeout/Google Photos/Album/metadata.json"]
+	photo := fsys.entries["Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg.json"]
+	if album.data == nil || photo.data != nil || photo.spooled == "" || fsys.memory != album.size {
+		t.Errorf("expecting the first JSON file in memory, the second in the spool")
+	}
+	b, err := fs.ReadFile(fsys, photo.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != takeoutPart1[3].content {
+		t.Errorf("unexpected content %q", string(b))
+	}
+	if fsys.stream != nil {
+		t.Errorf("the spooled JSON file is read without decompressing the archive again")
+	}
+}
+
+func TestParsePathTgz(t *testing.T) {
+	dir := t.TempDir()
+	writeTgz(t, filepath.Join(dir, "takeout-001.tgz"), takeoutPart1)
+	writeTgz(t, filepath.Join(dir, "takeout-002.tar.gz"), takeoutPart2)
+
+	fsyss, err := ParsePath([]string{filepath.Join(dir, "takeout-*")}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fsyss) != 1 {
+		t.Fatalf("expecting one merged file system, got %d", len(fsyss))
+	}
+	defer CloseFSs(fsyss)
+
+	expected := []string{
+		"Takeout/Google Photos/Album/PXL_20231006_063029647.jpg",
+		"Takeout/Google Photos/Album/PXL_20231006_063029647.jpg.json",
+		"Takeout/Google Photos/Album/metadata.json",
+		"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg",
+		"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg.json",
+		"Takeout/Google Photos/Photos from 2023/PXL_20231006_063108407.jpg",
+	}
+	if got := walk(t, fsyss[0]); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected files %v, got %v", expected, got)
+	}
+
+	f, err := fsyss[0].Open("Takeout/Google Photos/Photos from 2023/PXL_20231006_063108407.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(b) != "image 3" {
+		t.Errorf("unexpected content %q, %v", string(b), err)
+	}
+}
@@ -0,0 +1,257 @@
+package geotag
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	The tracks recorded by phones or GPS devices give the position of the photographer over time.
+	The position of a photo is interpolated from the points recorded before and after its capture.
+
+	GPX files give the points of the track segments (trkpt).
+	KML files give the points of gx:Track elements, and of the placemarks having a time stamp.
+*/
+
+// Point is a position of a track at a given time
+type Point struct {
+	Time                           time.Time
+	Latitude, Longitude, Elevation float64
+}
+
+// Tracks are the points of all loaded tracks, sorted by time
+type Tracks struct {
+	MaxGap time.Duration // maximum delay between the capture and the points used to determine the position
+	Offset time.Duration // added to the camera's time to get the actual time of the capture
+
+	points []Point
+}
+
+func NewTracks(maxGap, offset time.Duration) *Tracks {
+	return &Tracks{MaxGap: maxGap, Offset: offset}
+}
+
+// Len gives the number of points of the tracks
+func (t *Tracks) Len() int {
+	return len(t.points)
+}
+
+// Load reads a GPX or KML file
+func (t *Tracks) Load(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = t.Read(f, path.Ext(name))
+	if err != nil {
+		return fmt.Errorf("can't read the track %s: %w", name, err)
+	}
+	return nil
+}
+
+// Read reads the points of a track file given by its extension
+func (t *Tracks) Read(r io.Reader, ext string) error {
+	var points []Point
+	var err error
+	switch strings.ToLower(ext) {
+	case ".gpx":
+		points, err = readGPX(r)
+	case ".kml":
+		points, err = readKML(r)
+	default:
+		return fmt.Errorf("unsupported track format: %q", ext)
+	}
+	if err != nil {
+		return err
+	}
+	t.points = append(t.points, points...)
+	sort.SliceStable(t.points, func(i, j int) bool {
+		return t.points[i].Time.Before(t.points[j].Time)
+	})
+	return nil
+}
+
+// Locate gives the position at the date of capture.
+// The position is interpolated between the points surrounding the date when they are no more than MaxGap apart,
+// otherwise the nearest point is used when it is no more than MaxGap away.
+func (t *Tracks) Locate(d time.Time) (Point, bool) {
+	if len(t.points) == 0 || d.IsZero() {
+		return Point{}, false
+	}
+	d = d.Add(t.Offset)
+	i := sort.Search(len(t.points), func(i int) bool {
+		return !t.points[i].Time.Before(d)
+	})
+
+	if i < len(t.points) && t.points[i].Time.Equal(d) {
+		return t.points[i], true
+	}
+	if i > 0 && i < len(t.points) {
+		before, after := t.points[i-1], t.points[i]
+		if gap := after.Time.Sub(before.Time); gap <= t.MaxGap {
+			f := float64(d.Sub(before.Time)) / float64(gap)
+			return Point{
+				Time:      d,
+				Latitude:  before.Latitude + f*(after.Latitude-before.Latitude),
+				Longitude: before.Longitude + f*(after.Longitude-before.Longitude),
+				Elevation: before.Elevation + f*(after.Elevation-before.Elevation),
+			}, true
+		}
+	}
+
+	// The nearest point
+	var nearest Point
+	delay := time.Duration(-1)
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(t.points) {
+			continue
+		}
+		dd := d.Sub(t.points[j].Time)
+		if dd < 0 {
+			dd = -dd
+		}
+		if delay < 0 || dd < delay {
+			nearest, delay = t.points[j], dd
+		}
+	}
+	if delay >= 0 && delay <= t.MaxGap {
+		return nearest, true
+	}
+	return Point{}, false
+}
+
+func readGPX(r io.Reader) ([]Point, error) {
+	type gpxPoint struct {
+		Lat  float64 `xml:"lat,attr"`
+		Lon  float64 `xml:"lon,attr"`
+		Ele  float64 `xml:"ele"`
+		Time string  `xml:"time"`
+	}
+	var g struct {
+		Tracks []struct {
+			Segments []struct {
+				Points []gpxPoint `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+	err := xml.NewDecoder(r).Decode(&g)
+	if err != nil {
+		return nil, err
+	}
+	points := []Point{}
+	for _, trk := range g.Tracks {
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(p.Time))
+				if err != nil {
+					continue
+				}
+				points = append(points, Point{Time: t, Latitude: p.Lat, Longitude: p.Lon, Elevation: p.Ele})
+			}
+		}
+	}
+	return points, nil
+}
+
+func readKML(r io.Reader) ([]Point, error) {
+	d := xml.NewDecoder(r)
+	points := []Point{}
+	stack := []string{}
+	text := ""
+
+	var whens, coords []string            // of the current gx:Track
+	var placemarkWhen, placemarkAt string // of the current placemark
+
+	parent := func() string {
+		if len(stack) < 2 {
+			return ""
+		}
+		return stack[len(stack)-2]
+	}
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			text = ""
+			switch t.Name.Local {
+			case "Track":
+				whens, coords = nil, nil
+			case "Placemark":
+				placemarkWhen, placemarkAt = "", ""
+			}
+		case xml.CharData:
+			text += string(t)
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "when":
+				switch parent() {
+				case "Track":
+					whens = append(whens, text)
+				case "TimeStamp":
+					placemarkWhen = text
+				}
+			case "coord":
+				coords = append(coords, text)
+			case "coordinates":
+				if parent() == "Point" {
+					placemarkAt = strings.ReplaceAll(text, ",", " ")
+				}
+			case "Track":
+				for i := 0; i < len(whens) && i < len(coords); i++ {
+					if p, ok := kmlPoint(whens[i], coords[i]); ok {
+						points = append(points, p)
+					}
+				}
+			case "Placemark":
+				if p, ok := kmlPoint(placemarkWhen, placemarkAt); ok {
+					points = append(points, p)
+				}
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return points, nil
+}
+
+// kmlPoint reads a time and coordinates given as "longitude latitude [altitude]"
+func kmlPoint(when, coord string) (Point, bool) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(when))
+	if err != nil {
+		return Point{}, false
+	}
+	f := strings.Fields(coord)
+	if len(f) < 2 {
+		return Point{}, false
+	}
+	p := Point{Time: t}
+	p.Longitude, err = strconv.ParseFloat(f[0], 64)
+	if err != nil {
+		return Point{}, false
+	}
+	p.Latitude, err = strconv.ParseFloat(f[1], 64)
+	if err != nil {
+		return Point{}, false
+	}
+	if len(f) > 2 {
+		p.Elevation, _ = strconv.ParseFloat(f[2], 64)
+	}
+	return p, true
+}
@@ -0,0 +1,89 @@
+package geotag
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const gpxTrack = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="phone" xmlns="http://www.topografix.com/GPX/1/1">
+ <trk><name>walk</name>
+  <trkseg>
+   <trkpt lat="48.8500" lon="2.2900"><ele>30</ele><time>2023-10-06T08:00:00Z</time></trkpt>
+   <trkpt lat="48.8600" lon="2.3000"><ele>40</ele><time>2023-10-06T08:10:00Z</time></trkpt>
+   <trkpt lat="48.9000" lon="2.4000"><ele>50</ele><time>2023-10-06T09:00:00Z</time></trkpt>
+  </trkseg>
+ </trk>
+</gpx>`
+
+const kmlTrack = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+ <Document>
+  <Placemark>
+   <gx:Track>
+    <when>2023-10-07T10:00:00Z</when>
+    <when>2023-10-07T10:02:00Z</when>
+    <gx:coord>-73.9857 40.7484 10</gx:coord>
+    <gx:coord>-73.9757 40.7584 20</gx:coord>
+   </gx:Track>
+  </Placemark>
+  <Placemark>
+   <TimeStamp><when>2023-10-07T12:00:00Z</when></TimeStamp>
+   <Point><coordinates>-74.0445,40.6892,0</coordinates></Point>
+  </Placemark>
+ </Document>
+</kml>`
+
+func TestLocate(t *testing.T) {
+	tr := NewTracks(10*time.Minute, 0)
+	if err := tr.Read(strings.NewReader(gpxTrack), ".gpx"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Read(strings.NewReader(kmlTrack), ".KML"); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Len() != 6 {
+		t.Fatalf("unexpected number of points: %d", tr.Len())
+	}
+
+	tests := []struct {
+		name          string
+		date          time.Time
+		ok            bool
+		lat, lon, ele float64
+	}{
+		{name: "interpolated", date: time.Date(2023, 10, 6, 8, 5, 0, 0, time.UTC), ok: true, lat: 48.855, lon: 2.295, ele: 35},
+		{name: "exact point", date: time.Date(2023, 10, 6, 10, 10, 0, 0, time.FixedZone("", 2*3600)), ok: true, lat: 48.86, lon: 2.30, ele: 40},
+		{name: "points too far apart, nearest", date: time.Date(2023, 10, 6, 8, 15, 0, 0, time.UTC), ok: true, lat: 48.86, lon: 2.30, ele: 40},
+		{name: "points too far apart", date: time.Date(2023, 10, 6, 8, 35, 0, 0, time.UTC), ok: false},
+		{name: "before the tracks", date: time.Date(2023, 10, 6, 7, 55, 0, 0, time.UTC), ok: true, lat: 48.85, lon: 2.29, ele: 30},
+		{name: "long before the tracks", date: time.Date(2023, 10, 6, 7, 0, 0, 0, time.UTC), ok: false},
+		{name: "kml track", date: time.Date(2023, 10, 7, 10, 1, 0, 0, time.UTC), ok: true, lat: 40.7534, lon: -73.9807, ele: 15},
+		{name: "kml placemark", date: time.Date(2023, 10, 7, 12, 3, 0, 0, time.UTC), ok: true, lat: 40.6892, lon: -74.0445, ele: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := tr.Locate(tt.date)
+			if ok != tt.ok {
+				t.Fatalf("Locate() = %v, want %v", ok, tt.ok)
+			}
+			if ok && (math.Abs(p.Latitude-tt.lat) > 1e-6 || math.Abs(p.Longitude-tt.lon) > 1e-6 || math.Abs(p.Elevation-tt.ele) > 1e-6) {
+				t.Errorf("Locate() = %f %f %f, want %f %f %f", p.Latitude, p.Longitude, p.Elevation, tt.lat, tt.lon, tt.ele)
+			}
+		})
+	}
+}
+
+func TestLocateWithOffset(t *testing.T) {
+	// The camera's clock is 1 hour late
+	tr := NewTracks(10*time.Minute, time.Hour)
+	if err := tr.Read(strings.NewReader(gpxTrack), ".gpx"); err != nil {
+		t.Fatal(err)
+	}
+	p, ok := tr.Locate(time.Date(2023, 10, 6, 7, 5, 0, 0, time.UTC))
+	if !ok || math.Abs(p.Latitude-48.855) > 1e-6 {
+		t.Errorf("Locate() = %v %v", p, ok)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/simulot/immich-go/helpers/gen"
@@ -33,6 +34,7 @@ const (
 )
 
 type StackBuilder struct {
+	mut            sync.Mutex
 	dateRange      immich.DateRange // Set capture date range
 	stacks         map[Key]Stack
 	supportedMedia immich.SupportedMedia
@@ -80,6 +82,8 @@ func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate tim
 		date:     captureDate.Round(time.Minute),
 		baseName: base,
 	}
+	sb.mut.Lock()
+	defer sb.mut.Unlock()
 	s, ok := sb.stacks[k]
 	if !ok {
 		s.CoverID = id
@@ -147,6 +151,8 @@ func nexusBurst(name string) (bool, string, bool) {
 }
 
 func (sb *StackBuilder) Stacks() []Stack {
+	sb.mut.Lock()
+	defer sb.mut.Unlock()
 	keys := gen.MapFilterKeys(sb.stacks, func(i Stack) bool {
 		return len(i.IDs) > 1
 	})
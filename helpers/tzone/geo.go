@@ -0,0 +1,292 @@
+package tzone
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "time/tzdata" // the time zones are resolved offline, even without the system's database
+)
+
+/*
+	The time zone of a place is determined offline.
+
+	By default, the zone is the one of the nearest reference location of the tz database (zone.tab).
+	It's only an estimate: near the borders, the nearest reference location can be in the neighbour
+	country, like Lisbon for Badajoz in Spain. Far from any reference location, over the oceans,
+	the nautical time zone is used.
+
+	Precise boundaries can be loaded with LoadBoundaries from a GeoJSON file, like the ones
+	published by https://github.com/evansiroky/timezone-boundary-builder
+*/
+
+//go:embed zone.tab
+var zoneTab string
+
+// maxReferenceDistance is the distance in km from the nearest reference location
+// beyond which the nautical time zone is used
+const maxReferenceDistance = 1500.0
+
+type zoneReference struct {
+	lat, lon float64
+	name     string
+}
+
+type zoneBoundary struct {
+	name                           string
+	minLat, maxLat, minLon, maxLon float64
+	polygons                       [][][][2]float64 // polygons, made of rings of [lon, lat] points. The first ring is the outer one.
+}
+
+var (
+	onceReferences sync.Once
+	references     []zoneReference
+
+	boundariesLock sync.RWMutex
+	boundaries     []zoneBoundary
+
+	locations sync.Map // *time.Location by name
+)
+
+// FromLocation gives the time zone of the place, nil when the coordinates aren't valid.
+// The position 0,0 is considered as not set.
+func FromLocation(lat, lon float64) *time.Location {
+	if lat == 0 && lon == 0 || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil
+	}
+
+	boundariesLock.RLock()
+	defer boundariesLock.RUnlock()
+	if len(boundaries) > 0 {
+		for _, b := range boundaries {
+			if b.contains(lat, lon) {
+				if loc := loadLocation(b.name); loc != nil {
+					return loc
+				}
+			}
+		}
+		return nauticalZone(lon)
+	}
+
+	onceReferences.Do(func() { references = parseZoneTab(zoneTab) })
+	nearest, distance := "", math.MaxFloat64
+	for _, r := range references {
+		if d := haversine(lat, lon, r.lat, r.lon); d < distance {
+			nearest, distance = r.name, d
+		}
+	}
+	if distance <= maxReferenceDistance {
+		if loc := loadLocation(nearest); loc != nil {
+			return loc
+		}
+	}
+	return nauticalZone(lon)
+}
+
+// HasBoundaries tells if the boundaries of the time zones are loaded, so the time zones aren't estimated
+func HasBoundaries() bool {
+	boundariesLock.RLock()
+	defer boundariesLock.RUnlock()
+	return len(boundaries) > 0
+}
+
+// LoadBoundaries reads the boundaries of the time zones from a GeoJSON feature collection.
+// The name of the zone is given by the property tzid. They replace the reference locations.
+func LoadBoundaries(r io.Reader) error {
+	var fc struct {
+		Features []struct {
+			Properties struct {
+				TZID string `json:"tzid"`
+			} `json:"properties"`
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	err := json.NewDecoder(r).Decode(&fc)
+	if err != nil {
+		return fmt.Errorf("can't read the time zone boundaries: %w", err)
+	}
+
+	bs := []zoneBoundary{}
+	for _, f := range fc.Features {
+		if f.Properties.TZID == "" {
+			continue
+		}
+		b := zoneBoundary{name: f.Properties.TZID}
+		switch f.Geometry.Type {
+		case "Polygon":
+			var p [][][2]float64
+			err = json.Unmarshal(f.Geometry.Coordinates, &p)
+			b.polygons = [][][][2]float64{p}
+		case "MultiPolygon":
+			err = json.Unmarshal(f.Geometry.Coordinates, &b.polygons)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("can't read the boundaries of %s: %w", b.name, err)
+		}
+		b.setBox()
+		bs = append(bs, b)
+	}
+	if len(bs) == 0 {
+		return errors.New("no time zone boundaries in the file")
+	}
+
+	boundariesLock.Lock()
+	boundaries = bs
+	boundariesLock.Unlock()
+	return nil
+}
+
+func (b *zoneBoundary) setBox() {
+	b.minLat, b.maxLat, b.minLon, b.maxLon = 90, -90, 180, -180
+	for _, p := range b.polygons {
+		if len(p) == 0 {
+			continue
+		}
+		for _, pt := range p[0] {
+			b.minLon, b.maxLon = math.Min(b.minLon, pt[0]), math.Max(b.maxLon, pt[0])
+			b.minLat, b.maxLat = math.Min(b.minLat, pt[1]), math.Max(b.maxLat, pt[1])
+		}
+	}
+}
+
+// contains tells if the point is inside one of the polygons, but outside of their holes
+func (b *zoneBoundary) contains(lat, lon float64) bool {
+	if lat < b.minLat || lat > b.maxLat || lon < b.minLon || lon > b.maxLon {
+		return false
+	}
+	for _, p := range b.polygons {
+		if len(p) == 0 || !inRing(p[0], lat, lon) {
+			continue
+		}
+		inHole := false
+		for _, hole := range p[1:] {
+			if inRing(hole, lat, lon) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// inRing uses the ray casting algorithm
+func inRing(ring [][2]float64, lat, lon float64) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// nauticalZone gives the zone of 15° of longitude containing the place.
+// The sign of Etc/GMT zones is inverted: Etc/GMT-9 is UTC+9
+func nauticalZone(lon float64) *time.Location {
+	offset := int(math.Round(lon / 15))
+	switch {
+	case offset == 0:
+		return time.UTC
+	case offset > 0:
+		return loadLocation("Etc/GMT-" + strconv.Itoa(offset))
+	default:
+		return loadLocation("Etc/GMT+" + strconv.Itoa(-offset))
+	}
+}
+
+func loadLocation(name string) *time.Location {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// parseZoneTab reads the reference locations of the zones
+func parseZoneTab(s string) []zoneReference {
+	refs := []zoneReference{}
+	for _, l := range strings.Split(s, "\n") {
+		if strings.HasPrefix(l, "#") {
+			continue
+		}
+		fields := strings.Split(l, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		lat, lon, err := parseISO6709Coordinates(fields[1])
+		if err != nil {
+			continue
+		}
+		refs = append(refs, zoneReference{lat: lat, lon: lon, name: fields[2]})
+	}
+	return refs
+}
+
+// parseISO6709Coordinates reads coordinates like +4230+00131 or -0848+01314 or +394406-1045826
+func parseISO6709Coordinates(s string) (float64, float64, error) {
+	i := strings.IndexAny(s[1:], "+-") + 1
+	if i < 1 {
+		return 0, 0, fmt.Errorf("invalid coordinates: %q", s)
+	}
+	lat, err := parseDegrees(s[:i], 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	lon, err := parseDegrees(s[i:], 3)
+	return lat, lon, err
+}
+
+// parseDegrees reads ±DDMM or ±DDMMSS, with digits for the degrees
+func parseDegrees(s string, digits int) (float64, error) {
+	if len(s) != 1+digits+2 && len(s) != 1+digits+4 {
+		return 0, fmt.Errorf("invalid coordinate: %q", s)
+	}
+	v := 0.0
+	for i, div := 1, 1.0; i < len(s); div *= 60 {
+		n := digits
+		if i > 1 {
+			n = 2
+		}
+		d, err := strconv.Atoi(s[i : i+n])
+		if err != nil {
+			return 0, fmt.Errorf("invalid coordinate: %q", s)
+		}
+		v += float64(d) / div
+		i += n
+	}
+	if s[0] == '-' {
+		v = -v
+	}
+	return v, nil
+}
+
+// haversine gives the distance in km between two points
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,82 @@
+package tzone
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{name: "Paris", lat: 48.8577, lon: 2.295, want: "Europe/Paris"},
+		{name: "New York", lat: 40.7484, lon: -73.9857, want: "America/New_York"},
+		{name: "Tokyo", lat: 35.6586, lon: 139.7454, want: "Asia/Tokyo"},
+		{name: "Sydney", lat: -33.8688, lon: 151.2093, want: "Australia/Sydney"},
+		{name: "South Atlantic", lat: -45, lon: -20, want: "Etc/GMT+1"},
+		{name: "Saint Helena", lat: -15.9, lon: -5.7, want: "Atlantic/St_Helena"},
+		{name: "Mid Atlantic", lat: -25, lon: -25, want: "Etc/GMT+2"},
+		{name: "not set", lat: 0, lon: 0, want: ""},
+		{name: "invalid", lat: 91, lon: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if loc := FromLocation(tt.lat, tt.lon); loc != nil {
+				got = loc.String()
+			}
+			if got != tt.want {
+				t.Errorf("FromLocation(%f, %f) = %q, want %q", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseISO6709Coordinates(t *testing.T) {
+	lat, lon, err := parseISO6709Coordinates("+394421-1045903")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lat < 39.7391 || lat > 39.7392 || lon < -104.9842 || lon > -104.9841 {
+		t.Errorf("unexpected coordinates: %f %f", lat, lon)
+	}
+}
+
+const boundariesGeoJSON = `{"type":"FeatureCollection","features":[
+{"type":"Feature","properties":{"tzid":"Europe/Madrid"},"geometry":{"type":"Polygon","coordinates":[[[-7,36],[3,36],[3,44],[-7,44],[-7,36]]]}},
+{"type":"Feature","properties":{"tzid":"Europe/Lisbon"},"geometry":{"type":"MultiPolygon","coordinates":[[[[-10,36],[-7,36],[-7,42],[-10,42],[-10,36]]]]}}
+]}`
+
+func TestLoadBoundaries(t *testing.T) {
+	err := LoadBoundaries(strings.NewReader(boundariesGeoJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		boundariesLock.Lock()
+		boundaries = nil
+		boundariesLock.Unlock()
+	}()
+	if !HasBoundaries() {
+		t.Errorf("HasBoundaries() = false after LoadBoundaries()")
+	}
+
+	// Badajoz is closer to Lisbon than to Madrid
+	if loc := FromLocation(38.8794, -6.9707); loc == nil || loc.String() != "Europe/Madrid" {
+		t.Errorf("unexpected zone for Badajoz: %v", loc)
+	}
+	if loc := FromLocation(38.7223, -9.1393); loc == nil || loc.String() != "Europe/Lisbon" {
+		t.Errorf("unexpected zone for Lisbon: %v", loc)
+	}
+	// Outside of the boundaries
+	loc := FromLocation(30, 30)
+	if loc == nil {
+		t.Fatal("expecting a nautical zone")
+	}
+	if _, offset := time.Date(2023, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != 2*3600 {
+		t.Errorf("unexpected offset: %d", offset)
+	}
+}
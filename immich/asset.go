@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
 	"net/url"
 	"path"
@@ -37,114 +39,158 @@ func formatDuration(duration time.Duration) string {
 func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetFile) (AssetResponse, error) {
 	var ar AssetResponse
 	mtype := ic.TypeFromExt(path.Ext(la.FileName))
+	if mtype != TypeVideo && mtype != TypeImage {
+		// Google's motion photos .MP files get a title with the actual extension
+		mtype = ic.TypeFromExt(path.Ext(la.Title))
+	}
 	switch mtype {
 	case "video", "image":
 	default:
 		return ar, fmt.Errorf("type file not supported: %s", path.Ext(la.FileName))
 	}
 
-	f, err := la.Open()
-	if err != nil {
-		return ar, (err)
-	}
-
-	body, pw := io.Pipe()
-	m := multipart.NewWriter(pw)
+	err := ic.newServerCall(ctx, "AssetUpload").
+		do(ic.uploadRequest(la, mtype), responseJSON(&ar))
 
-	go func() {
-		defer func() {
-			m.Close()
-			pw.Close()
-		}()
-		s, err := f.Stat()
-		if err != nil {
-			return
-		}
-		assetType := strings.ToUpper(mtype)
-		ext := path.Ext(la.Title)
-		if strings.TrimSuffix(la.Title, ext) == "" {
-			la.Title = "No Name" + ext // fix #88, #128
-		}
+	return ar, err
+}
 
-		err = m.WriteField("deviceAssetId", fmt.Sprintf("%s-%d", path.Base(la.Title), s.Size()))
-		if err != nil {
-			return
+// uploadRequest builds the multipart request for uploading the asset.
+// The body is built again from the beginning of the file when the request is retried.
+func (ic *ImmichClient) uploadRequest(la *browser.LocalAssetFile, mtype string) requestFunction {
+	var (
+		body *io.PipeReader
+		done chan struct{}
+	)
+	return func(sc *serverCall) *http.Request {
+		if sc.err != nil {
+			return nil
 		}
-		err = m.WriteField("deviceId", ic.DeviceUUID)
-		if err != nil {
-			return
+		if done != nil {
+			// The previous attempt has consumed the file, wait its end and start again
+			body.Close()
+			<-done
+			_ = la.Close()
 		}
-		err = m.WriteField("assetType", assetType)
-		if err != nil {
-			return
+		f, err := la.Open()
+		if sc.joinError(err) != nil {
+			return nil
 		}
-		err = m.WriteField("fileCreatedAt", la.DateTaken.Format(time.RFC3339))
-		if err != nil {
-			return
-		}
-		err = m.WriteField("fileModifiedAt", s.ModTime().Format(time.RFC3339))
-		if err != nil {
-			return
-		}
-		err = m.WriteField("isFavorite", myBool(la.Favorite).String())
-		if err != nil {
-			return
-		}
-		err = m.WriteField("fileExtension", ext)
-		if err != nil {
-			return
-		}
-		err = m.WriteField("duration", formatDuration(0))
-		if err != nil {
-			return
+
+		var pw *io.PipeWriter
+		body, pw = io.Pipe()
+		done = make(chan struct{})
+		m := multipart.NewWriter(pw)
+
+		go func() {
+			defer close(done)
+			err := ic.writeMultipart(m, la, f, mtype)
+			if err == nil {
+				err = m.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+
+		opts := []serverRequestOption{setContentType(m.FormDataContentType()), setAcceptJSON(), setBody(body), setRetryable()}
+		if la.Checksum != "" {
+			// Let the server detect duplicates before receiving the file
+			opts = append(opts, setHeader("x-immich-checksum", la.Checksum))
 		}
-		err = m.WriteField("isReadOnly", "false")
+		return sc.request(http.MethodPost, sc.ic.endPoint+"/asset/upload", opts...)
+	}
+}
+
+func (ic *ImmichClient) writeMultipart(m *multipart.Writer, la *browser.LocalAssetFile, f fs.File, mtype string) error {
+	s, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	assetType := strings.ToUpper(mtype)
+	ext := path.Ext(la.Title)
+	if strings.TrimSuffix(la.Title, ext) == "" {
+		la.Title = "No Name" + ext // fix #88, #128
+	}
+
+	err = m.WriteField("deviceAssetId", fmt.Sprintf("%s-%d", path.Base(la.Title), s.Size()))
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("deviceId", ic.DeviceUUID)
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("assetType", assetType)
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("fileCreatedAt", la.DateTaken.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("fileModifiedAt", s.ModTime().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("isFavorite", myBool(la.Favorite).String())
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("fileExtension", ext)
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("duration", formatDuration(0))
+	if err != nil {
+		return err
+	}
+	err = m.WriteField("isReadOnly", "false")
+	if err != nil {
+		return err
+	}
+	if la.LivePhotoID != "" {
+		err = m.WriteField("livePhotoVideoId", la.LivePhotoID)
 		if err != nil {
-			return
+			return err
 		}
-		// m.WriteField("isArchived", myBool(la.Archived).String()) // Not supported by the api
-		h := textproto.MIMEHeader{}
+	}
+	// m.WriteField("isArchived", myBool(la.Archived).String()) // Not supported by the api
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes("assetData"), escapeQuotes(path.Base(la.Title))))
+	h.Set("Content-Type", mtype)
+
+	part, err := m.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	if err != nil {
+		return err
+	}
+
+	if la.SideCar != nil {
+		scName := path.Base(la.FileName) + ".xmp"
 		h.Set("Content-Disposition",
 			fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
-				escapeQuotes("assetData"), escapeQuotes(path.Base(la.Title))))
-		h.Set("Content-Type", mtype)
+				escapeQuotes("sidecarData"), escapeQuotes(scName)))
+		h.Set("Content-Type", "application/xml")
 
 		part, err := m.CreatePart(h)
 		if err != nil {
-			return
+			return err
 		}
-		_, err = io.Copy(part, f)
+		sc, err := la.SideCar.Open(la.FSys, la.SideCar.FileName)
 		if err != nil {
-			return
+			return err
 		}
-
-		if la.SideCar != nil {
-			scName := path.Base(la.FileName) + ".xmp"
-			h.Set("Content-Disposition",
-				fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
-					escapeQuotes("sidecarData"), escapeQuotes(scName)))
-			h.Set("Content-Type", "application/xml")
-
-			part, err := m.CreatePart(h)
-			if err != nil {
-				return
-			}
-			sc, err := la.SideCar.Open(la.FSys, la.SideCar.FileName)
-			if err != nil {
-				return
-			}
-			defer sc.Close()
-			_, err = io.Copy(part, sc)
-			if err != nil {
-				return
-			}
+		defer sc.Close()
+		_, err = io.Copy(part, sc)
+		if err != nil {
+			return err
 		}
-	}()
-
-	err = ic.newServerCall(ctx, "AssetUpload").
-		do(post("/asset/upload", m.FormDataContentType(), setAcceptJSON(), setBody(body)), responseJSON(&ar))
-
-	return ar, err
+	}
+	return nil
 }
 
 var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
@@ -193,7 +239,7 @@ func (ic *ImmichClient) GetAssetByID(ctx context.Context, id string) (*Asset, er
 		ID        string `json:"id"`
 	}{WithExif: true, IsVisible: true, ID: id}
 	r := Asset{}
-	err := ic.newServerCall(ctx, "GetAssetByID").do(post("/search/metadata", "application/json", setAcceptJSON(), setJSONBody(body)), responseJSON(&r))
+	err := ic.newServerCall(ctx, "GetAssetByID").do(post("/search/metadata", "application/json", setAcceptJSON(), setJSONBody(body), setRetryable()), responseJSON(&r))
 	return &r, err
 }
 
@@ -224,21 +270,35 @@ func (ic *ImmichClient) UpdateAssets(ctx context.Context, ids []string,
 	return ic.newServerCall(ctx, "updateAssets").do(put("/asset", setJSONBody(param)))
 }
 
+// AssetUpdate gives the properties of the asset to change, the nil and empty values are left unchanged
+type AssetUpdate struct {
+	IsArchived       *bool    `json:"isArchived,omitempty"`
+	IsFavorite       *bool    `json:"isFavorite,omitempty"`
+	DateTimeOriginal string   `json:"dateTimeOriginal,omitempty"` // RFC3339 date, with the offset of the capture's time zone
+	Latitude         *float64 `json:"latitude,omitempty"`
+	Longitude        *float64 `json:"longitude,omitempty"`
+	Description      *string  `json:"description,omitempty"`
+}
+
 func (ic *ImmichClient) UpdateAsset(ctx context.Context, id string, a *browser.LocalAssetFile) (*Asset, error) {
-	type updAsset struct {
-		IsArchived  bool    `json:"isArchived"`
-		IsFavorite  bool    `json:"isFavorite"`
-		Latitude    float64 `json:"latitude,omitempty"`
-		Longitude   float64 `json:"longitude,omitempty"`
-		Description string  `json:"description,omitempty"`
-	}
-	param := updAsset{
-		Description: a.Description,
-		IsArchived:  a.Archived,
-		IsFavorite:  a.Favorite,
-		Latitude:    a.Latitude,
-		Longitude:   a.Longitude,
+	param := AssetUpdate{
+		IsArchived: &a.Archived,
+		IsFavorite: &a.Favorite,
+	}
+	if a.Latitude != 0 {
+		param.Latitude = &a.Latitude
+	}
+	if a.Longitude != 0 {
+		param.Longitude = &a.Longitude
 	}
+	if a.Description != "" {
+		param.Description = &a.Description
+	}
+	return ic.UpdateAssetFields(ctx, id, param)
+}
+
+// UpdateAssetFields changes the given properties of the asset
+func (ic *ImmichClient) UpdateAssetFields(ctx context.Context, id string, param AssetUpdate) (*Asset, error) {
 	r := Asset{}
 	err := ic.newServerCall(ctx, "updateAsset").do(put("/asset/"+id, setJSONBody(param)), responseJSON(&r))
 	return &r, err
@@ -252,3 +312,36 @@ func (ic *ImmichClient) StackAssets(ctx context.Context, coverID string, ids []s
 
 	return ic.UpdateAssets(ctx, ids, cover.IsArchived, cover.IsFavorite, cover.ExifInfo.Latitude, cover.ExifInfo.Longitude, false, coverID)
 }
+
+type BulkCheckItem struct {
+	ID       string `json:"id"`       // Identifier of the item in the request
+	Checksum string `json:"checksum"` // SHA-1 of the file, base64 or hex encoded
+}
+
+type BulkCheckResult struct {
+	ID        string `json:"id"`                // Identifier of the item in the request
+	Action    string `json:"action"`            // accept or reject
+	Reason    string `json:"reason,omitempty"`  // duplicate or unsupported-format
+	AssetID   string `json:"assetId,omitempty"` // ID of the server's asset with the same checksum
+	IsTrashed bool   `json:"isTrashed,omitempty"`
+}
+
+// CheckBulkUpload asks the server which files are already present, based on their checksum
+func (ic *ImmichClient) CheckBulkUpload(ctx context.Context, items []BulkCheckItem) ([]BulkCheckResult, error) {
+	req := struct {
+		Assets []BulkCheckItem `json:"assets"`
+	}{Assets: items}
+	resp := struct {
+		Results []BulkCheckResult `json:"results"`
+	}{}
+	err := ic.newServerCall(ctx, "CheckBulkUpload").do(post("/asset/bulk-upload-check", "application/json", setAcceptJSON(), setJSONBody(req), setRetryable()), responseJSON(&resp))
+	return resp.Results, err
+}
+
+// DownloadAsset returns a reader on the original file of the asset.
+// The caller must close the reader.
+func (ic *ImmichClient) DownloadAsset(ctx context.Context, id string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := ic.newServerCall(ctx, "DownloadAsset").do(post("/download/asset/"+id, "application/json", setRetryable()), responseBody(&rc))
+	return rc, err
+}
@@ -0,0 +1,225 @@
+// Package assetcache keeps a local copy of the list of the server's assets.
+//
+// The list of the assets of a large library takes minutes to be fetched. The copy is kept in a file
+// of the user's cache folder, named after the server and the user. At each use, the copy is refreshed
+// with the assets changed since the last synchronization, and the assets trashed or deleted
+// from the server are removed from the copy.
+//
+// The synchronization is based on the date of the last change of the assets, given by the server.
+// The whole list is fetched again when the server can't tell which assets have been deleted.
+package assetcache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// version of the cache file, a file of another version is ignored
+const version = 2
+
+// overlap is the period before the last known change whose assets are fetched again,
+// to get the assets changed at the same time, but not yet visible at the previous synchronization
+const overlap = time.Minute
+
+// Cache is an immich client that gives the server's assets from the local copy
+type Cache struct {
+	immich.ImmichInterface
+	file string
+
+	lock      sync.Mutex
+	loaded    bool
+	assets    map[string]*immich.Asset
+	order     []string  // IDs of the assets, in the order of their reception
+	watermark time.Time // date of the last change known, given by the server
+}
+
+// cacheFile is the content of the cache file
+type cacheFile struct {
+	Version   int
+	Watermark time.Time
+	Assets    []*immich.Asset
+}
+
+// New gives a client using the copy of the server's assets of the user
+func New(ic immich.ImmichInterface, server, userID string) (*Cache, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum([]byte(server + "\n" + userID))
+	name := filepath.Join(dir, "github.com/simulot/immich-go", "assets-"+hex.EncodeToString(h[:8])+".gob")
+	return NewWithFile(ic, name), nil
+}
+
+// NewWithFile gives a client using the copy of the server's assets kept in the file
+func NewWithFile(ic immich.ImmichInterface, file string) *Cache {
+	return &Cache{
+		ImmichInterface: ic,
+		file:            file,
+		assets:          map[string]*immich.Asset{},
+	}
+}
+
+// File gives the name of the cache file
+func (c *Cache) File() string {
+	return c.file
+}
+
+// GetAllAssetsWithFilter calls the filter with a copy of each asset, after the synchronization of the cache
+func (c *Cache) GetAllAssetsWithFilter(ctx context.Context, filter func(*immich.Asset)) error {
+	l, err := c.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range l {
+		filter(a)
+	}
+	return nil
+}
+
+// GetAllAssets gives a copy of the assets, after the synchronization of the cache
+func (c *Cache) GetAllAssets(ctx context.Context) ([]*immich.Asset, error) {
+	return c.list(ctx)
+}
+
+func (c *Cache) list(ctx context.Context) ([]*immich.Asset, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err := c.sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l := make([]*immich.Asset, 0, len(c.order))
+	for _, id := range c.order {
+		a := *c.assets[id]
+		l = append(l, &a)
+	}
+	return l, nil
+}
+
+// sync gets the changes from the server, and saves the cache
+func (c *Cache) sync(ctx context.Context) error {
+	if !c.loaded {
+		// An unreadable cache is fetched again
+		_ = c.load()
+		c.loaded = true
+	}
+
+	full := c.watermark.IsZero()
+	if !full {
+		ids, needsFullSync, err := c.ImmichInterface.GetDeletedAssets(ctx, c.watermark)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil || needsFullSync:
+			// The server can't tell which assets have been deleted
+			full = true
+		default:
+			for _, id := range ids {
+				delete(c.assets, id)
+			}
+		}
+	}
+
+	var after time.Time
+	if full {
+		c.assets = map[string]*immich.Asset{}
+		c.order = nil
+		c.watermark = time.Time{}
+	} else {
+		after = c.watermark.Add(-overlap)
+	}
+
+	err := c.ImmichInterface.GetAssetsUpdatedAfter(ctx, after, c.put)
+	if err != nil {
+		// The next synchronization will start again from the same point
+		c.loaded = false
+		return err
+	}
+	c.compact()
+	return c.save()
+}
+
+// put records an asset received from the server
+func (c *Cache) put(a *immich.Asset) {
+	if a.UpdatedAt.After(c.watermark) {
+		c.watermark = a.UpdatedAt.Time
+	}
+	if a.IsTrashed {
+		delete(c.assets, a.ID)
+		return
+	}
+	if _, ok := c.assets[a.ID]; !ok {
+		c.order = append(c.order, a.ID)
+	}
+	c.assets[a.ID] = a
+}
+
+// compact removes the IDs of the deleted assets from the order
+func (c *Cache) compact() {
+	order := c.order[:0]
+	seen := map[string]bool{}
+	for _, id := range c.order {
+		if _, ok := c.assets[id]; ok && !seen[id] {
+			order = append(order, id)
+			seen[id] = true
+		}
+	}
+	c.order = order
+}
+
+func (c *Cache) load() error {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var cf cacheFile
+	err = gob.NewDecoder(f).Decode(&cf)
+	if err != nil {
+		return err
+	}
+	if cf.Version != version {
+		return errors.New("the version of the cache file isn't supported")
+	}
+	for _, a := range cf.Assets {
+		c.assets[a.ID] = a
+		c.order = append(c.order, a.ID)
+	}
+	c.watermark = cf.Watermark
+	return nil
+}
+
+// save writes the cache into a temporary file that replaces the previous one
+func (c *Cache) save() error {
+	err := os.MkdirAll(filepath.Dir(c.file), 0o700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+".*")
+	if err != nil {
+		return err
+	}
+	cf := cacheFile{Version: version, Watermark: c.watermark}
+	for _, id := range c.order {
+		cf.Assets = append(cf.Assets, c.assets[id])
+	}
+	err = gob.NewEncoder(f).Encode(cf)
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Rename(f.Name(), c.file)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package assetcache_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/assetcache"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+)
+
+// counter counts the assets received from the server
+type counter struct {
+	immich.ImmichInterface
+	received int
+}
+
+func (c *counter) GetAssetsUpdatedAfter(ctx context.Context, after time.Time, filter func(*immich.Asset)) error {
+	return c.ImmichInterface.GetAssetsUpdatedAfter(ctx, after, func(a *immich.Asset) {
+		c.received++
+		filter(a)
+	})
+}
+
+func names(t *testing.T, c *assetcache.Cache) []string {
+	l := []string{}
+	err := c.GetAllAssetsWithFilter(context.Background(), func(a *immich.Asset) {
+		l = append(l, a.OriginalFileName+":"+a.ExifInfo.Description)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(l)
+	return l
+}
+
+func TestCache(t *testing.T) {
+	s := fakeimmich.New()
+	defer s.Close()
+	s.PageSize = 2
+
+	old := time.Now().Add(-time.Hour)
+	ids := map[string]string{}
+	for _, n := range []string{"A", "B", "C", "D"} {
+		ids[n] = s.AddAsset(fakeimmich.Asset{OriginalFileName: n, Content: []byte(n), UpdatedAt: old.Add(-time.Hour)})
+	}
+	// The last change known is fetched again at each run
+	s.AddAsset(fakeimmich.Asset{OriginalFileName: "Z", Content: []byte("Z"), UpdatedAt: old})
+	ic, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "assets.gob")
+
+	// First run: the whole list is fetched
+	cnt := &counter{ImmichInterface: ic}
+	c := assetcache.NewWithFile(cnt, file)
+	if got, want := names(t, c), []string{"A:", "B:", "C:", "D:", "Z:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first run: got %v, want %v", got, want)
+	}
+	if cnt.received != 5 {
+		t.Errorf("first run: %d assets received, want 5", cnt.received)
+	}
+
+	// Changes on the server between two runs
+	desc := "changed"
+	if _, err = ic.UpdateAssetFields(ctx, ids["A"], immich.AssetUpdate{Description: &desc}); err != nil {
+		t.Fatal(err)
+	}
+	if err = ic.DeleteAssets(ctx, []string{ids["B"]}, false); err != nil {
+		t.Fatal(err)
+	}
+	s.RemoveAsset(ids["C"])
+	s.AddAsset(fakeimmich.Asset{OriginalFileName: "E", Content: []byte("E")})
+
+	// Second run: only the changes are fetched
+	cnt = &counter{ImmichInterface: ic}
+	c = assetcache.NewWithFile(cnt, file)
+	if got, want := names(t, c), []string{"A:changed", "D:", "E:", "Z:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second run: got %v, want %v", got, want)
+	}
+	if cnt.received != 4 {
+		t.Errorf("second run: %d assets received, want 4", cnt.received)
+	}
+	if n := s.Calls(http.MethodGet, "/audit/deletes"); n != 1 {
+		t.Errorf("audit called %d times, want 1", n)
+	}
+
+	// The server can't give the deleted assets: the whole list is fetched again
+	s.FailNext(http.MethodGet, "/audit/deletes", http.StatusNotFound, 1)
+	cnt = &counter{ImmichInterface: ic}
+	c = assetcache.NewWithFile(cnt, file)
+	if got, want := names(t, c), []string{"A:changed", "D:", "E:", "Z:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("third run: got %v, want %v", got, want)
+	}
+	// The trashed asset is received too
+	if cnt.received != 5 {
+		t.Errorf("third run: %d assets received, want 5", cnt.received)
+	}
+}
+
+func TestCacheFailure(t *testing.T) {
+	s := fakeimmich.New()
+	defer s.Close()
+	s.AddAsset(fakeimmich.Asset{OriginalFileName: "A", Content: []byte("A")})
+	ic, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "assets.gob")
+
+	// A single fetcher: the calls of concurrent ones are cancelled after the failure, before reaching the server
+	ic.PageFetchers = 1
+	s.FailNext(http.MethodPost, "/search/metadata", http.StatusBadRequest, 1)
+	c := assetcache.NewWithFile(ic, file)
+	if _, err = c.GetAllAssets(context.Background()); err == nil {
+		t.Fatal("GetAllAssets() should fail")
+	}
+	if got, want := names(t, c), []string{"A:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type TooManyInternalError struct {
@@ -22,10 +25,11 @@ func (e TooManyInternalError) Is(target error) bool {
 
 // serverCall permit to decorate request and responses in one line
 type serverCall struct {
-	endPoint string
-	ic       *ImmichClient
-	err      error
-	ctx      context.Context
+	endPoint  string
+	ic        *ImmichClient
+	err       error
+	ctx       context.Context
+	retryable bool // the request can be sent again safely
 }
 
 // callError represents errors returned by the server
@@ -49,6 +53,10 @@ func (ce callError) Is(target error) bool {
 	return ok
 }
 
+func (ce callError) Unwrap() error {
+	return ce.err
+}
+
 func (ce callError) Error() string {
 	b := strings.Builder{}
 	b.WriteString(ce.endPoint)
@@ -162,26 +170,63 @@ func put(url string, opts ...serverRequestOption) requestFunction {
 	}
 }
 
+// do sends the request built by fnRequest, and process the response with the options.
+//
+// Idempotent requests (GET, PUT, DELETE) and requests marked with setRetryable are sent again
+// when the server is temporarily unavailable. The request is rebuilt by fnRequest on each attempt.
+// The delay between attempts grows exponentially, and follows the server's Retry-After header when present.
 func (sc *serverCall) do(fnRequest requestFunction, opts ...serverResponseOption) error {
 	var (
+		req  *http.Request
 		resp *http.Response
 		err  error
 	)
 
-	req := fnRequest(sc)
-	if sc.err != nil || req == nil {
-		return sc.Err(req, nil, nil)
-	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			delay := sc.ic.retryDelay(attempt, resp)
+			if resp != nil && resp.Body != nil {
+				resp.Body.Close()
+			}
+			select {
+			case <-sc.ctx.Done():
+				_ = sc.joinError(sc.ctx.Err())
+				return sc.Err(req, nil, nil)
+			case <-time.After(delay):
+			}
+		}
 
-	if sc.ic.APITrace /* && req.Header.Get("Content-Type") == "application/json"*/ {
-		_ = sc.joinError(setTraceJSONRequest()(sc, req))
-	}
+		req = fnRequest(sc)
+		if sc.err != nil || req == nil {
+			return sc.Err(req, nil, nil)
+		}
+
+		if sc.ic.APITrace /* && req.Header.Get("Content-Type") == "application/json"*/ {
+			_ = sc.joinError(setTraceJSONRequest()(sc, req))
+		}
+
+		resp, err = sc.ic.client.Do(req)
+		canRetry := attempt < sc.ic.Retries && sc.canRetry(req)
+
+		// any non nil error must be returned
+		if err != nil {
+			if canRetry && sc.ctx.Err() == nil {
+				resp = nil
+				continue
+			}
+			_ = sc.joinError(err)
+			return sc.Err(req, nil, nil)
+		}
 
-	resp, err = sc.ic.client.Do(req)
-	// any non nil error must be returned
-	if err != nil {
-		_ = sc.joinError(err)
-		return sc.Err(req, nil, nil)
+		if isTemporaryStatus(resp.StatusCode) {
+			if canRetry {
+				continue
+			}
+			if attempt > 0 {
+				_ = sc.joinError(TooManyInternalError{fmt.Errorf("giving up after %d attempts", attempt+1)})
+			}
+		}
+		break
 	}
 
 	// Any StatusCode above 300 denote a problem
@@ -209,8 +254,71 @@ func (sc *serverCall) do(fnRequest requestFunction, opts ...serverResponseOption
 	return nil
 }
 
+// canRetry tells if the request can be sent again
+func (sc *serverCall) canRetry(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodHead:
+		return true
+	}
+	return sc.retryable
+}
+
+// isTemporaryStatus tells if the status code denotes a transient server problem
+func isTemporaryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay gives the delay before the given attempt.
+// The delay doubles at each attempt, with a random jitter, and is capped by MaxRetriesDelay.
+// The server's Retry-After header is honored when it asks for a longer delay.
+func (ic *ImmichClient) retryDelay(attempt int, resp *http.Response) time.Duration {
+	delay := ic.RetriesDelay
+	for i := 1; i < attempt && (ic.MaxRetriesDelay <= 0 || delay < ic.MaxRetriesDelay); i++ {
+		delay *= 2
+	}
+	if ic.MaxRetriesDelay > 0 && delay > ic.MaxRetriesDelay {
+		delay = ic.MaxRetriesDelay
+	}
+	if delay > 0 {
+		// jitter: between 50% and 100% of the delay
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	if resp != nil {
+		if after := retryAfter(resp.Header.Get("Retry-After")); after > delay {
+			delay = after
+		}
+	}
+	return delay
+}
+
+// retryAfter decodes the Retry-After header given in seconds or as an HTTP date
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(h); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
 type serverRequestOption func(sc *serverCall, req *http.Request) error
 
+// setRetryable marks the request as safe to be sent again, even if its method isn't idempotent
+func setRetryable() serverRequestOption {
+	return func(sc *serverCall, req *http.Request) error {
+		sc.retryable = true
+		return nil
+	}
+}
+
 func setBody(body io.ReadCloser) serverRequestOption {
 	return func(sc *serverCall, req *http.Request) error {
 		req.Body = body
@@ -249,6 +357,13 @@ func setJSONBody(object any) serverRequestOption {
 	}
 }
 
+func setHeader(key, value string) serverRequestOption {
+	return func(sc *serverCall, req *http.Request) error {
+		req.Header.Set(key, value)
+		return nil
+	}
+}
+
 func setContentType(cType string) serverRequestOption {
 	return func(sc *serverCall, req *http.Request) error {
 		req.Header.Set("Content-Type", cType)
@@ -274,6 +389,17 @@ func responseJSON[T any](object *T) serverResponseOption {
 	}
 }
 
+// responseBody gives the response's body to the caller, who must close it
+func responseBody(rc *io.ReadCloser) serverResponseOption {
+	return func(sc *serverCall, resp *http.Response) error {
+		if resp == nil || resp.Body == nil {
+			return errors.New("can't get the body of a nil response")
+		}
+		*rc = resp.Body
+		return nil
+	}
+}
+
 /*
 func responseAccumulateJSON[T any](acc *[]T) serverResponseOption {
 	return func(sc *serverCall, resp *http.Response) error {
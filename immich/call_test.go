@@ -1,10 +1,18 @@
 package immich
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/psanford/memfs"
+	"github.com/simulot/immich-go/browser"
 )
 
 type testServer struct {
@@ -89,3 +97,203 @@ func TestCall(t *testing.T) {
 		})
 	}
 }
+
+// flakyServer fails the given number of requests before responding correctly
+type flakyServer struct {
+	failures   int
+	failStatus int
+	retryAfter string
+	calls      int
+	bodies     []string
+}
+
+func (fs *flakyServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	fs.calls++
+	b, _ := io.ReadAll(req.Body)
+	fs.bodies = append(fs.bodies, string(b))
+	if fs.calls <= fs.failures {
+		if fs.retryAfter != "" {
+			resp.Header().Set("Retry-After", fs.retryAfter)
+		}
+		resp.WriteHeader(fs.failStatus)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+	_, _ = resp.Write([]byte(`{"id":"1234"}`))
+}
+
+func TestCallRetries(t *testing.T) {
+	tt := []struct {
+		name          string
+		requestFn     requestFunction
+		server        flakyServer
+		expectedErr   bool
+		expectedCalls int
+		tooMany       bool
+	}{
+		{
+			name:          "get, success after retries",
+			requestFn:     get("/assets", setAcceptJSON()),
+			server:        flakyServer{failures: 2, failStatus: http.StatusServiceUnavailable},
+			expectedCalls: 3,
+		},
+		{
+			name:          "get, too many errors",
+			requestFn:     get("/assets", setAcceptJSON()),
+			server:        flakyServer{failures: 10, failStatus: http.StatusBadGateway},
+			expectedErr:   true,
+			expectedCalls: 4,
+			tooMany:       true,
+		},
+		{
+			name:          "get, no retry on bad request",
+			requestFn:     get("/assets", setAcceptJSON()),
+			server:        flakyServer{failures: 10, failStatus: http.StatusBadRequest},
+			expectedErr:   true,
+			expectedCalls: 1,
+		},
+		{
+			name:          "post, not retried",
+			requestFn:     post("/album", "application/json", setAcceptJSON(), setJSONBody(struct{ Name string }{Name: "test"})),
+			server:        flakyServer{failures: 1, failStatus: http.StatusServiceUnavailable},
+			expectedErr:   true,
+			expectedCalls: 1,
+		},
+		{
+			name:          "post, retryable",
+			requestFn:     post("/search/metadata", "application/json", setAcceptJSON(), setJSONBody(struct{ Name string }{Name: "test"}), setRetryable()),
+			server:        flakyServer{failures: 1, failStatus: http.StatusTooManyRequests, retryAfter: "0"},
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tst := range tt {
+		t.Run(tst.name, func(t *testing.T) {
+			server := httptest.NewServer(&tst.server)
+			defer server.Close()
+			ic, err := NewImmichClient(server.URL, "1234", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ic.Retries = 3
+			ic.RetriesDelay = time.Millisecond
+			r := map[string]string{}
+			err = ic.newServerCall(context.Background(), tst.name).do(tst.requestFn, responseJSON(&r))
+			if tst.expectedErr != (err != nil) {
+				t.Errorf("unexpected error condition: %v, %v", tst.expectedErr, err)
+			}
+			if tst.tooMany && !errors.Is(err, &TooManyInternalError{}) {
+				t.Errorf("expected a TooManyInternalError, got: %v", err)
+			}
+			if tst.server.calls != tst.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tst.expectedCalls, tst.server.calls)
+			}
+			for i := 1; i < len(tst.server.bodies); i++ {
+				if tst.server.bodies[i] != tst.server.bodies[0] {
+					t.Errorf("body of the call %d differs from the first one", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	fsys := memfs.New()
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	if err := fsys.WriteFile("photo.jpg", content, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	server := flakyServer{failures: 1, failStatus: http.StatusBadGateway}
+	ts := httptest.NewServer(&server)
+	defer ts.Close()
+	ic, err := NewImmichClient(ts.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.RetriesDelay = time.Millisecond
+	ic.supportedMediaTypes = DefaultSupportedMedia
+
+	la := &browser.LocalAssetFile{
+		FSys:      fsys,
+		FileName:  "photo.jpg",
+		Title:     "photo.jpg",
+		FileSize:  len(content),
+		DateTaken: time.Date(2023, 10, 1, 10, 15, 0, 0, time.UTC),
+	}
+	defer la.Close()
+
+	// Read the beginning of the file, like the metadata reader does
+	r, err := la.PartialSourceReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(r, make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := ic.AssetUpload(context.Background(), la)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.ID != "1234" {
+		t.Errorf("unexpected response: %#v", ar)
+	}
+	if server.calls != 2 {
+		t.Fatalf("expected 2 calls, got %d", server.calls)
+	}
+	for i, b := range server.bodies {
+		if !bytes.Contains([]byte(b), content) {
+			t.Errorf("the body of the call %d doesn't contain the full file", i+1)
+		}
+	}
+}
+
+func TestUpdateAssetFields(t *testing.T) {
+	tt := []struct {
+		name     string
+		fn       func(ic *ImmichClient) error
+		expected string
+	}{
+		{
+			name: "date and location",
+			fn: func(ic *ImmichClient) error {
+				lat, long := 48.8577, 2.295
+				_, err := ic.UpdateAssetFields(context.Background(), "1234", AssetUpdate{
+					DateTimeOriginal: "2023-10-06T08:30:00+02:00",
+					Latitude:         &lat,
+					Longitude:        &long,
+				})
+				return err
+			},
+			expected: `{"dateTimeOriginal":"2023-10-06T08:30:00+02:00","latitude":48.8577,"longitude":2.295}`,
+		},
+		{
+			name: "local file",
+			fn: func(ic *ImmichClient) error {
+				_, err := ic.UpdateAsset(context.Background(), "1234", &browser.LocalAssetFile{Description: "the description"})
+				return err
+			},
+			expected: `{"isArchived":false,"isFavorite":false,"description":"the description"}`,
+		},
+	}
+	for _, tst := range tt {
+		t.Run(tst.name, func(t *testing.T) {
+			fs := &flakyServer{}
+			server := httptest.NewServer(fs)
+			defer server.Close()
+			ic, err := NewImmichClient(server.URL, "1234", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tst.fn(ic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fs.bodies) != 1 || strings.TrimSpace(fs.bodies[0]) != tst.expected {
+				t.Errorf("unexpected request: %v", fs.bodies)
+			}
+		})
+	}
+}
@@ -21,8 +21,10 @@ type ImmichClient struct {
 	endPoint            string        // Server API url
 	key                 string        // User KEY
 	DeviceUUID          string        // Device
-	Retries             int           // Number of attempts on 500 errors
-	RetriesDelay        time.Duration // Duration between retries
+	Retries             int           // Number of retries on temporary errors
+	RetriesDelay        time.Duration // Delay before the first retry, doubled at each retry
+	MaxRetriesDelay     time.Duration // Maximum delay between retries
+	PageFetchers        int           // Number of pages of the asset list fetched concurrently
 	APITrace            bool
 	supportedMediaTypes SupportedMedia // Server's list of supported medias
 }
@@ -39,6 +41,19 @@ func (ic *ImmichClient) EnableAppTrace(state bool) {
 	ic.APITrace = state
 }
 
+// SetTransport replaces the transport of the HTTP client, to record or replay the API calls
+func (ic *ImmichClient) SetTransport(rt http.RoundTripper) {
+	ic.client.Transport = rt
+}
+
+// Transport gives the transport of the HTTP client
+func (ic *ImmichClient) Transport() http.RoundTripper {
+	if ic.client.Transport == nil {
+		return http.DefaultTransport
+	}
+	return ic.client.Transport
+}
+
 func (ic *ImmichClient) SupportedMedia() SupportedMedia {
 	return ic.supportedMediaTypes
 }
@@ -58,12 +73,14 @@ func NewImmichClient(endPoint string, key string, sslVerify bool) (*ImmichClient
 	tlsClient := &http.Client{Transport: transportOptions}
 
 	ic := ImmichClient{
-		endPoint:     endPoint + "/api",
-		key:          key,
-		client:       tlsClient,
-		DeviceUUID:   deviceUUID,
-		Retries:      1,
-		RetriesDelay: time.Second * 1,
+		endPoint:        endPoint + "/api",
+		key:             key,
+		client:          tlsClient,
+		DeviceUUID:      deviceUUID,
+		Retries:         1,
+		RetriesDelay:    time.Second * 1,
+		MaxRetriesDelay: time.Second * 30,
+		PageFetchers:    4,
 	}
 
 	return &ic, nil
@@ -4,6 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,18 +26,29 @@ type ImmichInterface interface {
 	GetServerStatistics(ctx context.Context) (ServerStatistics, error)
 
 	UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*Asset, error)
+	UpdateAssetFields(ctx context.Context, ID string, param AssetUpdate) (*Asset, error)
 	GetAllAssets(ctx context.Context) ([]*Asset, error)
 	AddAssetToAlbum(context.Context, string, []string) ([]UpdateAlbumResult, error)
 	UpdateAssets(ctx context.Context, IDs []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentID string) error
 	GetAllAssetsWithFilter(context.Context, func(*Asset)) error
+	GetAssetsUpdatedAfter(ctx context.Context, after time.Time, filter func(*Asset)) error
+	GetDeletedAssets(ctx context.Context, after time.Time) ([]string, bool, error)
 	AssetUpload(context.Context, *browser.LocalAssetFile) (AssetResponse, error)
+	CheckBulkUpload(context.Context, []BulkCheckItem) ([]BulkCheckResult, error)
+	DownloadAsset(ctx context.Context, ID string) (io.ReadCloser, error)
 	DeleteAssets(context.Context, []string, bool) error
 
 	GetAllAlbums(context.Context) ([]AlbumSimplified, error)
 	CreateAlbum(context.Context, string, []string) (AlbumSimplified, error)
 	GetAssetAlbums(ctx context.Context, ID string) ([]AlbumSimplified, error)
+	GetAlbumInfo(ctx context.Context, ID string) (AlbumContent, error)
 	DeleteAlbum(ctx context.Context, id string) error
 
+	GetAllTags(ctx context.Context) ([]Tag, error)
+	CreateTag(ctx context.Context, name string, parentID string) (Tag, error)
+	UpsertTags(ctx context.Context, values []string) ([]Tag, error)
+	TagAssets(ctx context.Context, tagID string, assets []string) ([]UpdateAlbumResult, error)
+
 	StackAssets(ctx context.Context, cover string, IDs []string) error
 
 	SupportedMedia() SupportedMedia
@@ -129,6 +144,7 @@ type Asset struct {
 	Thumbhash        string            `json:"thumbhash"`
 	FileCreatedAt    ImmichTime        `json:"fileCreatedAt"`
 	FileModifiedAt   ImmichTime        `json:"fileModifiedAt"`
+	LocalDateTime    ImmichTime        `json:"localDateTime"` // wall clock time of the capture, given as UTC
 	UpdatedAt        ImmichTime        `json:"updatedAt"`
 	IsFavorite       bool              `json:"isFavorite"`
 	IsArchived       bool              `json:"isArchived"`
@@ -136,7 +152,7 @@ type Asset struct {
 	Duration         string            `json:"duration"`
 	ExifInfo         ExifInfo          `json:"exifInfo"`
 	LivePhotoVideoID string            `json:"livePhotoVideoId"`
-	Tags             []any             `json:"tags"`
+	Tags             []Tag             `json:"tags"`
 	Checksum         string            `json:"checksum"`
 	StackParentID    string            `json:"stackParentId"`
 	JustUploaded     bool              `json:"-"`
@@ -204,3 +220,85 @@ func (t ImmichTime) MarshalJSON() ([]byte, error) {
 
 	return json.Marshal(t.Time.Format("\"" + time.RFC3339 + "\""))
 }
+
+// Location gives the time zone of the capture, nil when the server doesn't know it.
+// The server gives IANA names like Europe/Paris, or offsets like UTC+2 or UTC-5:30
+func (e ExifInfo) Location() *time.Location {
+	s := e.TimeZone
+	if s == "" {
+		return nil
+	}
+	if s == "UTC" {
+		return time.UTC
+	}
+	if rest, ok := strings.CutPrefix(s, "UTC"); ok && len(rest) > 1 {
+		sign := 1
+		switch rest[0] {
+		case '-':
+			sign = -1
+		case '+':
+		default:
+			return nil
+		}
+		h, m, _ := strings.Cut(rest[1:], ":")
+		hours, err := strconv.Atoi(h)
+		if err != nil {
+			return nil
+		}
+		minutes := 0
+		if m != "" {
+			minutes, err = strconv.Atoi(m)
+			if err != nil {
+				return nil
+			}
+		}
+		return time.FixedZone(s, sign*(hours*3600+minutes*60))
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// TimeZoneName gives the name of the location as the server does
+func TimeZoneName(loc *time.Location) string {
+	if name := loc.String(); name != "" && name != "Local" && !strings.HasPrefix(name, "UTC") {
+		return name
+	}
+	_, offset := time.Date(2000, 1, 1, 0, 0, 0, 0, loc).Zone()
+	if offset == 0 {
+		return "UTC"
+	}
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	name := "UTC" + sign + strconv.Itoa(offset/3600)
+	if m := offset % 3600 / 60; m != 0 {
+		name += fmt.Sprintf(":%02d", m)
+	}
+	return name
+}
+
+// WallClock gives the wall clock time of t in the location, as an UTC time.
+// The location is the local time zone when nil.
+func WallClock(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		local, err := tzone.Local()
+		if err != nil {
+			local = time.Local
+		}
+		loc = local
+	}
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// WallClock gives the wall clock time of the capture, as an UTC time
+func (a *Asset) WallClock() time.Time {
+	if !a.LocalDateTime.IsZero() {
+		return a.LocalDateTime.UTC()
+	}
+	return WallClock(a.ExifInfo.DateTimeOriginal.Time, a.ExifInfo.Location())
+}
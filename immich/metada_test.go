@@ -2,8 +2,15 @@ package immich
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_searchMetadataRequest(t *testing.T) {
@@ -139,3 +146,94 @@ func Test_searchMetadataRequest(t *testing.T) {
 		t.Errorf("expecting next page, got: %d", rest.Assets.NextPage)
 	}
 }
+
+// pagesServer answers to the search with pages of the given size, slower for the first pages
+func pagesServer(t *testing.T, assets, size int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		var req searchMetadataGetAllBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		time.Sleep(time.Duration(10-req.Page%10) * time.Millisecond)
+		resp := searchMetadataResponse{}
+		for i := (req.Page - 1) * size; i < req.Page*size && i < assets; i++ {
+			resp.Assets.Items = append(resp.Assets.Items, &Asset{ID: strconv.Itoa(i)})
+		}
+		if req.Page*size < assets {
+			resp.Assets.NextPage = req.Page + 1
+		}
+		resp.Assets.Count = len(resp.Assets.Items)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func Test_callSearchMetadataPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		assets    int
+		fetchers  int
+		wantCalls int32
+	}{
+		{name: "sequential", assets: 20, fetchers: 1, wantCalls: 7},
+		{name: "concurrent", assets: 20, fetchers: 4, wantCalls: 10},
+		{name: "less pages than fetchers", assets: 2, fetchers: 4, wantCalls: 4},
+		{name: "empty", assets: 0, fetchers: 4, wantCalls: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := pagesServer(t, tt.assets, 3, &calls)
+			defer ts.Close()
+			ic, err := NewImmichClient(ts.URL, "key", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ic.PageFetchers = tt.fetchers
+
+			assets, err := ic.GetAllAssets(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(assets) != tt.assets {
+				t.Errorf("got %d assets, want %d", len(assets), tt.assets)
+			}
+			for i, a := range assets {
+				if a.ID != strconv.Itoa(i) {
+					t.Errorf("asset %d is %s", i, a.ID)
+					break
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_callSearchMetadataCancel(t *testing.T) {
+	var calls int32
+	ts := pagesServer(t, 1000, 3, &calls)
+	defer ts.Close()
+	ic, err := NewImmichClient(ts.URL, "key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	err = ic.GetAllAssetsWithFilter(ctx, func(a *Asset) {
+		n++
+		if n == 10 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if n >= 1000 {
+		t.Errorf("the assets are still given after the cancellation")
+	}
+}
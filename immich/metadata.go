@@ -2,10 +2,12 @@ package immich
 
 import (
 	"context"
+	"net/url"
+	"time"
 )
 
 type searchMetadataBody interface {
-	setPage(p int)
+	withPage(p int) searchMetadataBody // gives a copy of the request for the page
 }
 
 type searchMetadataResponse struct {
@@ -18,34 +20,109 @@ type searchMetadataResponse struct {
 }
 
 type searchMetadataGetAllBody struct {
-	Page      int  `json:"page"`
-	WithExif  bool `json:"withExif,omitempty"`
-	IsVisible bool `json:"isVisible,omitempty"`
+	Page         int    `json:"page"`
+	WithExif     bool   `json:"withExif,omitempty"`
+	IsVisible    bool   `json:"isVisible,omitempty"`
+	WithDeleted  bool   `json:"withDeleted,omitempty"`
+	UpdatedAfter string `json:"updatedAfter,omitempty"`
 }
 
-func (sb *searchMetadataGetAllBody) setPage(p int) {
+func (sb searchMetadataGetAllBody) withPage(p int) searchMetadataBody {
 	sb.Page = p
+	return &sb
 }
 
+// assetPage is a page of the search results
+type assetPage struct {
+	page   int
+	assets []*Asset
+	next   int // number of the next page, 0 for the last page
+	err    error
+}
+
+// callSearchMetadata calls the filter with the assets of all pages of the search, in the order of the pages.
+// The filter is called by the caller's goroutine, while the next pages are fetched.
 func (ic *ImmichClient) callSearchMetadata(ctx context.Context, req searchMetadataBody, filter func(*Asset)) error {
-	req.setPage(1)
-	for {
-		resp := searchMetadataResponse{}
-		err := ic.newServerCall(ctx, "GetAllAssets").do(post("/search/metadata", "application/json", setJSONBody(&req), setAcceptJSON()), responseJSON(&resp))
-		if err != nil {
-			return err
+	ctx, cancel := context.WithCancel(ctx)
+	pages := ic.fetchPages(ctx, req)
+	defer func() {
+		// Stop the pending calls, and wait for them
+		cancel()
+		for range pages {
 		}
+	}()
 
-		for _, a := range resp.Assets.Items {
+	for p := range pages {
+		if p.err != nil {
+			return p.err
+		}
+		for _, a := range p.assets {
 			filter(a)
 		}
+	}
+	return ctx.Err()
+}
 
-		if resp.Assets.NextPage == 0 {
-			break
-		}
-		req.setPage(resp.Assets.NextPage)
+// fetchPages calls the search with up to PageFetchers concurrent calls, and sends the pages in order into the channel.
+//
+// The server gives the number of the next page only with the current one. So the pages are requested
+// before knowing whether they exist: when the page p is received, the page p+PageFetchers is requested.
+// The pages after the last one are empty, and dropped. The requested pages don't depend on the response times,
+// this keeps the recorded sessions replayable.
+//
+// The channel is closed after the last page, or after the first error, once all calls are done.
+func (ic *ImmichClient) fetchPages(ctx context.Context, req searchMetadataBody) <-chan assetPage {
+	window := ic.PageFetchers
+	if window < 1 {
+		window = 1
+	}
+	results := make(chan assetPage, window)
+	pages := make(chan assetPage)
+
+	fetch := func(p int) {
+		go func() {
+			resp := searchMetadataResponse{}
+			body := req.withPage(p)
+			err := ic.newServerCall(ctx, "GetAllAssets").do(post("/search/metadata", "application/json", setJSONBody(body), setAcceptJSON(), setRetryable()), responseJSON(&resp))
+			results <- assetPage{page: p, assets: resp.Assets.Items, next: resp.Assets.NextPage, err: err}
+		}()
 	}
-	return nil
+
+	go func() {
+		defer close(pages)
+		for p := 1; p <= window; p++ {
+			fetch(p)
+		}
+		inFlight := window
+		received := map[int]assetPage{}
+		expected := 1
+		done := false
+		for inFlight > 0 {
+			r := <-results
+			inFlight--
+			received[r.page] = r
+			for !done {
+				r, ok := received[expected]
+				if !ok {
+					break
+				}
+				delete(received, expected)
+				if r.err != nil || r.next == 0 {
+					done = true
+				} else {
+					fetch(expected + window)
+					inFlight++
+				}
+				select {
+				case pages <- r:
+				case <-ctx.Done():
+					done = true
+				}
+				expected++
+			}
+		}
+	}()
+	return pages
 }
 
 func (ic *ImmichClient) GetAllAssets(ctx context.Context) ([]*Asset, error) {
@@ -63,3 +140,27 @@ func (ic *ImmichClient) GetAllAssetsWithFilter(ctx context.Context, filter func(
 	req := searchMetadataGetAllBody{Page: 1, WithExif: true, IsVisible: true}
 	return ic.callSearchMetadata(ctx, &req, filter)
 }
+
+// GetAssetsUpdatedAfter calls the filter with the assets changed after the date, the trashed ones included.
+// All assets are given when the date is zero.
+func (ic *ImmichClient) GetAssetsUpdatedAfter(ctx context.Context, after time.Time, filter func(*Asset)) error {
+	req := searchMetadataGetAllBody{Page: 1, WithExif: true, IsVisible: true, WithDeleted: true}
+	if !after.IsZero() {
+		req.UpdatedAfter = after.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return ic.callSearchMetadata(ctx, &req, filter)
+}
+
+// GetDeletedAssets gives the IDs of the assets removed from the server after the date.
+// needsFullSync is true when the server can't tell which assets have been removed.
+func (ic *ImmichClient) GetDeletedAssets(ctx context.Context, after time.Time) (ids []string, needsFullSync bool, err error) {
+	resp := struct {
+		NeedsFullSync bool     `json:"needsFullSync"`
+		IDs           []string `json:"ids"`
+	}{}
+	v := url.Values{}
+	v.Set("entityType", "ASSET")
+	v.Set("after", after.UTC().Format("2006-01-02T15:04:05.000Z"))
+	err = ic.newServerCall(ctx, "GetDeletedAssets").do(get("/audit/deletes?"+v.Encode(), setAcceptJSON()), responseJSON(&resp))
+	return resp.IDs, resp.NeedsFullSync, err
+}
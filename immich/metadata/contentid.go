@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Apple's live photos are made of an image and a video sharing the same content identifier.
+// The image keeps it in the Apple's maker note (tag 0x11), the video in the quicktime metadata.
+
+const imageContentIDLimit = 256 * 1024 // The maker note is at the beginning of the image
+
+var (
+	appleMakerNote      = []byte("Apple iOS\x00")
+	quicktimeContentKey = []byte("com.apple.quicktime.content.identifier")
+	reUUID              = regexp.MustCompile(`[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}`)
+)
+
+var ErrNoContentID = errors.New("no content identifier")
+
+// GetContentIdentifier gives the Apple's content identifier of the image or the video part of a live photo
+func GetContentIdentifier(r io.Reader, ext string) (string, error) {
+	switch strings.ToLower(ext) {
+	case ".heic", ".heif", ".jpg", ".jpeg":
+		b, err := io.ReadAll(io.LimitReader(r, imageContentIDLimit))
+		if err != nil {
+			return "", err
+		}
+		return imageContentID(b)
+	case ".mov", ".mp4":
+		// The moov atom can be placed after the media data, only this atom is read
+		moov, err := readMoovAtom(r)
+		if err != nil {
+			return "", err
+		}
+		return videoContentID(moov)
+	}
+	return "", fmt.Errorf("can't get the content identifier (%s)", ext)
+}
+
+// imageContentID decodes the Apple's maker note to get the tag 0x11
+//
+//	"Apple iOS\0" 0x00 0x01 "MM" IFD
+//
+// The offsets of the IFD are relative to the beginning of the maker note
+func imageContentID(b []byte) (string, error) {
+	p := bytes.Index(b, appleMakerNote)
+	if p < 0 {
+		return "", ErrNoContentID
+	}
+	mn := b[p:]
+	if len(mn) < 16 {
+		return "", ErrNoContentID
+	}
+	var bo binary.ByteOrder
+	switch string(mn[12:14]) {
+	case "MM":
+		bo = binary.BigEndian
+	case "II":
+		bo = binary.LittleEndian
+	default:
+		return "", ErrNoContentID
+	}
+	count := int(bo.Uint16(mn[14:16]))
+	for i := 0; i < count; i++ {
+		e := 16 + i*12
+		if e+12 > len(mn) {
+			break
+		}
+		if bo.Uint16(mn[e:]) != 0x11 {
+			continue
+		}
+		l := int(bo.Uint32(mn[e+4:]))
+		o := int(bo.Uint32(mn[e+8:]))
+		if l <= 4 || o+l > len(mn) {
+			return "", ErrNoContentID
+		}
+		return string(bytes.TrimRight(mn[o:o+l], "\x00")), nil
+	}
+	return "", ErrNoContentID
+}
+
+// videoContentID gets the value of the key com.apple.quicktime.content.identifier in the moov atom.
+// The value is stored in the ilst atom, after the list of keys.
+func videoContentID(b []byte) (string, error) {
+	p := bytes.Index(b, quicktimeContentKey)
+	if p < 0 {
+		return "", ErrNoContentID
+	}
+	b = b[p+len(quicktimeContentKey):]
+	if len(b) > 4096 {
+		b = b[:4096]
+	}
+	id := reUUID.Find(b)
+	if id == nil {
+		return "", ErrNoContentID
+	}
+	return string(id), nil
+}
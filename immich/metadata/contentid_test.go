@@ -0,0 +1,100 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testContentID = "1B7E4A3C-2D5F-4E6A-8B9C-0D1E2F3A4B5C"
+
+// appleMakerNoteBytes builds a maker note with the tags 0x01 and 0x11
+func appleMakerNoteBytes(id string) []byte {
+	b := bytes.NewBuffer(nil)
+	b.Write(appleMakerNote)
+	b.Write([]byte{0, 1, 'M', 'M'})
+	_ = binary.Write(b, binary.BigEndian, uint16(2))
+	value := []byte(id + "\x00")
+	offset := uint32(16 + 2*12 + 4)
+	// tag 0x01, SLONG, 1 value
+	_ = binary.Write(b, binary.BigEndian, []uint16{0x01, 9})
+	_ = binary.Write(b, binary.BigEndian, []uint32{1, 14})
+	// tag 0x11, ASCII, content identifier
+	_ = binary.Write(b, binary.BigEndian, []uint16{0x11, 2})
+	_ = binary.Write(b, binary.BigEndian, []uint32{uint32(len(value)), offset})
+	b.Write([]byte{0, 0, 0, 0}) // next IFD
+	b.Write(value)
+	return b.Bytes()
+}
+
+func TestGetContentIdentifier(t *testing.T) {
+	image := append(GenRandomBytes(1000), appleMakerNoteBytes(testContentID)...)
+	image = append(image, GenRandomBytes(100)...)
+
+	moov := atom("moov", []byte("\x00\x00\x00\x00keys"), quicktimeContentKey,
+		[]byte("\x00\x00\x00\x1dmdtacom.apple.quicktime.make\x00\x00\x00\x3cilst\x00\x00\x00\x01data\x00\x00\x00\x01\x00\x00\x00\x00"+testContentID))
+	video := append(atom("ftyp", []byte("qt  ")), atom("mdat", GenRandomBytes(5000))...)
+	video = append(video, moov...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		ext     string
+		want    string
+		wantErr bool
+	}{
+		{name: "heic", data: image, ext: ".HEIC", want: testContentID},
+		{name: "jpg", data: image, ext: ".jpg", want: testContentID},
+		{name: "mov", data: video, ext: ".MOV", want: testContentID},
+		{name: "image without maker note", data: GenRandomBytes(1000), ext: ".heic", wantErr: true},
+		{name: "video without identifier", data: atom("moov", GenRandomBytes(1000)), ext: ".mov", wantErr: true},
+		{name: "video without moov", data: atom("mdat", GenRandomBytes(1000)), ext: ".mp4", wantErr: true},
+		{name: "unsupported", data: image, ext: ".png", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetContentIdentifier(bytes.NewReader(tt.data), tt.ext)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetContentIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetContentIdentifier() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVideoContentIDAfterLargeMediaData(t *testing.T) {
+	moov := atom("moov", []byte("keys"), quicktimeContentKey, []byte("ilst data "+testContentID))
+	f, err := os.Create(filepath.Join(t.TempDir(), "video.mov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// A sparse file with 200 MB of media data before the moov atom
+	const mdatSize = 200 * 1024 * 1024
+	_, err = f.Write(append(atom("ftyp", []byte("qt  ")), u32(mdatSize+8)...))
+	if err == nil {
+		_, err = f.WriteString("mdat")
+	}
+	if err == nil {
+		_, err = f.Seek(mdatSize, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = f.Write(moov)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetContentIdentifier(f, ".mov")
+	if err != nil || got != testContentID {
+		t.Errorf("GetContentIdentifier() = %q, %v, want %q", got, err, testContentID)
+	}
+}
@@ -1,17 +1,47 @@
 package metadata
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
 	"path"
 	"strings"
 	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
 )
 
 type MetaData struct {
 	DateTaken                     time.Time
+	TimeZone                      *time.Location // time zone of the capture when the file gives it
+	DateIsUTC                     bool           // the file gives the instant of the capture, but not its wall clock time, like videos do
 	Latitude, Longitude, Altitude float64
+	Make, Model, LensModel        string // camera and lens
+	Orientation                   int    // EXIF orientation, 1 to 8
+	Width, Height                 int    // in pixels
+
+	// Given by XMP packets
+	Title, Description string
+	Rating             int      // -1 for rejected, 0 to 5 stars
+	Keywords           []string // also given by the IPTC records of JPEG files
+	Faces              []FaceRegion
+}
+
+// ResolveTimeZone determines the time zone of the capture from the GPS coordinates, when the file doesn't give it.
+// Dates given without time zone are wall clock times, they are placed in the zone of the location.
+func (md *MetaData) ResolveTimeZone() {
+	if md.TimeZone != nil {
+		return
+	}
+	loc := tzone.FromLocation(md.Latitude, md.Longitude)
+	if loc == nil {
+		return
+	}
+	md.TimeZone = loc
+	if t := md.DateTaken; !t.IsZero() && !md.DateIsUTC {
+		md.DateTaken = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
 }
 
 func GetFileMetaData(fsys fs.FS, name string) (MetaData, error) {
@@ -33,80 +63,81 @@ func GetFileMetaData(fsys fs.FS, name string) (MetaData, error) {
 
 func GetFromReader(rd io.Reader, ext string) (MetaData, error) {
 	r := newSliceReader(rd)
-	meta := MetaData{}
+	var meta MetaData
 	var err error
-	var dateTaken time.Time
 	switch strings.ToLower(ext) {
-	case ".heic", ".heif":
-		dateTaken, err = readHEIFDateTaken(r)
-	case ".jpg", ".jpeg", ".dng", ".cr2":
-		dateTaken, err = readExifDateTaken(r)
-	case ".mp4", ".mov":
-		dateTaken, err = readMP4DateTaken(r)
+	case ".heic", ".heif", ".hif":
+		meta, err = readHEIFMetaData(r)
+	case ".jpg", ".jpeg", ".jpe", ".insp":
+		meta, err = readJPEGMetaData(r)
+	case ".dng", ".cr2":
+		meta, err = getExifFromReader(r)
+	case ".tif", ".tiff", ".nef", ".nrw", ".arw", ".sr2", ".srf", ".pef", ".orf", ".ori", ".rw2", ".rwl",
+		".srw", ".dcr", ".kdc", ".k25", ".3fr", ".erf", ".fff", ".mef":
+		meta, err = readTIFFMetaData(r)
+	case ".raf":
+		meta, err = readRAFMetaData(r)
+	case ".mrw":
+		meta, err = readMRWMetaData(r)
+	case ".png":
+		meta, err = readPNGMetaData(r)
+	case ".webp":
+		meta, err = readWebPMetaData(r)
+	case ".avif", ".jxl":
+		meta, err = readISOBMFFMetaData(r)
+	case ".gif":
+		meta, err = readGIFMetaData(r)
+	case ".mp4", ".mov", ".m4v", ".3gp", ".insv":
+		meta, err = readMP4MetaData(r)
+	case ".mkv", ".webm":
+		meta, err = readMatroskaMetaData(r)
 	case ".cr3":
-		dateTaken, err = readCR3DateTaken(r)
+		meta, err = readCR3MetaData(r)
 	default:
 		err = fmt.Errorf("can't determine the taken date from metadata (%s)", ext)
 	}
-	meta.DateTaken = dateTaken
 	return meta, err
 }
 
-// readExifDateTaken pase the file for Exif DateTaken
-func readExifDateTaken(r io.Reader) (time.Time, error) {
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
-}
-
 const searchBufferSize = 32 * 1024
 
-// readHEIFDateTaken locate the Exif part and return the date of capture
-func readHEIFDateTaken(r *sliceReader) (time.Time, error) {
+// readHEIFMetaData reads the Exif and XMP items located by the meta box.
+// When the meta box doesn't locate them, the Exif part is searched in the file.
+func readHEIFMetaData(r *sliceReader) (MetaData, error) {
+	read := bytes.NewBuffer(nil)
+	md, err := readISOBMFFMetaData(newSliceReader(io.TeeReader(r, read)))
+	if err == nil {
+		return md, nil
+	}
+
 	b := make([]byte, searchBufferSize)
-	r, err := searchPattern(r, []byte{0x45, 0x78, 0x69, 0x66, 0, 0, 0x4d, 0x4d}, b)
+	r, err = searchPattern(io.MultiReader(read, r), []byte{0x45, 0x78, 0x69, 0x66, 0, 0, 0x4d, 0x4d}, b)
 	if err != nil {
-		return time.Time{}, err
+		return MetaData{}, err
 	}
 
 	filler := make([]byte, 6)
 	_, err = r.Read(filler)
 	if err != nil {
-		return time.Time{}, err
+		return MetaData{}, err
 	}
 
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
+	return getExifFromReader(r)
 }
 
-// readMP4DateTaken locate the mvhd atom and decode the date of capture
-func readMP4DateTaken(r *sliceReader) (time.Time, error) {
-	b := make([]byte, searchBufferSize)
-
-	r, err := searchPattern(r, []byte{'m', 'v', 'h', 'd'}, b)
-	if err != nil {
-		return time.Time{}, err
-	}
-	atom, err := decodeMvhdAtom(r)
-	if err != nil {
-		return time.Time{}, err
-	}
-	return atom.CreationTime, nil
-}
-
-func readCR3DateTaken(r *sliceReader) (time.Time, error) {
+func readCR3MetaData(r *sliceReader) (MetaData, error) {
 	b := make([]byte, searchBufferSize)
 
 	r, err := searchPattern(r, []byte("CMT1"), b)
 	if err != nil {
-		return time.Time{}, err
+		return MetaData{}, err
 	}
 
 	filler := make([]byte, 4)
 	_, err = r.Read(filler)
 	if err != nil {
-		return time.Time{}, err
+		return MetaData{}, err
 	}
 
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
+	return getExifFromReader(r)
 }
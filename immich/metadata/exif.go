@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
 	"github.com/simulot/immich-go/helpers/tzone"
 )
 
@@ -26,6 +28,14 @@ func getExifFromReader(r io.Reader) (MetaData, error) {
 		return md, fmt.Errorf("can't get DateTaken: %w", err)
 	}
 
+	getExifDetails(x, &md)
+
+	// The dates are given in the time zone of the capture, when the offset is known
+	loc := local
+	if md.TimeZone != nil {
+		loc = md.TimeZone
+	}
+
 	tag, err := getTagSting(x, exif.GPSDateStamp)
 	if err == nil {
 		md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05Z", tag, local)
@@ -33,19 +43,129 @@ func getExifFromReader(r io.Reader) (MetaData, error) {
 	if err != nil {
 		tag, err = getTagSting(x, exif.DateTimeOriginal)
 		if err == nil {
-			md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05", tag, local)
+			md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05", tag, loc)
 		}
 	}
 	if err != nil {
 		tag, err = getTagSting(x, exif.DateTime)
 		if err == nil {
-			md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05", tag, local)
+			md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05", tag, loc)
 		}
 	}
 
+	if xmp := exifXMLPacket(x); xmp != nil {
+		md.mergeXMP(xmp)
+		if !md.DateTaken.IsZero() {
+			err = nil
+		}
+	}
 	return md, err
 }
 
+// The XMP packet of TIFF files, DNG and the RAW formats based on TIFF, like CR2
+const exifXMLPacketTag = 0x02bc
+
+// exifXMLPacket gives the XMP packet of the first IFD
+func exifXMLPacket(x *exif.Exif) []byte {
+	if x.Tiff == nil || len(x.Tiff.Dirs) == 0 {
+		return nil
+	}
+	for _, t := range x.Tiff.Dirs[0].Tags {
+		if t.Id == exifXMLPacketTag {
+			return t.Val
+		}
+	}
+	return nil
+}
+
+// getExifDetails collects the location, the camera and the image's properties
+func getExifDetails(x *exif.Exif, md *MetaData) {
+	if lat, long, err := x.LatLong(); err == nil {
+		md.Latitude, md.Longitude = lat, long
+		if t, err := x.Get(exif.GPSAltitude); err == nil {
+			if n, d, err := t.Rat2(0); err == nil && d != 0 {
+				md.Altitude = float64(n) / float64(d)
+				if t, err := x.Get(exif.GPSAltitudeRef); err == nil {
+					if ref, err := t.Int(0); err == nil && ref == 1 {
+						md.Altitude = -md.Altitude // below the sea level
+					}
+				}
+			}
+		}
+	}
+
+	md.Make, _ = getTagSting(x, exif.Make)
+	md.Model, _ = getTagSting(x, exif.Model)
+	md.LensModel, _ = getTagSting(x, exif.LensModel)
+	md.Orientation = getTagInt(x, exif.Orientation)
+	md.Width = getTagInt(x, exif.PixelXDimension)
+	md.Height = getTagInt(x, exif.PixelYDimension)
+	if md.Width == 0 || md.Height == 0 {
+		md.Width = getTagInt(x, exif.ImageWidth)
+		md.Height = getTagInt(x, exif.ImageLength)
+	}
+
+	offsets := getExifOffsets(x)
+	for _, id := range []uint16{exifOffsetTimeOriginal, exifOffsetTime} {
+		if o, ok := offsets[id]; ok {
+			if tz, err := parseTZOffset(o); err == nil {
+				md.TimeZone = tz
+				break
+			}
+		}
+	}
+}
+
+// Time offsets are not known by the exif package
+const (
+	exifOffsetTime         = 0x9010
+	exifOffsetTimeOriginal = 0x9011
+)
+
+// getExifOffsets reads the time offsets in the exif sub-IFD
+func getExifOffsets(x *exif.Exif) map[uint16]string {
+	offsets := map[uint16]string{}
+	ptr, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return offsets
+	}
+	offset, err := ptr.Int64(0)
+	if err != nil {
+		return offsets
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err = r.Seek(offset, io.SeekStart); err != nil {
+		return offsets
+	}
+	d, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return offsets
+	}
+	for _, t := range d.Tags {
+		if t.Id == exifOffsetTime || t.Id == exifOffsetTimeOriginal {
+			if s, err := t.StringVal(); err == nil {
+				offsets[t.Id] = strings.TrimRight(s, "\x00 ")
+			}
+		}
+	}
+	return offsets
+}
+
+// parseTZOffset gives a fixed time zone for offsets like +02:00, -0500 or Z
+func parseTZOffset(s string) (*time.Location, error) {
+	s = strings.TrimSpace(s)
+	if s == "Z" {
+		return time.UTC, nil
+	}
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			_, offset := t.Zone()
+			return time.FixedZone(s, offset), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time zone offset: %q", s)
+}
+
 func getTagSting(x *exif.Exif, tagName exif.FieldName) (string, error) {
 	t, err := x.Get(tagName)
 	if err != nil {
@@ -54,3 +174,15 @@ func getTagSting(x *exif.Exif, tagName exif.FieldName) (string, error) {
 	s := strings.TrimRight(strings.TrimLeft(t.String(), `"`), `"`)
 	return s, nil
 }
+
+func getTagInt(x *exif.Exif, tagName exif.FieldName) int {
+	t, err := x.Get(tagName)
+	if err != nil {
+		return 0
+	}
+	i, err := t.Int(0)
+	if err != nil {
+		return 0
+	}
+	return i
+}
@@ -0,0 +1,147 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
+)
+
+// ifdEntry is a tag of a TIFF directory
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiTag(tag uint16, s string) ifdEntry {
+	return ifdEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func shortTag(tag uint16, v uint16) ifdEntry {
+	return ifdEntry{tag: tag, typ: 3, count: 1, data: binary.BigEndian.AppendUint16(nil, v)}
+}
+
+func longTag(tag uint16, v uint32) ifdEntry {
+	return ifdEntry{tag: tag, typ: 4, count: 1, data: binary.BigEndian.AppendUint32(nil, v)}
+}
+
+func rationalTag(tag uint16, v ...uint32) ifdEntry {
+	b := []byte{}
+	for _, i := range v {
+		b = binary.BigEndian.AppendUint32(b, i)
+	}
+	return ifdEntry{tag: tag, typ: 5, count: uint32(len(v) / 2), data: b}
+}
+
+// tiffBytes builds a big endian TIFF with the IFD0, the exif and the GPS sub IFDs
+func tiffBytes(ifd0, exifIFD, gpsIFD []ifdEntry) []byte {
+	ifdSize := func(l []ifdEntry) int { return 2 + 12*len(l) + 4 }
+	exifOffset := 8 + ifdSize(ifd0) + 12*2 // IFD0 gets two pointers
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	dataOffset := gpsOffset + ifdSize(gpsIFD)
+	ifd0 = append(ifd0, longTag(0x8769, uint32(exifOffset)), longTag(0x8825, uint32(gpsOffset)))
+
+	b := bytes.NewBuffer([]byte{'M', 'M', 0, 42, 0, 0, 0, 8})
+	data := bytes.NewBuffer(nil)
+	for _, ifd := range [][]ifdEntry{ifd0, exifIFD, gpsIFD} {
+		_ = binary.Write(b, binary.BigEndian, uint16(len(ifd)))
+		for _, e := range ifd {
+			_ = binary.Write(b, binary.BigEndian, []uint16{e.tag, e.typ})
+			_ = binary.Write(b, binary.BigEndian, e.count)
+			if len(e.data) <= 4 {
+				b.Write(append(e.data, make([]byte, 4-len(e.data))...))
+				continue
+			}
+			_ = binary.Write(b, binary.BigEndian, uint32(dataOffset+data.Len()))
+			data.Write(e.data)
+		}
+		b.Write([]byte{0, 0, 0, 0})
+	}
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestExifDetails(t *testing.T) {
+	b := tiffBytes(
+		[]ifdEntry{
+			asciiTag(0x010f, "Google"),
+			asciiTag(0x0110, "Pixel 6"),
+			shortTag(0x0112, 6),
+		},
+		[]ifdEntry{
+			asciiTag(0x9003, "2023:10:06 08:30:00"),
+			asciiTag(0x9011, "+09:00"),
+			longTag(0xa002, 4000),
+			longTag(0xa003, 3000),
+			asciiTag(0xa434, "Pixel 6 back camera 6.81mm f/1.85"),
+		},
+		[]ifdEntry{
+			asciiTag(0x1, "N"),
+			rationalTag(0x2, 48, 1, 51, 1, 2772, 100),
+			asciiTag(0x3, "W"),
+			rationalTag(0x4, 2, 1, 17, 1, 42, 1),
+			{tag: 0x5, typ: 1, count: 1, data: []byte{0}},
+			rationalTag(0x6, 35, 1),
+		},
+	)
+
+	md, err := GetFromReader(bytes.NewReader(b), ".dng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Make != "Google" || md.Model != "Pixel 6" || md.LensModel != "Pixel 6 back camera 6.81mm f/1.85" {
+		t.Errorf("unexpected camera: %q %q %q", md.Make, md.Model, md.LensModel)
+	}
+	if md.Orientation != 6 || md.Width != 4000 || md.Height != 3000 {
+		t.Errorf("unexpected orientation and dimensions: %d %dx%d", md.Orientation, md.Width, md.Height)
+	}
+	if math.Abs(md.Latitude-48.8577) > 1e-6 || math.Abs(md.Longitude+2.295) > 1e-6 || md.Altitude != 35 {
+		t.Errorf("unexpected location: %f %f %f", md.Latitude, md.Longitude, md.Altitude)
+	}
+	if md.TimeZone == nil {
+		t.Fatalf("expecting a time zone")
+	}
+	if _, offset := time.Date(2023, 10, 6, 8, 30, 0, 0, md.TimeZone).Zone(); offset != 9*3600 {
+		t.Errorf("unexpected time zone offset: %d", offset)
+	}
+	if md.DateTaken.Format("2006-01-02 15:04:05") != "2023-10-06 08:30:00" || !md.DateTaken.Equal(time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected date: %s", md.DateTaken)
+	}
+}
+
+func TestResolveTimeZone(t *testing.T) {
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo := struct{ lat, long float64 }{35.6586, 139.7454}
+
+	// A photo without time zone: the wall clock time is kept
+	md := MetaData{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, local), Latitude: tokyo.lat, Longitude: tokyo.long}
+	md.ResolveTimeZone()
+	if md.TimeZone == nil || md.TimeZone.String() != "Asia/Tokyo" {
+		t.Fatalf("unexpected time zone: %v", md.TimeZone)
+	}
+	if !md.DateTaken.Equal(time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected date: %s", md.DateTaken)
+	}
+
+	// A video: the instant is kept
+	md = MetaData{DateTaken: time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC), DateIsUTC: true, Latitude: tokyo.lat, Longitude: tokyo.long}
+	md.ResolveTimeZone()
+	if !md.DateTaken.Equal(time.Date(2023, 10, 5, 23, 30, 0, 0, time.UTC)) || md.TimeZone == nil {
+		t.Errorf("unexpected date: %s, %v", md.DateTaken, md.TimeZone)
+	}
+
+	// The time zone given by the file takes precedence
+	md = MetaData{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, local), TimeZone: local, Latitude: tokyo.lat, Longitude: tokyo.long}
+	md.ResolveTimeZone()
+	if md.TimeZone != local || !md.DateTaken.Equal(time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected date: %s, %v", md.DateTaken, md.TimeZone)
+	}
+}
@@ -0,0 +1,259 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"testing"
+	"time"
+)
+
+// The test corpus is generated: a minimal file of each format, with the date of capture
+// 2023-10-06 08:30:00+02:00
+
+var corpusDate = time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+
+const corpusXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreateDate="2023-10-06T08:30:00+02:00"/>
+</rdf:RDF></x:xmpmeta>`
+
+func corpusTIFF() []byte {
+	return tiffBytes(
+		[]ifdEntry{asciiTag(0x010f, "Maker"), asciiTag(0x0110, "Camera")},
+		[]ifdEntry{asciiTag(0x9003, "2023:10:06 08:30:00"), asciiTag(0x9011, "+02:00")},
+		nil,
+	)
+}
+
+func corpusJPEG() []byte {
+	x := append([]byte("Exif\x00\x00"), corpusTIFF()...)
+	b := []byte{0xff, 0xd8, 0xff, 0xe1, byte((len(x) + 2) >> 8), byte(len(x) + 2)}
+	b = append(b, x...)
+	return append(b, 0xff, 0xd9)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(append(b, typ...), data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+func corpusPNG(chunks ...[]byte) []byte {
+	b := append([]byte{}, pngSignature...)
+	b = append(b, pngChunk("IHDR", make([]byte, 13))...)
+	b = append(b, pngChunk("IDAT", GenRandomBytes(500))...)
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	return append(b, pngChunk("IEND", nil)...)
+}
+
+func zlibBytes(b []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w := zlib.NewWriter(buf)
+	_, _ = w.Write(b)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func riffChunk(typ string, data []byte) []byte {
+	b := binary.LittleEndian.AppendUint32([]byte(typ), uint32(len(data)))
+	b = append(b, data...)
+	if len(data)&1 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func corpusWebP(chunks ...[]byte) []byte {
+	b := []byte("WEBP")
+	b = append(b, riffChunk("VP8 ", GenRandomBytes(301))...)
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(b))), b...)
+}
+
+func corpusAVIF() []byte {
+	exifItem := append(u32(6), append([]byte("Exif\x00\x00"), corpusTIFF()...)...)
+	image := GenRandomBytes(700)
+	ftyp := atom("ftyp", []byte("avif"), u32(0), []byte("mif1avif"))
+	meta := func(exifOffset uint32) []byte {
+		infe := func(id uint16, typ string) []byte {
+			return atom("infe", u32(2<<24), []byte{byte(id >> 8), byte(id), 0, 0}, []byte(typ), []byte{0})
+		}
+		iinf := atom("iinf", u32(0), []byte{0, 2}, infe(1, "av01"), infe(2, "Exif"))
+		iloc := atom("iloc", u32(0), []byte{0x44, 0x00, 0, 2},
+			[]byte{0, 1, 0, 0, 0, 1}, u32(exifOffset+uint32(len(exifItem)), uint32(len(image))),
+			[]byte{0, 2, 0, 0, 0, 1}, u32(exifOffset, uint32(len(exifItem))),
+		)
+		return atom("meta", u32(0), atom("hdlr", make([]byte, 25)), iinf, iloc)
+	}
+	start := uint32(len(ftyp) + len(meta(0)) + 8)
+	return bytes.Join([][]byte{ftyp, meta(start), atom("mdat", exifItem, image)}, nil)
+}
+
+func corpusJXL() []byte {
+	return bytes.Join([][]byte{
+		{0, 0, 0, 0x0c, 'J', 'X', 'L', ' ', 0x0d, 0x0a, 0x87, 0x0a},
+		atom("ftyp", []byte("jxl "), u32(0), []byte("jxl ")),
+		atom("Exif", u32(0), corpusTIFF()),
+		atom("jxlc", []byte{0xff, 0x0a}, GenRandomBytes(300)),
+	}, nil)
+}
+
+func ebmlElement(id []byte, content ...[]byte) []byte {
+	b := bytes.Join(content, nil)
+	return append(append(append([]byte{}, id...), 0x01, 0, 0, 0, 0, 0, 0, byte(len(b))), b...)
+}
+
+func corpusMKV() []byte {
+	date := binary.BigEndian.AppendUint64(nil, uint64(corpusDate.Sub(mkvEpoch)))
+	info := ebmlElement([]byte{0x15, 0x49, 0xa9, 0x66},
+		ebmlElement([]byte{0x2a, 0xd7, 0xb1}, []byte{0x0f, 0x42, 0x40}),
+		ebmlElement([]byte{0x44, 0x61}, date),
+	)
+	segment := append([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		ebmlElement([]byte{0x11, 0x4d, 0x9b, 0x74}, GenRandomBytes(40))...)
+	segment = append(segment, info...)
+	segment = append(segment, ebmlElement([]byte{0x1f, 0x43, 0xb6, 0x75}, GenRandomBytes(200))...)
+	return append(ebmlElement([]byte{0x1a, 0x45, 0xdf, 0xa3}, []byte{0x42, 0x82, 0x84}, []byte("webm")), segment...)
+}
+
+func corpusGIF() []byte {
+	b := append([]byte("GIF89a"), GenRandomBytes(200)...)
+	b = append(b, 0x21, 0xff, 0x0b)
+	b = append(b, "XMP DataXMP"...)
+	b = append(b, corpusXMP...)
+	return append(b, 0x00, 0x3b)
+}
+
+func corpusRAF() []byte {
+	jpeg := corpusJPEG()
+	h := make([]byte, 100)
+	copy(h, "FUJIFILMCCD-RAW 0201FF383501")
+	binary.BigEndian.PutUint32(h[84:], 100)
+	binary.BigEndian.PutUint32(h[88:], uint32(len(jpeg)))
+	return append(append(h, jpeg...), GenRandomBytes(300)...)
+}
+
+func corpusMRW() []byte {
+	tiff := corpusTIFF()
+	prd := append([]byte("\x00PRD"), u32(24)...)
+	prd = append(prd, make([]byte, 24)...)
+	ttw := append([]byte("\x00TTW"), u32(uint32(len(tiff)))...)
+	ttw = append(ttw, tiff...)
+	blocks := append(prd, ttw...)
+	b := append([]byte("\x00MRM"), u32(uint32(len(blocks)))...)
+	b = append(b, blocks...)
+	return append(b, GenRandomBytes(300)...)
+}
+
+func corpusORF() []byte {
+	b := corpusTIFF()
+	copy(b, "MMOR")
+	return b
+}
+
+// TestMain sets the local time zone of the tests, it's determined once for all tests
+func TestMain(m *testing.M) {
+	os.Setenv("TZ", "Europe/Paris")
+	os.Exit(m.Run())
+}
+
+func TestCorpus(t *testing.T) {
+	rawExif := "\nexif\n    " + "999" + "\n" + hex.EncodeToString(append([]byte("Exif\x00\x00"), corpusTIFF()...))
+	xmpITXt := append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), zlibBytes([]byte(corpusXMP))...)
+
+	tests := []struct {
+		name    string
+		ext     string
+		data    []byte
+		noTZ    bool
+		wantErr bool
+	}{
+		{name: "tiff", ext: ".tif", data: corpusTIFF()},
+		{name: "nef", ext: ".NEF", data: corpusTIFF()},
+		{name: "orf", ext: ".orf", data: corpusORF()},
+		{name: "raf", ext: ".raf", data: corpusRAF()},
+		{name: "mrw", ext: ".mrw", data: corpusMRW()},
+		{name: "png eXIf", ext: ".png", data: corpusPNG(pngChunk("eXIf", corpusTIFF()))},
+		{name: "png creation time", ext: ".png", data: corpusPNG(pngChunk("tEXt", []byte("Creation Time\x00Fri, 06 Oct 2023 08:30:00 +0200")))},
+		{name: "png xmp", ext: ".png", data: corpusPNG(pngChunk("iTXt", xmpITXt))},
+		{name: "png raw profile", ext: ".png", data: corpusPNG(pngChunk("zTXt", append([]byte("Raw profile type exif\x00\x00"), zlibBytes([]byte(rawExif))...)))},
+		{name: "png without date", ext: ".png", data: corpusPNG(), wantErr: true},
+		{name: "webp exif", ext: ".webp", data: corpusWebP(riffChunk("EXIF", append([]byte("Exif\x00\x00"), corpusTIFF()...)))},
+		{name: "webp xmp", ext: ".webp", data: corpusWebP(riffChunk("XMP ", []byte(corpusXMP)))},
+		{name: "avif", ext: ".avif", data: corpusAVIF()},
+		{name: "heic", ext: ".heic", data: corpusHEIF(nil)},
+		{name: "heic without meta box", ext: ".heic", data: append(GenRandomBytes(300), append([]byte("Exif\x00\x00"), corpusTIFF()...)...)},
+		{name: "jxl", ext: ".jxl", data: corpusJXL()},
+		{name: "jxl codestream", ext: ".jxl", data: append([]byte{0xff, 0x0a}, GenRandomBytes(300)...), wantErr: true},
+		{name: "gif", ext: ".gif", data: corpusGIF()},
+		{name: "truncated gif", ext: ".gif", data: []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00"), wantErr: true},
+		{name: "mkv", ext: ".mkv", data: corpusMKV(), noTZ: true},
+		{name: "webm", ext: ".webm", data: corpusMKV(), noTZ: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := GetFromReader(bytes.NewReader(tt.data), tt.ext)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetFromReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !md.DateTaken.Equal(corpusDate) {
+				t.Errorf("GetFromReader() date = %s, want %s", md.DateTaken, corpusDate)
+			}
+			if tt.noTZ {
+				return
+			}
+			if md.TimeZone == nil {
+				t.Fatalf("GetFromReader() expecting a time zone")
+			}
+			if _, offset := corpusDate.In(md.TimeZone).Zone(); offset != 2*3600 {
+				t.Errorf("GetFromReader() time zone offset = %d", offset)
+			}
+		})
+	}
+}
+
+// TestTruncatedCorpus checks that truncated files give an error, and not a panic
+func TestTruncatedCorpus(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		data []byte
+	}{
+		{name: "jpeg", ext: ".jpg", data: corpusJPEG()},
+		{name: "tiff", ext: ".tif", data: corpusTIFF()},
+		{name: "orf", ext: ".orf", data: corpusORF()},
+		{name: "raf", ext: ".raf", data: corpusRAF()},
+		{name: "mrw", ext: ".mrw", data: corpusMRW()},
+		{name: "png", ext: ".png", data: corpusPNG(pngChunk("eXIf", corpusTIFF()))},
+		{name: "webp", ext: ".webp", data: corpusWebP(riffChunk("XMP ", []byte(corpusXMP)))},
+		{name: "avif", ext: ".avif", data: corpusAVIF()},
+		{name: "heic", ext: ".heic", data: corpusHEIF(nil)},
+		{name: "jxl", ext: ".jxl", data: corpusJXL()},
+		{name: "gif", ext: ".gif", data: corpusGIF()},
+		{name: "mkv", ext: ".mkv", data: corpusMKV()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for l := 0; l < len(tt.data); l++ {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Fatalf("GetFromReader() panics on the %d first bytes: %v", l, r)
+						}
+					}()
+					_, _ = GetFromReader(bytes.NewReader(tt.data[:l]), tt.ext)
+				}()
+			}
+		})
+	}
+}
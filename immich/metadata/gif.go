@@ -0,0 +1,38 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+const maxXMPPacketSize = 1024 * 1024
+
+// readGIFMetaData reads the XMP packet of the application extension "XMP DataXMP".
+// GIF files have no other source for the date of capture.
+func readGIFMetaData(r io.Reader) (MetaData, error) {
+	h := make([]byte, 6)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if string(h) != "GIF87a" && string(h) != "GIF89a" {
+		return MetaData{}, errors.New("not a GIF file")
+	}
+	sr, err := searchPattern(r, []byte("XMP DataXMP"), make([]byte, searchBufferSize))
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("no XMP packet in the GIF file")
+		}
+		return MetaData{}, err
+	}
+	b, err := io.ReadAll(io.LimitReader(sr, maxXMPPacketSize))
+	if err != nil {
+		return MetaData{}, err
+	}
+	md, err := ReadXMP(bytes.NewReader(b))
+	if err == nil && md.DateTaken.IsZero() {
+		err = errors.New("no date in the GIF file")
+	}
+	return md, err
+}
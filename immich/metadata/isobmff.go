@@ -0,0 +1,316 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/*
+	HEIF, AVIF and JPEG XL files are ISO base media files.
+
+	The EXIF and the XMP packet of HEIF and AVIF are items of the meta box. The box iinf gives the IDs of
+	the items with the type Exif, and with the type mime and the content type application/rdf+xml.
+	The box iloc gives their position in the file.
+
+	JPEG XL files place the EXIF in an Exif box, and the XMP in a xml box.
+	A bare JPEG XL codestream has no metadata.
+
+	In all cases, the EXIF data starts with the offset of the TIFF header.
+*/
+
+const maxMetaBoxSize = 16 * 1024 * 1024
+
+func readISOBMFFMetaData(r *sliceReader) (MetaData, error) {
+	if b, err := r.Peek(2); err == nil && bytes.Equal(b, []byte{0xff, 0x0a}) {
+		return MetaData{}, errors.New("no metadata in a bare JPEG XL codestream")
+	}
+	cr := &countingReader{r: r}
+	var exifData, xmp []byte
+	for {
+		size, typ, err := readAtomHeader(cr)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return MetaData{}, err
+		}
+		if size < 0 {
+			break // the box extends to the end of the file
+		}
+		switch typ {
+		case "meta", "Exif", "xml ":
+			if size > maxMetaBoxSize {
+				return MetaData{}, fmt.Errorf("%s box too large: %d", typ, size)
+			}
+			b := make([]byte, size)
+			_, err = io.ReadFull(cr, b)
+			if err != nil {
+				return MetaData{}, err
+			}
+			switch typ {
+			case "meta":
+				return readMetaItems(cr, b)
+			case "Exif":
+				exifData = b
+			case "xml ":
+				xmp = b
+			}
+		case "jxlc", "jxlp":
+			if exifData != nil {
+				// the metadata are placed before the codestream
+				return decodeISOBMFFMetaData(exifData, xmp)
+			}
+			fallthrough
+		default:
+			_, err = io.CopyN(io.Discard, cr, size)
+			if err != nil {
+				return MetaData{}, err
+			}
+		}
+	}
+	return decodeISOBMFFMetaData(exifData, xmp)
+}
+
+// readMetaItems reads the Exif and XMP items located by the meta box, in the order of the file
+func readMetaItems(cr *countingReader, meta []byte) (MetaData, error) {
+	items, err := metaItemLocations(meta)
+	if err != nil {
+		return MetaData{}, err
+	}
+	var exifData, xmp []byte
+	for _, it := range items {
+		if it.offset < cr.n {
+			return MetaData{}, fmt.Errorf("the %s item is placed before the meta box", it.typ)
+		}
+		if it.length > maxMetaBoxSize {
+			return MetaData{}, fmt.Errorf("%s item too large: %d", it.typ, it.length)
+		}
+		_, err = io.CopyN(io.Discard, cr, it.offset-cr.n)
+		if err != nil {
+			return MetaData{}, err
+		}
+		b := make([]byte, it.length)
+		_, err = io.ReadFull(cr, b)
+		if err != nil {
+			return MetaData{}, err
+		}
+		if it.typ == "Exif" {
+			exifData = b
+		} else {
+			xmp = b
+		}
+	}
+	return decodeISOBMFFMetaData(exifData, xmp)
+}
+
+// decodeISOBMFFMetaData decodes the EXIF, then merges the XMP packet
+func decodeISOBMFFMetaData(exifData, xmp []byte) (MetaData, error) {
+	var md MetaData
+	err := errors.New("no metadata in the file")
+	if exifData != nil {
+		md, err = decodeExifItem(exifData)
+	}
+	if xmp != nil {
+		md.mergeXMP(xmp)
+		if !md.DateTaken.IsZero() {
+			err = nil
+		}
+	}
+	return md, err
+}
+
+// decodeExifItem skips the offset of the TIFF header and decodes the EXIF
+func decodeExifItem(b []byte) (MetaData, error) {
+	if len(b) < 4 {
+		return MetaData{}, errors.New("invalid Exif item")
+	}
+	offset := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if offset < len(b) {
+		b = b[offset:]
+	}
+	return getExifFromReader(bytes.NewReader(b))
+}
+
+// metaItem is the position of an item in the file
+type metaItem struct {
+	typ            string // Exif or XMP
+	offset, length int64
+}
+
+// metaItemLocations decodes the meta box to get the position of the Exif and XMP items in the file, sorted by offset
+func metaItemLocations(b []byte) ([]metaItem, error) {
+	if len(b) < 4 {
+		return nil, errors.New("invalid meta box")
+	}
+	var (
+		ids       map[uint64]string
+		locations = map[uint64][2]uint64{}
+	)
+	walkAtoms(b[4:], func(typ string, content []byte) {
+		switch typ {
+		case "iinf":
+			ids = metaItemIDs(content)
+		case "iloc":
+			locations = itemLocations(content)
+		}
+	})
+	items := []metaItem{}
+	for id, typ := range ids {
+		if l, ok := locations[id]; ok {
+			items = append(items, metaItem{typ: typ, offset: int64(l[0]), length: int64(l[1])})
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no Exif or XMP item")
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].offset < items[j].offset })
+	return items, nil
+}
+
+// metaItemIDs gives the type of the items of type Exif, and of the XMP items of type mime, by ID
+func metaItemIDs(b []byte) map[uint64]string {
+	ids := map[uint64]string{}
+	c := boxCursor{b: b}
+	version := c.uint(1)
+	c.uint(3) // flags
+	if version == 0 {
+		c.uint(2)
+	} else {
+		c.uint(4)
+	}
+	if c.err {
+		return ids
+	}
+	walkAtoms(c.b, func(typ string, content []byte) {
+		if typ != "infe" {
+			return
+		}
+		c := boxCursor{b: content}
+		version := c.uint(1)
+		c.uint(3) // flags
+		if version < 2 {
+			return
+		}
+		itemID := c.uint(2)
+		if version == 3 {
+			itemID = itemID<<16 | c.uint(2)
+		}
+		c.uint(2) // protection index
+		itemType := string(c.bytes(4))
+		if c.err {
+			return
+		}
+		switch itemType {
+		case "Exif":
+			if !hasItemType(ids, "Exif") {
+				ids[itemID] = "Exif"
+			}
+		case "mime":
+			// item name and content type, null terminated
+			_, rest, _ := bytes.Cut(c.b, []byte{0})
+			contentType, _, _ := bytes.Cut(rest, []byte{0})
+			if string(contentType) == "application/rdf+xml" && !hasItemType(ids, "XMP") {
+				ids[itemID] = "XMP"
+			}
+		}
+	})
+	return ids
+}
+
+func hasItemType(ids map[uint64]string, typ string) bool {
+	for _, t := range ids {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// itemLocations gives the offset and the length of the items stored in one extent of the file
+func itemLocations(b []byte) map[uint64][2]uint64 {
+	locations := map[uint64][2]uint64{}
+	c := boxCursor{b: b}
+	version := c.uint(1)
+	c.uint(3) // flags
+	sizes := c.uint(2)
+	offsetSize, lengthSize, baseOffsetSize := int(sizes>>12), int(sizes>>8&0xf), int(sizes>>4&0xf)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0xf)
+	}
+	var count uint64
+	if version < 2 {
+		count = c.uint(2)
+	} else {
+		count = c.uint(4)
+	}
+	for i := uint64(0); i < count && !c.err; i++ {
+		var itemID uint64
+		if version < 2 {
+			itemID = c.uint(2)
+		} else {
+			itemID = c.uint(4)
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = c.uint(2) & 0xf
+		}
+		c.uint(2) // data reference index
+		baseOffset := c.uint(baseOffsetSize)
+		extents := c.uint(2)
+		var offset, length uint64
+		for j := uint64(0); j < extents; j++ {
+			c.uint(indexSize)
+			offset = c.uint(offsetSize)
+			length = c.uint(lengthSize)
+		}
+		// Only the items stored in the file in one piece are usable
+		if !c.err && method == 0 && extents == 1 {
+			locations[itemID] = [2]uint64{baseOffset + offset, length}
+		}
+	}
+	return locations
+}
+
+// boxCursor reads the fields of a box, err is set when the box is too short
+type boxCursor struct {
+	b   []byte
+	err bool
+}
+
+func (c *boxCursor) bytes(n int) []byte {
+	if n > len(c.b) {
+		c.err = true
+		c.b = nil
+		return nil
+	}
+	v := c.b[:n]
+	c.b = c.b[n:]
+	return v
+}
+
+// uint reads a big endian integer of n bytes
+func (c *boxCursor) uint(n int) uint64 {
+	var v uint64
+	for _, b := range c.bytes(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// countingReader counts the bytes read
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,161 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+/*
+	The JPEG headers are a list of segments, ended by the start of the image data.
+	Besides the EXIF segment, they may hold a XMP packet (APP1) and the IPTC records
+	of Photoshop (APP13), where the keywords are found.
+*/
+
+var (
+	jpegXMPHeader       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegPhotoshopHeader = []byte("Photoshop 3.0\x00")
+)
+
+const (
+	jpegAPP1  = 0xe1
+	jpegAPP13 = 0xed
+	jpegSOS   = 0xda
+	jpegEOI   = 0xd9
+)
+
+// readJPEGMetaData reads the EXIF data and the XMP packet, then the keywords of the IPTC records when the XMP packet gives none
+func readJPEGMetaData(r io.Reader) (MetaData, error) {
+	headers := bytes.NewBuffer(nil)
+	var xmp, iptc []byte
+	_ = readJPEGSegments(io.TeeReader(r, headers), func(marker byte, data []byte) {
+		switch {
+		case marker == jpegAPP1 && bytes.HasPrefix(data, jpegXMPHeader) && xmp == nil:
+			xmp = data[len(jpegXMPHeader):]
+		case marker == jpegAPP13 && bytes.HasPrefix(data, jpegPhotoshopHeader):
+			iptc = append(iptc, photoshopIPTC(data[len(jpegPhotoshopHeader):])...)
+		}
+	})
+
+	// The EXIF reader gets the headers already read, followed by the rest of the file
+	md, err := getExifFromReader(io.MultiReader(headers, r))
+
+	if xmp != nil {
+		md.mergeXMP(xmp)
+		if !md.DateTaken.IsZero() {
+			err = nil
+		}
+	}
+	if len(md.Keywords) == 0 && iptc != nil {
+		md.Keywords = iptcKeywords(iptc)
+	}
+	return md, err
+}
+
+// readJPEGSegments calls fn with the APP1 and APP13 segments, until the start of the image data
+func readJPEGSegments(r io.Reader, fn func(marker byte, data []byte)) error {
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	if b[0] != 0xff || b[1] != 0xd8 {
+		return errors.New("not a JPEG file")
+	}
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		if b[0] != 0xff {
+			return errors.New("invalid JPEG segment")
+		}
+		marker := b[1]
+		for marker == 0xff {
+			// fill bytes
+			if _, err := io.ReadFull(r, b[1:]); err != nil {
+				return err
+			}
+			marker = b[1]
+		}
+		switch {
+		case marker == jpegSOS || marker == jpegEOI:
+			return nil
+		case marker >= 0xd0 && marker <= 0xd8 || marker == 0x01:
+			// segments without length
+			continue
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		l := int(binary.BigEndian.Uint16(b)) - 2
+		if l < 0 {
+			return errors.New("invalid JPEG segment")
+		}
+		if marker != jpegAPP1 && marker != jpegAPP13 {
+			if _, err := io.CopyN(io.Discard, r, int64(l)); err != nil {
+				return err
+			}
+			continue
+		}
+		data := make([]byte, l)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		fn(marker, data)
+	}
+}
+
+// photoshopIPTC gives the IPTC records of the Photoshop's image resources
+func photoshopIPTC(b []byte) []byte {
+	for len(b) >= 12 && bytes.HasPrefix(b, []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(b[4:])
+		// The name is a Pascal string, padded to an even size
+		n := 1 + int(b[6])
+		n += n % 2
+		if len(b) < 6+n+4 {
+			return nil
+		}
+		b = b[6+n:]
+		size := int(binary.BigEndian.Uint32(b))
+		b = b[4:]
+		if size > len(b) {
+			return nil
+		}
+		if id == 0x0404 {
+			return b[:size]
+		}
+		b = b[size+size%2:]
+	}
+	return nil
+}
+
+// iptcKeywords gives the keywords of the IPTC records (dataset 2:25)
+func iptcKeywords(b []byte) []string {
+	keywords := []string{}
+	for len(b) >= 5 && b[0] == 0x1c {
+		record, dataset := b[1], b[2]
+		size := int(binary.BigEndian.Uint16(b[3:]))
+		if size&0x8000 != 0 || 5+size > len(b) {
+			// extended datasets aren't used for the keywords
+			break
+		}
+		if record == 2 && dataset == 25 {
+			keywords = append(keywords, iptcString(b[5:5+size]))
+		}
+		b = b[5+size:]
+	}
+	return keywords
+}
+
+// iptcString decodes a value in UTF-8, or in Latin-1 used by older software
+func iptcString(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
@@ -0,0 +1,90 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func jpegSegment(marker byte, data []byte) []byte {
+	b := []byte{0xff, marker}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)+2))
+	return append(b, data...)
+}
+
+func iptcRecord(dataset byte, value string) []byte {
+	b := []byte{0x1c, 2, dataset}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
+
+func photoshopSegment(iptc []byte) []byte {
+	b := append([]byte{}, jpegPhotoshopHeader...)
+	// a resource before the IPTC's one, with an odd size
+	b = append(b, "8BIM\x04\x0c\x00\x00\x00\x00\x00\x03abc\x00"...)
+	b = append(b, "8BIM\x04\x04\x00\x00"...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(iptc)))
+	return append(b, iptc...)
+}
+
+func corpusJPEGWith(segments ...[]byte) []byte {
+	b := corpusJPEG()
+	b = b[:len(b)-2] // EOI
+	for _, s := range segments {
+		b = append(b, s...)
+	}
+	b = append(b, jpegSegment(jpegSOS, []byte{0, 0, 0})...)
+	return append(b, GenRandomBytes(100)...)
+}
+
+func TestJPEGKeywords(t *testing.T) {
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:subject><rdf:Bag><rdf:li>Holidays</rdf:li><rdf:li>Places/France</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+	iptc := append(iptcRecord(5, "title"), iptcRecord(25, "Paris")...)
+	iptc = append(iptc, iptcRecord(25, "Montr\xe9al")...)
+
+	tests := []struct {
+		name string
+		file []byte
+		want []string
+	}{
+		{
+			name: "none",
+			file: corpusJPEGWith(),
+		},
+		{
+			name: "xmp",
+			file: corpusJPEGWith(jpegSegment(jpegAPP1, append(append([]byte{}, jpegXMPHeader...), xmp...))),
+			want: []string{"Holidays", "Places/France"},
+		},
+		{
+			name: "iptc",
+			file: corpusJPEGWith(jpegSegment(0xe2, []byte("ICC_PROFILE")), jpegSegment(jpegAPP13, photoshopSegment(iptc))),
+			want: []string{"Paris", "Montréal"},
+		},
+		{
+			name: "xmp first",
+			file: corpusJPEGWith(jpegSegment(jpegAPP13, photoshopSegment(iptc)), jpegSegment(jpegAPP1, append(append([]byte{}, jpegXMPHeader...), xmp...))),
+			want: []string{"Holidays", "Places/France"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := GetFromReader(bytes.NewReader(tt.file), ".jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !md.DateTaken.Equal(corpusDate) {
+				t.Errorf("DateTaken = %s, want %s", md.DateTaken, corpusDate)
+			}
+			if len(md.Keywords) != 0 || len(tt.want) != 0 {
+				if !reflect.DeepEqual(md.Keywords, tt.want) {
+					t.Errorf("Keywords = %q, want %q", md.Keywords, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+/*
+	Matroska and WebM files are made of EBML elements: ID, size and content.
+	The date of the recording is the element DateUTC of the segment's Info element,
+	in nanoseconds since 2001-01-01 UTC.
+*/
+
+const (
+	mkvEBML    = 0x1a45dfa3
+	mkvSegment = 0x18538067
+	mkvInfo    = 0x1549a966
+	mkvCluster = 0x1f43b675
+	mkvDateUTC = 0x4461
+
+	maxMkvInfoSize = 1024 * 1024
+)
+
+var mkvEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type ebmlReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func readMatroskaMetaData(r *sliceReader) (MetaData, error) {
+	id, size, err := readEBMLElement(r)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if id != mkvEBML || size < 0 {
+		return MetaData{}, errors.New("not a matroska file")
+	}
+	_, err = io.CopyN(io.Discard, r, size)
+	if err != nil {
+		return MetaData{}, err
+	}
+	id, _, err = readEBMLElement(r)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if id != mkvSegment {
+		return MetaData{}, errors.New("no segment in the matroska file")
+	}
+
+	// Search the Info element in the segment
+	for {
+		id, size, err = readEBMLElement(r)
+		if err != nil {
+			return MetaData{}, err
+		}
+		if id == mkvCluster || size < 0 {
+			return MetaData{}, errors.New("no date in the matroska file")
+		}
+		if id != mkvInfo {
+			_, err = io.CopyN(io.Discard, r, size)
+			if err != nil {
+				return MetaData{}, err
+			}
+			continue
+		}
+		if size > maxMkvInfoSize {
+			return MetaData{}, fmt.Errorf("info element too large: %d", size)
+		}
+		b := make([]byte, size)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return MetaData{}, err
+		}
+		return decodeMkvInfo(bytes.NewReader(b))
+	}
+}
+
+func decodeMkvInfo(r *bytes.Reader) (MetaData, error) {
+	for r.Len() > 0 {
+		id, size, err := readEBMLElement(r)
+		if err != nil {
+			return MetaData{}, err
+		}
+		if size < 0 || size > int64(r.Len()) {
+			break
+		}
+		b := make([]byte, size)
+		_, _ = r.Read(b)
+		if id == mkvDateUTC && size <= 8 {
+			var ns int64
+			for i, c := range b {
+				if i == 0 {
+					ns = int64(int8(c)) // signed integer
+					continue
+				}
+				ns = ns<<8 | int64(c)
+			}
+			return MetaData{DateTaken: mkvEpoch.Add(time.Duration(ns)), DateIsUTC: true}, nil
+		}
+	}
+	return MetaData{}, errors.New("no date in the matroska file")
+}
+
+// readEBMLElement gives the ID and the size of the element, the size is -1 when unknown
+func readEBMLElement(r ebmlReader) (uint64, int64, error) {
+	id, _, err := readEBMLVint(r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, l, err := readEBMLVint(r, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size == 1<<(7*l)-1 {
+		return id, -1, nil
+	}
+	return id, int64(size), nil
+}
+
+// readEBMLVint reads a variable length integer, the length is given by the leading zeros of the first byte
+func readEBMLVint(r ebmlReader, keepMarker bool) (uint64, int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	l := bits.LeadingZeros8(b) + 1
+	if l > 8 {
+		return 0, 0, errors.New("invalid EBML integer")
+	}
+	v := uint64(b)
+	if !keepMarker {
+		v &= 0xff >> l
+	}
+	for i := 1; i < l; i++ {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, l, nil
+}
@@ -3,6 +3,7 @@ package metadata
 import (
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/simulot/immich-go/helpers/tzone"
@@ -26,6 +27,20 @@ func TakeTimeFromName(name string) time.Time {
 	if err != nil {
 		panic(err)
 	}
+	t := TakeTimeFromNameInLocation(name, time.UTC)
+	if t.IsZero() {
+		return t
+	}
+	return t.In(local)
+}
+
+// TakeTimeFromNameInLocation reads the date of the name as a time in the given location,
+// the time zone of the capture when it is known.
+// Pixel phones name the files with the UTC time.
+func TakeTimeFromNameInLocation(name string, loc *time.Location) time.Time {
+	if strings.HasPrefix(name, "PXL_") {
+		loc = time.UTC
+	}
 
 	// check for known exceptions...
 	mm := nexusBurstRE.FindStringSubmatch(name)
@@ -40,7 +55,7 @@ func TakeTimeFromName(name string) time.Time {
 				m[i-1], _ = strconv.Atoi(mm[i])
 			}
 		}
-		t := time.Date(m[0], time.Month(m[1]), m[2], m[3], m[4], m[5], 0, time.UTC)
+		t := time.Date(m[0], time.Month(m[1]), m[2], m[3], m[4], m[5], 0, loc)
 		if t.Year() != m[0] || t.Month() != time.Month(m[1]) || t.Day() != m[2] ||
 			t.Hour() != m[3] || t.Minute() != m[4] || t.Second() != m[5] {
 			// Date is invalid, return an error or default time value
@@ -50,7 +65,7 @@ func TakeTimeFromName(name string) time.Time {
 			// Discard dates in the future
 			return time.Time{}
 		}
-		return t.In(local)
+		return t
 	}
 	return time.Time{}
 }
@@ -73,3 +73,32 @@ func TestTakeTimeFromName(t *testing.T) {
 		})
 	}
 }
+
+func TestTakeTimeFromNameInLocation(t *testing.T) {
+	tokyo := time.FixedZone("", 9*3600)
+	tests := []struct {
+		name     string
+		expected time.Time
+	}{
+		{
+			name:     "IMG_20231006_083000.jpg",
+			expected: time.Date(2023, 10, 6, 8, 30, 0, 0, tokyo),
+		},
+		{
+			name:     "PXL_20231006_083000123.jpg",
+			expected: time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "IMG_1234.jpg",
+			expected: time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TakeTimeFromNameInLocation(tt.name, tokyo); !got.Equal(tt.expected) {
+				t.Errorf("TakeTimeFromNameInLocation() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+/*
+	PNG files give the metadata in chunks:
+	- eXIf: the EXIF data, since the version 1.5 of the specification
+	- tEXt, zTXt, iTXt: text with a keyword. The keyword "Creation Time" gives the date,
+	  "XML:com.adobe.xmp" a XMP packet, and ImageMagick writes the EXIF in hexadecimal with the
+	  keyword "Raw profile type exif"
+*/
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+const maxPNGChunkSize = 16 * 1024 * 1024
+
+func readPNGMetaData(r io.Reader) (MetaData, error) {
+	sig := make([]byte, len(pngSignature))
+	_, err := io.ReadFull(r, sig)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if !bytes.Equal(sig, pngSignature) {
+		return MetaData{}, errors.New("not a PNG file")
+	}
+
+	var md, text MetaData
+	h := make([]byte, 8)
+	for {
+		_, err = io.ReadFull(r, h)
+		if err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(h))
+		typ := string(h[4:8])
+		if typ == "IEND" {
+			break
+		}
+		if (typ != "eXIf" && typ != "tEXt" && typ != "zTXt" && typ != "iTXt") || size > maxPNGChunkSize {
+			_, err = io.CopyN(io.Discard, r, size+4) // data and CRC
+			if err != nil {
+				break
+			}
+			continue
+		}
+		b := make([]byte, size+4)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			break
+		}
+		b = b[:size]
+		if typ == "eXIf" {
+			md, err = getExifFromReader(bytes.NewReader(b))
+			if err == nil && !md.DateTaken.IsZero() {
+				return md, nil
+			}
+			continue
+		}
+		keyword, value, err := pngText(typ, b)
+		if err != nil || !text.DateTaken.IsZero() {
+			continue
+		}
+		switch keyword {
+		case "Creation Time":
+			text.DateTaken, text.TimeZone, _ = parseDateTime(strings.TrimSpace(value))
+		case "XML:com.adobe.xmp":
+			text, _ = ReadXMP(strings.NewReader(value))
+		case "Raw profile type exif", "Raw profile type APP1":
+			if x, err := pngRawProfile(value); err == nil {
+				text, _ = getExifFromReader(bytes.NewReader(x))
+			}
+		}
+	}
+
+	if md.DateTaken.IsZero() {
+		md.DateTaken, md.TimeZone = text.DateTaken, text.TimeZone
+	}
+	if md.DateTaken.IsZero() {
+		return md, errors.New("no date in the PNG file")
+	}
+	return md, nil
+}
+
+// pngText gives the keyword and the text of tEXt, zTXt and iTXt chunks
+func pngText(typ string, b []byte) (string, string, error) {
+	keyword, b, ok := bytes.Cut(b, []byte{0})
+	if !ok {
+		return "", "", errors.New("invalid text chunk")
+	}
+	compressed := false
+	switch typ {
+	case "zTXt":
+		if len(b) < 1 {
+			return "", "", errors.New("invalid text chunk")
+		}
+		b = b[1:] // compression method
+		compressed = true
+	case "iTXt":
+		if len(b) < 2 {
+			return "", "", errors.New("invalid text chunk")
+		}
+		compressed = b[0] == 1
+		b = b[2:]
+		// language and translated keyword
+		for i := 0; i < 2; i++ {
+			_, b, ok = bytes.Cut(b, []byte{0})
+			if !ok {
+				return "", "", errors.New("invalid text chunk")
+			}
+		}
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return "", "", err
+		}
+		b, err = io.ReadAll(io.LimitReader(zr, maxPNGChunkSize))
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return string(keyword), string(b), nil
+}
+
+// pngRawProfile decodes the profiles written by ImageMagick: name, length and hexadecimal data
+func pngRawProfile(s string) ([]byte, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return nil, errors.New("invalid raw profile")
+	}
+	return hex.DecodeString(strings.Join(fields[2:], ""))
+}
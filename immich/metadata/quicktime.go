@@ -1,7 +1,14 @@
 package metadata
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -74,25 +81,25 @@ func decodeMvhdAtom(r *sliceReader) (*MvhdAtom, error) {
 		if err != nil {
 			return nil, err
 		}
-		a.ModificationTime = convertTime32(binary.BigEndian.Uint32(b))
+		a.CreationTime = convertTime32(binary.BigEndian.Uint32(b))
 		b, err = r.ReadSlice(4)
 		if err != nil {
 			return nil, err
 		}
-		a.CreationTime = convertTime32(binary.BigEndian.Uint32(b))
+		a.ModificationTime = convertTime32(binary.BigEndian.Uint32(b))
 	} else {
-		// Read the creation time (4 bytes)
+		// Read the creation time (8 bytes)
 		b, err := r.ReadSlice(8)
 		if err != nil {
 			return nil, err
 		}
-		a.ModificationTime = convertTime64(binary.BigEndian.Uint64(b))
+		a.CreationTime = convertTime64(binary.BigEndian.Uint64(b))
 
 		b, err = r.ReadSlice(8)
 		if err != nil {
 			return nil, err
 		}
-		a.CreationTime = convertTime64(binary.BigEndian.Uint64(b))
+		a.ModificationTime = convertTime64(binary.BigEndian.Uint64(b))
 	}
 
 	return a, nil
@@ -107,8 +114,356 @@ func convertTime64(timestamp uint64) time.Time {
 	epochOffset := int64(2082844800)
 
 	// Convert the creation time to Unix timestamp
-	unixTimestamp := int64(timestamp>>32) - epochOffset
+	unixTimestamp := int64(timestamp) - epochOffset
 
 	// Convert the Unix timestamp to time.Time
 	return time.Unix(unixTimestamp, 0)
 }
+
+/*
+The metadata of a movie are in the moov atom, usually placed at the end of the file:
+
+	moov
+		mvhd		the creation time, in UTC
+		trak
+			tkhd	the dimensions and the rotation matrix of the track
+		udta
+			©xyz	the location, ISO 6709 (Android, Samsung...)
+			©mak	the camera's make
+			©mod	the camera's model
+			XMP_	the XMP packet (QuickTime)
+		meta
+			keys	the list of keys (Apple)
+			ilst	the values of the keys
+
+The XMP packet of MP4 files is in a uuid atom placed at the top level, beside the moov atom.
+*/
+
+const maxMoovSize = 64 * 1024 * 1024
+
+var errNoMoov = errors.New("no moov atom")
+
+// The uuid of the atom holding the XMP packet
+var xmpUUID = []byte{0xbe, 0x7a, 0xcf, 0xcb, 0x97, 0xa9, 0x42, 0xe8, 0x9c, 0x71, 0x99, 0x94, 0x91, 0xe3, 0xaf, 0xac}
+
+// readMP4MetaData walks the atoms of the file to decode the moov atom and the XMP packet.
+// The media data placed after the moov atom aren't read.
+func readMP4MetaData(r io.Reader) (MetaData, error) {
+	var moov, xmp []byte
+walk:
+	for {
+		size, typ, err := readAtomHeader(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return MetaData{}, err
+		}
+		if size < 0 {
+			// the atom goes to the end of the file
+			break
+		}
+		switch {
+		case typ == "moov" || typ == "uuid" && size <= maxXMPPacketSize:
+			if size > maxMoovSize {
+				return MetaData{}, fmt.Errorf("moov atom too large: %d", size)
+			}
+			b := make([]byte, size)
+			_, err = io.ReadFull(r, b)
+			if err != nil {
+				return MetaData{}, err
+			}
+			if typ == "moov" {
+				moov = b
+			} else if bytes.HasPrefix(b, xmpUUID) {
+				xmp = b[len(xmpUUID):]
+			}
+		case typ == "mdat" && moov != nil:
+			break walk
+		default:
+			err = skipAtom(r, size)
+			if err != nil {
+				return MetaData{}, err
+			}
+		}
+	}
+	if moov == nil {
+		return MetaData{}, errNoMoov
+	}
+	md, err := decodeMoovAtom(moov)
+	if xmp != nil {
+		md.mergeXMP(xmp)
+		if !md.DateTaken.IsZero() {
+			err = nil
+		}
+	}
+	return md, err
+}
+
+// readMoovAtom gives the content of the moov atom. The other atoms are skipped.
+func readMoovAtom(r io.Reader) ([]byte, error) {
+	for {
+		size, typ, err := readAtomHeader(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errNoMoov
+			}
+			return nil, err
+		}
+		if size < 0 {
+			if typ != "moov" {
+				return nil, errNoMoov
+			}
+			return io.ReadAll(io.LimitReader(r, maxMoovSize))
+		}
+		if typ != "moov" {
+			err = skipAtom(r, size)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if size > maxMoovSize {
+			return nil, fmt.Errorf("moov atom too large: %d", size)
+		}
+		b := make([]byte, size)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+}
+
+// skipAtom skips the content of the atom, without reading it when the reader can seek
+func skipAtom(r io.Reader, size int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(size, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, size)
+	return err
+}
+
+// readAtomHeader gives the size of the atom's content, -1 when the atom extends to the end of the file
+func readAtomHeader(r io.Reader) (int64, string, error) {
+	h := make([]byte, 8)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return 0, "", err
+	}
+	size := int64(binary.BigEndian.Uint32(h))
+	typ := string(h[4:8])
+	switch size {
+	case 0:
+		return -1, typ, nil
+	case 1:
+		_, err = io.ReadFull(r, h)
+		if err != nil {
+			return 0, "", err
+		}
+		size = int64(binary.BigEndian.Uint64(h)) - 16
+	default:
+		size -= 8
+	}
+	if size < 0 {
+		return 0, "", fmt.Errorf("invalid size for the atom %q", typ)
+	}
+	return size, typ, nil
+}
+
+// walkAtoms calls fn for each atom of b with the atom's type and content
+func walkAtoms(b []byte, fn func(typ string, content []byte)) {
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		start := 8
+		switch size {
+		case 0:
+			size = len(b)
+		case 1:
+			if len(b) < 16 {
+				return
+			}
+			size = int(binary.BigEndian.Uint64(b[8:]))
+			start = 16
+		}
+		if size < start || size > len(b) {
+			return
+		}
+		fn(typ, b[start:size])
+		b = b[size:]
+	}
+}
+
+func decodeMoovAtom(b []byte) (MetaData, error) {
+	md := MetaData{}
+	var err error = errNoMoov
+	var xmp []byte
+	walkAtoms(b, func(typ string, content []byte) {
+		switch typ {
+		case "mvhd":
+			var a *MvhdAtom
+			a, err = decodeMvhdAtom(newSliceReader(io.MultiReader(bytes.NewReader([]byte(typ)), bytes.NewReader(content))))
+			if err == nil {
+				md.DateTaken, md.DateIsUTC = a.CreationTime, true
+			}
+		case "trak":
+			if md.Width == 0 {
+				decodeTrakAtom(content, &md)
+			}
+		case "udta":
+			if x := decodeUdtaAtom(content, &md); x != nil {
+				xmp = x
+			}
+		case "meta":
+			decodeMetaAtom(content, &md)
+		}
+	})
+	if xmp != nil {
+		md.mergeXMP(xmp)
+		if !md.DateTaken.IsZero() {
+			err = nil
+		}
+	}
+	return md, err
+}
+
+func decodeTrakAtom(b []byte, md *MetaData) {
+	walkAtoms(b, func(typ string, content []byte) {
+		if typ != "tkhd" || len(content) < 4 {
+			return
+		}
+		// version, flags, times, track ID, reserved, duration, reserved, layer, group, volume, reserved
+		p := 4 + 20 + 16
+		if content[0] == 1 {
+			p = 4 + 32 + 16
+		}
+		if len(content) < p+36+8 {
+			return
+		}
+		w := binary.BigEndian.Uint32(content[p+36:]) >> 16
+		h := binary.BigEndian.Uint32(content[p+40:]) >> 16
+		if w == 0 || h == 0 {
+			return // not a video track
+		}
+		md.Width, md.Height = int(w), int(h)
+		a := int32(binary.BigEndian.Uint32(content[p:]))
+		c := int32(binary.BigEndian.Uint32(content[p+4:]))
+		switch {
+		case a == 0 && c > 0:
+			md.Orientation = 6 // 90°
+		case a < 0 && c == 0:
+			md.Orientation = 3 // 180°
+		case a == 0 && c < 0:
+			md.Orientation = 8 // 270°
+		default:
+			md.Orientation = 1
+		}
+	})
+}
+
+// decodeUdtaAtom decodes the user data, and gives the XMP packet
+func decodeUdtaAtom(b []byte, md *MetaData) []byte {
+	var xmp []byte
+	walkAtoms(b, func(typ string, content []byte) {
+		switch typ {
+		case "\xa9xyz":
+			setISO6709(udtaString(content), md)
+		case "\xa9mak":
+			md.Make = udtaString(content)
+		case "\xa9mod":
+			md.Model = udtaString(content)
+		case "meta":
+			decodeMetaAtom(content, md)
+		case "XMP_":
+			xmp = content
+		}
+	})
+	return xmp
+}
+
+// udtaString decodes the strings of the user data: length, language, value
+func udtaString(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	l := int(binary.BigEndian.Uint16(b))
+	if 4+l > len(b) {
+		l = len(b) - 4
+	}
+	return strings.TrimRight(string(b[4:4+l]), "\x00")
+}
+
+// decodeMetaAtom decodes the Apple's keys and values
+func decodeMetaAtom(b []byte, md *MetaData) {
+	if len(b) >= 8 && string(b[4:8]) != "hdlr" {
+		b = b[4:] // The ISO meta atom has version and flags
+	}
+	keys := []string{}
+	values := map[int]string{}
+	walkAtoms(b, func(typ string, content []byte) {
+		switch typ {
+		case "keys":
+			if len(content) < 8 {
+				return
+			}
+			walkAtoms(content[8:], func(namespace string, key []byte) {
+				keys = append(keys, string(key))
+			})
+		case "ilst":
+			walkIlst(content, values)
+		}
+	})
+	for i, k := range keys {
+		v, ok := values[i+1]
+		if !ok {
+			continue
+		}
+		switch k {
+		case "com.apple.quicktime.location.ISO6709":
+			setISO6709(v, md)
+		case "com.apple.quicktime.make":
+			md.Make = v
+		case "com.apple.quicktime.model":
+			md.Model = v
+		case "com.apple.quicktime.creationdate":
+			if t, err := time.Parse("2006-01-02T15:04:05-0700", v); err == nil {
+				md.TimeZone = t.Location()
+			}
+		}
+	}
+}
+
+// walkIlst collects the values of the list, by index of key
+func walkIlst(b []byte, values map[int]string) {
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return
+		}
+		index := int(binary.BigEndian.Uint32(b[4:]))
+		walkAtoms(b[8:size], func(typ string, content []byte) {
+			if typ == "data" && len(content) >= 8 {
+				values[index] = string(content[8:])
+			}
+		})
+		b = b[size:]
+	}
+}
+
+var reISO6709 = regexp.MustCompile(`^([+-]\d+(?:\.\d*)?)([+-]\d+(?:\.\d*)?)([+-]\d+(?:\.\d*)?)?`)
+
+// setISO6709 decodes locations like +48.8577+002.2950+035.000/
+func setISO6709(s string, md *MetaData) {
+	m := reISO6709.FindStringSubmatch(s)
+	if m == nil {
+		return
+	}
+	lat, err1 := strconv.ParseFloat(m[1], 64)
+	long, err2 := strconv.ParseFloat(m[2], 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	md.Latitude, md.Longitude = lat, long
+	if m[3] != "" {
+		md.Altitude, _ = strconv.ParseFloat(m[3], 64)
+	}
+}
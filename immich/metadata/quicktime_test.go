@@ -0,0 +1,103 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// atom builds a quicktime atom with its content
+func atom(typ string, content ...[]byte) []byte {
+	b := bytes.Join(content, nil)
+	return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(b))), typ...), b...)
+}
+
+func u32(v ...uint32) []byte {
+	b := []byte{}
+	for _, i := range v {
+		b = binary.BigEndian.AppendUint32(b, i)
+	}
+	return b
+}
+
+// udtaValue is a user data string: length, language, value
+func udtaValue(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s)), 0x15, 0xc7}, s...)
+}
+
+func TestMP4MetaData(t *testing.T) {
+	created := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	mvhd := atom("mvhd", u32(0, uint32(created.Unix()+2082844800), uint32(created.Unix()+2082844800), 1000, 5000))
+
+	// matrix for a rotation of 90°
+	matrix := u32(0, 0x10000, 0, 0xffff0000, 0, 0, 0, 0, 0x40000000)
+	tkhd := atom("tkhd", make([]byte, 4+20+16), matrix, u32(1920<<16, 1080<<16))
+
+	keys := atom("keys", u32(0, 3),
+		atom("mdta", []byte("com.apple.quicktime.make")),
+		atom("mdta", []byte("com.apple.quicktime.model")),
+		atom("mdta", []byte("com.apple.quicktime.creationdate")),
+	)
+	ilstItem := func(index uint32, v string) []byte {
+		return append(u32(uint32(8+16+len(v)), index), atom("data", u32(1, 0), []byte(v))...)
+	}
+	ilst := atom("ilst", ilstItem(1, "Apple"), ilstItem(2, "iPhone 12"), ilstItem(3, "2023-10-06T08:30:00+0200"))
+	meta := atom("meta", atom("hdlr", make([]byte, 25)), keys, ilst)
+
+	moov := atom("moov",
+		mvhd,
+		atom("trak", tkhd),
+		atom("udta", atom("\xa9xyz", udtaValue("+48.8577-002.2950+035.000/"))),
+		meta,
+	)
+	b := bytes.Join([][]byte{
+		atom("ftyp", []byte("qt  "), u32(0), []byte("qt  ")),
+		atom("mdat", GenRandomBytes(1000)),
+		moov,
+	}, nil)
+
+	md, err := GetFromReader(bytes.NewReader(b), ".MOV")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.DateTaken.Equal(created) {
+		t.Errorf("unexpected date: %s", md.DateTaken)
+	}
+	if md.Make != "Apple" || md.Model != "iPhone 12" {
+		t.Errorf("unexpected camera: %q %q", md.Make, md.Model)
+	}
+	if md.Orientation != 6 || md.Width != 1920 || md.Height != 1080 {
+		t.Errorf("unexpected orientation and dimensions: %d %dx%d", md.Orientation, md.Width, md.Height)
+	}
+	if math.Abs(md.Latitude-48.8577) > 1e-6 || math.Abs(md.Longitude+2.295) > 1e-6 || md.Altitude != 35 {
+		t.Errorf("unexpected location: %f %f %f", md.Latitude, md.Longitude, md.Altitude)
+	}
+	if md.TimeZone == nil {
+		t.Fatalf("expecting a time zone")
+	}
+	if _, offset := created.In(md.TimeZone).Zone(); offset != 2*3600 {
+		t.Errorf("unexpected time zone offset: %d", offset)
+	}
+}
+
+func TestISO6709(t *testing.T) {
+	tests := []struct {
+		s              string
+		lat, long, alt float64
+	}{
+		{s: "+48.8577+002.2950/", lat: 48.8577, long: 2.295},
+		{s: "-33.8688+151.2093+012.500/", lat: -33.8688, long: 151.2093, alt: 12.5},
+		{s: "garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			md := MetaData{}
+			setISO6709(tt.s, &md)
+			if md.Latitude != tt.lat || md.Longitude != tt.long || md.Altitude != tt.alt {
+				t.Errorf("setISO6709(%q) = %f %f %f", tt.s, md.Latitude, md.Longitude, md.Altitude)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// readTIFFMetaData reads TIFF files and the RAW formats based on TIFF.
+// Olympus and Panasonic use their own magic numbers in the TIFF header.
+func readTIFFMetaData(r io.Reader) (MetaData, error) {
+	h := make([]byte, 4)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return MetaData{}, err
+	}
+	switch string(h) {
+	case "IIRO", "IIRS", "IIU\x00":
+		h = []byte("II*\x00")
+	case "MMOR":
+		h = []byte("MM\x00*")
+	}
+	return getExifFromReader(io.MultiReader(bytes.NewReader(h), r))
+}
+
+// readRAFMetaData reads the EXIF of the JPEG preview of Fujifilm RAF files
+func readRAFMetaData(r io.Reader) (MetaData, error) {
+	h := make([]byte, 92)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if string(h[:16]) != "FUJIFILMCCD-RAW " {
+		return MetaData{}, errors.New("not a RAF file")
+	}
+	offset := int64(binary.BigEndian.Uint32(h[84:]))
+	length := int64(binary.BigEndian.Uint32(h[88:]))
+	if offset < int64(len(h)) {
+		return MetaData{}, errors.New("invalid RAF header")
+	}
+	_, err = io.CopyN(io.Discard, r, offset-int64(len(h)))
+	if err != nil {
+		return MetaData{}, err
+	}
+	return getExifFromReader(io.LimitReader(r, length))
+}
+
+// readMRWMetaData reads the TIFF block of Minolta MRW files
+func readMRWMetaData(r io.Reader) (MetaData, error) {
+	h := make([]byte, 8)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if string(h[:4]) != "\x00MRM" {
+		return MetaData{}, errors.New("not a MRW file")
+	}
+	r = io.LimitReader(r, int64(binary.BigEndian.Uint32(h[4:])))
+	for {
+		_, err = io.ReadFull(r, h)
+		if err != nil {
+			return MetaData{}, err
+		}
+		size := int64(binary.BigEndian.Uint32(h[4:]))
+		if string(h[:4]) == "\x00TTW" {
+			return getExifFromReader(io.LimitReader(r, size))
+		}
+		_, err = io.CopyN(io.Discard, r, size)
+		if err != nil {
+			return MetaData{}, err
+		}
+	}
+}
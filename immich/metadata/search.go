@@ -31,21 +31,24 @@ func searchPattern(r io.Reader, pattern []byte, buffer []byte) (*sliceReader, er
 	for {
 		// Read a chunk of data into the buffer
 		bytesRead, err = r.Read(buffer[ofs:])
-		if err != nil {
-			return nil, err
-		}
+		n := ofs + bytesRead
 
 		// Search for the pattern within the buffer
-		index := bytes.Index(buffer[:ofs+bytesRead], pattern)
+		index := bytes.Index(buffer[:n], pattern)
 		if index >= 0 {
-			return newSliceReader(io.MultiReader(bytes.NewReader(buffer[index:]), r)), nil
+			return newSliceReader(io.MultiReader(bytes.NewReader(buffer[index:n]), r)), nil
+		}
+		if err != nil {
+			return nil, err
 		}
 
-		// Move the remaining bytes of the current buffer to the beginning
-		p := bytesRead + ofs - len(pattern) + 1
-
-		copy(buffer, buffer[p:bytesRead+ofs])
-		ofs = len(pattern) - 1
+		// Move the remaining bytes of the current buffer to the beginning, the input may be shorter than the pattern
+		if n >= len(pattern) {
+			copy(buffer, buffer[n-len(pattern)+1:n])
+			ofs = len(pattern) - 1
+		} else {
+			ofs = n
+		}
 		pos += bytesRead
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"io"
 	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func GenRandomBytes(size int) (blk []byte) {
@@ -77,6 +78,18 @@ func Test_searchPattern(t *testing.T) {
 			pattern: []byte("date:"),
 			found:   true,
 		},
+		{
+			name:    "shorter than the pattern",
+			r:       bytes.NewReader([]byte{1, 2, 3}),
+			pattern: []byte("date:"),
+			found:   false,
+		},
+		{
+			name:    "in short reads",
+			r:       iotest.OneByteReader(bytes.NewReader([]byte("the date:2023-08-01T20:20:00"))),
+			pattern: []byte("date:"),
+			found:   true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
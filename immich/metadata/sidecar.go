@@ -2,11 +2,16 @@ package metadata
 
 import (
 	"bytes"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
+	"strings"
 	"text/template"
 	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
 )
 
 // SideCar
@@ -15,9 +20,15 @@ type SideCar struct {
 	OnFSsys  bool
 
 	DateTaken time.Time
+	TimeZone  *time.Location // time zone of the capture, the local time zone when nil
 	Latitude  float64
 	Longitude float64
 	Elevation float64
+
+	Title       string
+	Description string
+	Rating      int // -1 for rejected, 0 to 5 stars
+	Keywords    []string
 }
 
 func (sc *SideCar) Open(fsys fs.FS, name string) (io.ReadCloser, error) {
@@ -43,16 +54,75 @@ func (sc *SideCar) Bytes() ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-var sidecarTemplate = template.Must(template.New("xmp").Parse(`<x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.56'>
+var sidecarTemplate = template.Must(template.New("xmp").Funcs(template.FuncMap{
+	"dateTime":   xmpDateTime,
+	"coordinate": xmpCoordinate,
+	"rational":   xmpRational,
+	"xml":        xmlEscape,
+}).Parse(`<x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.56'>
 <rdf:RDF xmlns:rdf='http://www.w3.org/1999/02/22-rdf-syntax-ns#'>
  <rdf:Description rdf:about=''
-  xmlns:exif='http://ns.adobe.com/exif/1.0/'>
+  xmlns:exif='http://ns.adobe.com/exif/1.0/'
+  xmlns:xmp='http://ns.adobe.com/xap/1.0/'
+  xmlns:dc='http://purl.org/dc/elements/1.1/'>
   <exif:ExifVersion>0232</exif:ExifVersion>
-  <exif:DateTimeOriginal>{{((.DateTaken).Local).Format "2006-01-02T15:04:05"}}</exif:DateTimeOriginal>
-  <exif:GPSAltitude>{{.Elevation}}</exif:GPSAltitude>
-  <exif:GPSLatitude>{{.Latitude}}</exif:GPSLatitude>
-  <exif:GPSLongitude>{{.Longitude}}</exif:GPSLongitude>  
-  <exif:GPSTimeStamp>{{((.DateTaken).UTC).Format "2006-01-02T15:04:05+0000"}}</exif:GPSTimeStamp>
+{{- if not .DateTaken.IsZero}}
+  <exif:DateTimeOriginal>{{dateTime .DateTaken .TimeZone}}</exif:DateTimeOriginal>
+  <exif:GPSTimeStamp>{{((.DateTaken).UTC).Format "2006-01-02T15:04:05Z"}}</exif:GPSTimeStamp>
+{{- end}}
+{{- if or .Latitude .Longitude}}
+  <exif:GPSLatitude>{{coordinate .Latitude "N" "S"}}</exif:GPSLatitude>
+  <exif:GPSLongitude>{{coordinate .Longitude "E" "W"}}</exif:GPSLongitude>
+  <exif:GPSAltitude>{{rational .Elevation}}</exif:GPSAltitude>
+  <exif:GPSAltitudeRef>{{if lt .Elevation 0.0}}1{{else}}0{{end}}</exif:GPSAltitudeRef>
+{{- end}}
+{{- with .Title}}
+  <dc:title><rdf:Alt><rdf:li xml:lang='x-default'>{{xml .}}</rdf:li></rdf:Alt></dc:title>
+{{- end}}
+{{- with .Description}}
+  <dc:description><rdf:Alt><rdf:li xml:lang='x-default'>{{xml .}}</rdf:li></rdf:Alt></dc:description>
+{{- end}}
+{{- if .Rating}}
+  <xmp:Rating>{{.Rating}}</xmp:Rating>
+{{- end}}
+{{- with .Keywords}}
+  <dc:subject><rdf:Bag>{{range .}}<rdf:li>{{xml .}}</rdf:li>{{end}}</rdf:Bag></dc:subject>
+{{- end}}
  </rdf:Description>
 </rdf:RDF>
 </x:xmpmeta>`))
+
+// xmpDateTime gives the date with the offset of the time zone of the capture,
+// or of the local time zone, given by -time-zone, when the zone of the capture is unknown
+func xmpDateTime(t time.Time, tz *time.Location) (string, error) {
+	if tz == nil {
+		local, err := tzone.Local()
+		if err != nil {
+			return "", err
+		}
+		tz = local
+	}
+	return t.In(tz).Format("2006-01-02T15:04:05-07:00"), nil
+}
+
+// xmpCoordinate writes the coordinate like 48,51.462000N
+func xmpCoordinate(v float64, positive, negative string) string {
+	ref := positive
+	if v < 0 {
+		ref = negative
+		v = -v
+	}
+	d := math.Floor(v)
+	return fmt.Sprintf("%d,%.6f%s", int(d), (v-d)*60, ref)
+}
+
+// xmpRational writes the absolute value with a precision of 1/100
+func xmpRational(v float64) string {
+	return fmt.Sprintf("%d/100", int64(math.Round(math.Abs(v)*100)))
+}
+
+func xmlEscape(s string) string {
+	b := strings.Builder{}
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package metadata
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSideCar(t *testing.T) {
+	tz := time.FixedZone("", -5*3600)
+	sc := SideCar{
+		DateTaken:   time.Date(2023, 10, 6, 13, 30, 0, 0, time.UTC),
+		TimeZone:    tz,
+		Latitude:    -33.8688,
+		Longitude:   151.2093,
+		Elevation:   -12.5,
+		Title:       "Tom & Jerry",
+		Description: `<b>"quoted"</b>`,
+		Rating:      4,
+		Keywords:    []string{"cats & mice", "cartoon"},
+	}
+	b, err := sc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<exif:DateTimeOriginal>2023-10-06T08:30:00-05:00</exif:DateTimeOriginal>",
+		"<exif:GPSLatitude>33,52.128000S</exif:GPSLatitude>",
+		"<exif:GPSLongitude>151,12.558000E</exif:GPSLongitude>",
+		"<exif:GPSAltitude>1250/100</exif:GPSAltitude>",
+		"<exif:GPSAltitudeRef>1</exif:GPSAltitudeRef>",
+		"Tom &amp; Jerry",
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("the sidecar doesn't contain %s:\n%s", s, b)
+		}
+	}
+
+	md, err := ReadXMP(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.DateTaken.Equal(sc.DateTaken) {
+		t.Errorf("unexpected date: %s", md.DateTaken)
+	}
+	if _, offset := md.DateTaken.Zone(); offset != -5*3600 {
+		t.Errorf("unexpected time zone offset: %d", offset)
+	}
+	if math.Abs(md.Latitude-sc.Latitude) > 1e-6 || math.Abs(md.Longitude-sc.Longitude) > 1e-6 || md.Altitude != sc.Elevation {
+		t.Errorf("unexpected location: %f %f %f", md.Latitude, md.Longitude, md.Altitude)
+	}
+	if md.Title != sc.Title || md.Description != sc.Description || md.Rating != sc.Rating || !reflect.DeepEqual(md.Keywords, sc.Keywords) {
+		t.Errorf("unexpected values: %q %q %d %v", md.Title, md.Description, md.Rating, md.Keywords)
+	}
+}
+
+func TestSideCarWithoutLocation(t *testing.T) {
+	sc := SideCar{DateTaken: time.Date(2023, 10, 6, 13, 30, 0, 0, time.UTC)}
+	b, err := sc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"GPSLatitude", "dc:description", "xmp:Rating", "dc:subject"} {
+		if strings.Contains(string(b), s) {
+			t.Errorf("the sidecar shouldn't contain %s:\n%s", s, b)
+		}
+	}
+}
+
+func TestSideCarLocalTimeZone(t *testing.T) {
+	sc := SideCar{DateTaken: time.Date(2023, 10, 6, 13, 30, 0, 0, time.UTC)}
+	b, err := sc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without time zone of the capture, the date is given in the local time zone of the tests
+	if !strings.Contains(string(b), "<exif:DateTimeOriginal>2023-10-06T15:30:00+02:00</exif:DateTimeOriginal>") {
+		t.Errorf("unexpected date of capture:\n%s", b)
+	}
+}
@@ -0,0 +1,65 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/*
+	WebP files are RIFF containers. The metadata are in the EXIF and XMP chunks,
+	placed after the image data.
+*/
+
+const maxWebPChunkSize = 16 * 1024 * 1024
+
+func readWebPMetaData(r io.Reader) (MetaData, error) {
+	h := make([]byte, 12)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return MetaData{}, err
+	}
+	if string(h[0:4]) != "RIFF" || string(h[8:12]) != "WEBP" {
+		return MetaData{}, errors.New("not a WebP file")
+	}
+
+	var md MetaData
+	var xmp []byte
+	for {
+		_, err = io.ReadFull(r, h[:8])
+		if err != nil {
+			break
+		}
+		typ := string(h[0:4])
+		size := int64(binary.LittleEndian.Uint32(h[4:8]))
+		size += size & 1 // chunks are padded to an even size
+		if (typ != "EXIF" && typ != "XMP ") || size > maxWebPChunkSize {
+			_, err = io.CopyN(io.Discard, r, size)
+			if err != nil {
+				break
+			}
+			continue
+		}
+		b := make([]byte, size)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			break
+		}
+		if typ == "XMP " {
+			xmp = b
+			continue
+		}
+		md, err = getExifFromReader(bytes.NewReader(b))
+		if err == nil && !md.DateTaken.IsZero() {
+			return md, nil
+		}
+	}
+	if xmp != nil {
+		if x, err := ReadXMP(bytes.NewReader(xmp)); err == nil && !x.DateTaken.IsZero() {
+			md.DateTaken, md.TimeZone = x.DateTaken, x.TimeZone
+			return md, nil
+		}
+	}
+	return md, errors.New("no date in the WebP file")
+}
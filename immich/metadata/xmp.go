@@ -0,0 +1,335 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
+)
+
+/*
+	XMP packets are RDF documents. They are found in the sidecar files written by
+	Lightroom, darktable, digiKam..., and embedded into JPEG, TIFF and RAW, HEIF, AVIF, PNG, WebP, GIF,
+	JPEG XL and QuickTime files.
+
+	The packet is read as a tree of properties. The attributes of the rdf:Description elements
+	are properties like the elements are. The values of rdf:Alt, rdf:Bag and rdf:Seq are the rdf:li elements.
+*/
+
+// FaceRegion is a face tagged in the image, as described by the Metadata Working Group
+type FaceRegion struct {
+	Name       string
+	X, Y, W, H float64 // center and size of the region, relative to the image's dimensions
+}
+
+// Namespaces and the prefixes used to name the properties
+var xmpNamespaces = map[string]string{
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#":          "rdf",
+	"http://purl.org/dc/elements/1.1/":                     "dc",
+	"http://ns.adobe.com/xap/1.0/":                         "xmp",
+	"http://ns.adobe.com/exif/1.0/":                        "exif",
+	"http://ns.adobe.com/exif/1.0/aux/":                    "aux",
+	"http://cipa.jp/exif/1.0/":                             "exifEX",
+	"http://ns.adobe.com/tiff/1.0/":                        "tiff",
+	"http://ns.adobe.com/photoshop/1.0/":                   "photoshop",
+	"http://www.metadataworkinggroup.com/schemas/regions/": "mwg-rs",
+	"http://ns.adobe.com/xmp/sType/Area#":                  "stArea",
+}
+
+type xmpNode struct {
+	name     string // prefix:local
+	text     string
+	children []*xmpNode
+}
+
+// ReadXMP decodes a XMP sidecar or packet
+func ReadXMP(r io.Reader) (MetaData, error) {
+	root, err := parseXMP(r)
+	if err != nil {
+		return MetaData{}, err
+	}
+	md := MetaData{}
+
+	for _, p := range []string{"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"} {
+		if s := root.value(p); s != "" {
+			if t, tz, err := parseDateTime(s); err == nil {
+				md.DateTaken, md.TimeZone = t, tz
+				break
+			}
+		}
+	}
+
+	lat, err1 := parseXMPCoordinate(root.value("exif:GPSLatitude"))
+	long, err2 := parseXMPCoordinate(root.value("exif:GPSLongitude"))
+	if err1 == nil && err2 == nil {
+		md.Latitude, md.Longitude = lat, long
+		if alt, err := parseXMPRational(root.value("exif:GPSAltitude")); err == nil {
+			md.Altitude = alt
+			if root.value("exif:GPSAltitudeRef") == "1" {
+				md.Altitude = -alt // below the sea level
+			}
+		}
+	}
+
+	md.Make = root.value("tiff:Make")
+	md.Model = root.value("tiff:Model")
+	md.LensModel = root.value("exifEX:LensModel")
+	if md.LensModel == "" {
+		md.LensModel = root.value("aux:Lens")
+	}
+	md.Orientation, _ = strconv.Atoi(root.value("tiff:Orientation"))
+
+	md.Title = root.value("dc:title")
+	md.Description = root.value("dc:description")
+	if r, err := strconv.ParseFloat(root.value("xmp:Rating"), 64); err == nil {
+		md.Rating = int(r)
+	}
+	if n := root.find("dc:subject"); n != nil {
+		md.Keywords = n.list()
+	}
+	md.Faces = root.faces()
+	return md, nil
+}
+
+// mergeXMP applies the values of the XMP packet embedded in the file.
+// Like the values of a sidecar, they take precedence over the other metadata of the file.
+func (md *MetaData) mergeXMP(b []byte) {
+	x, err := ReadXMP(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	if !x.DateTaken.IsZero() {
+		md.DateTaken, md.TimeZone, md.DateIsUTC = x.DateTaken, x.TimeZone, false
+	}
+	if x.Latitude != 0 || x.Longitude != 0 {
+		md.Latitude, md.Longitude, md.Altitude = x.Latitude, x.Longitude, x.Altitude
+	}
+	if x.Title != "" {
+		md.Title = x.Title
+	}
+	if x.Description != "" {
+		md.Description = x.Description
+	}
+	if x.Rating != 0 {
+		md.Rating = x.Rating
+	}
+	if len(x.Keywords) > 0 {
+		md.Keywords = x.Keywords
+	}
+	if len(x.Faces) > 0 {
+		md.Faces = x.Faces
+	}
+}
+
+// parseXMP builds the tree of the packet's properties
+func parseXMP(r io.Reader) (*xmpNode, error) {
+	d := xml.NewDecoder(r)
+	root := &xmpNode{}
+	stack := []*xmpNode{root}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) || len(root.children) > 0 && len(stack) == 1 {
+				// The packet of some files is followed by padding
+				return root, nil
+			}
+			return nil, fmt.Errorf("can't read the XMP packet: %w", err)
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmpNode{name: xmpName(t.Name)}
+			for _, a := range t.Attr {
+				if a.Name.Space == "" || a.Name.Space == "xmlns" || xmpNamespaces[a.Name.Space] == "rdf" {
+					continue
+				}
+				n.children = append(n.children, &xmpNode{name: xmpName(a.Name), text: a.Value})
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			top.text += string(t)
+		}
+	}
+}
+
+func xmpName(n xml.Name) string {
+	if p, ok := xmpNamespaces[n.Space]; ok {
+		return p + ":" + n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// find the first property with the name in the tree
+func (n *xmpNode) find(name string) *xmpNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+		if f := c.find(name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// value gives the property's value, the first item of lists and alternatives
+func (n *xmpNode) value(name string) string {
+	p := n.find(name)
+	if p == nil {
+		return ""
+	}
+	if l := p.list(); len(l) > 0 {
+		return l[0]
+	}
+	return strings.TrimSpace(p.text)
+}
+
+// list gives the values of the rdf:li elements
+func (n *xmpNode) list() []string {
+	l := []string{}
+	for _, c := range n.children {
+		if c.name == "rdf:li" {
+			if s := strings.TrimSpace(c.text); s != "" {
+				l = append(l, s)
+			}
+			continue
+		}
+		l = append(l, c.list()...)
+	}
+	return l
+}
+
+// items gives the rdf:li elements
+func (n *xmpNode) items() []*xmpNode {
+	l := []*xmpNode{}
+	for _, c := range n.children {
+		if c.name == "rdf:li" {
+			l = append(l, c)
+			continue
+		}
+		l = append(l, c.items()...)
+	}
+	return l
+}
+
+// faces gives the regions of type Face
+func (n *xmpNode) faces() []FaceRegion {
+	regions := n.find("mwg-rs:RegionList")
+	if regions == nil {
+		return nil
+	}
+	faces := []FaceRegion{}
+	for _, r := range regions.items() {
+		if t := r.value("mwg-rs:Type"); t != "" && t != "Face" {
+			continue
+		}
+		f := FaceRegion{Name: r.value("mwg-rs:Name")}
+		f.X, _ = strconv.ParseFloat(r.value("stArea:x"), 64)
+		f.Y, _ = strconv.ParseFloat(r.value("stArea:y"), 64)
+		f.W, _ = strconv.ParseFloat(r.value("stArea:w"), 64)
+		f.H, _ = strconv.ParseFloat(r.value("stArea:h"), 64)
+		faces = append(faces, f)
+	}
+	return faces
+}
+
+// parseXMPCoordinate reads the GPS coordinates: "48,51.462N", "48,51,27.72N" or a decimal value
+func parseXMPCoordinate(s string) (float64, error) {
+	if s == "" {
+		return 0, errors.New("no coordinate")
+	}
+	sign := 1.0
+	switch s[len(s)-1] {
+	case 'S', 's', 'W', 'w':
+		sign = -1
+		s = s[:len(s)-1]
+	case 'N', 'n', 'E', 'e':
+		s = s[:len(s)-1]
+	}
+	v := 0.0
+	for i, p := range strings.Split(s, ",") {
+		if i > 2 {
+			return 0, fmt.Errorf("invalid coordinate: %q", s)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid coordinate: %q", s)
+		}
+		switch i {
+		case 0:
+			v = f
+		case 1:
+			v += f / 60
+		case 2:
+			v += f / 3600
+		}
+	}
+	return sign * v, nil
+}
+
+// parseXMPRational reads values like "3500/100" or decimal values
+func parseXMPRational(s string) (float64, error) {
+	n, d, ok := strings.Cut(s, "/")
+	if !ok {
+		return strconv.ParseFloat(s, 64)
+	}
+	fn, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0, err
+	}
+	fd, err := strconv.ParseFloat(d, 64)
+	if err != nil || fd == 0 {
+		return 0, fmt.Errorf("invalid rational: %q", s)
+	}
+	return fn / fd, nil
+}
+
+var (
+	// Layouts giving the time zone
+	zonedLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04Z07:00",
+		"2006:01:02 15:04:05Z07:00",
+		time.RFC1123Z,
+		time.RFC1123,
+	}
+	// Layouts in the local time
+	localLayouts = []string{
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		"2006:01:02 15:04:05",
+		"2006-01-02",
+	}
+)
+
+// parseDateTime reads the dates written by the various tools.
+// The time zone is given when the date has one.
+func parseDateTime(s string) (time.Time, *time.Location, error) {
+	for _, l := range zonedLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, t.Location(), nil
+		}
+	}
+	local, err := tzone.Local()
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	for _, l := range localLayouts {
+		if t, err := time.ParseInLocation(l, s, local); err == nil {
+			return t, nil, nil
+		}
+	}
+	return time.Time{}, nil, fmt.Errorf("invalid date: %q", s)
+}
@@ -0,0 +1,194 @@
+package metadata
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const lightroomSidecar = `<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Adobe XMP Core 7.0">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:exifEX="http://cipa.jp/exif/1.0/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:mwg-rs="http://www.metadataworkinggroup.com/schemas/regions/"
+    xmlns:stArea="http://ns.adobe.com/xmp/sType/Area#"
+    tiff:Make="Canon"
+    tiff:Model="Canon EOS R6"
+    tiff:Orientation="8"
+    exifEX:LensModel="RF24-105mm F4 L IS USM"
+    xmp:Rating="5">
+   <exif:DateTimeOriginal>2023-06-23T13:32:52.05</exif:DateTimeOriginal>
+   <exif:GPSLatitude>33,52,7.68S</exif:GPSLatitude>
+   <exif:GPSLongitude>151,12,33.48E</exif:GPSLongitude>
+   <exif:GPSAltitude>1250/100</exif:GPSAltitude>
+   <exif:GPSAltitudeRef>1</exif:GPSAltitudeRef>
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Opera house</rdf:li></rdf:Alt></dc:title>
+   <dc:subject><rdf:Bag><rdf:li>Sydney</rdf:li><rdf:li>Harbour</rdf:li></rdf:Bag></dc:subject>
+   <mwg-rs:Regions rdf:parseType="Resource">
+    <mwg-rs:RegionList>
+     <rdf:Bag>
+      <rdf:li>
+       <rdf:Description mwg-rs:Name="Alice" mwg-rs:Type="Face">
+        <mwg-rs:Area stArea:x="0.25" stArea:y="0.4" stArea:w="0.1" stArea:h="0.2" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+      <rdf:li>
+       <rdf:Description mwg-rs:Name="Bob" mwg-rs:Type="Face">
+        <mwg-rs:Area stArea:x="0.75" stArea:y="0.5" stArea:w="0.12" stArea:h="0.22" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+      <rdf:li>
+       <rdf:Description mwg-rs:Name="Focus" mwg-rs:Type="Focus">
+        <mwg-rs:Area stArea:x="0.5" stArea:y="0.5" stArea:w="0.1" stArea:h="0.1" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+     </rdf:Bag>
+    </mwg-rs:RegionList>
+   </mwg-rs:Regions>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestReadXMP(t *testing.T) {
+	md, err := ReadXMP(strings.NewReader(lightroomSidecar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := md.DateTaken.Format("2006-01-02 15:04:05.00"); got != "2023-06-23 13:32:52.05" || md.TimeZone != nil {
+		t.Errorf("unexpected date: %s, %v", got, md.TimeZone)
+	}
+	if math.Abs(md.Latitude+33.8688) > 1e-6 || math.Abs(md.Longitude-151.2093) > 1e-6 || md.Altitude != -12.5 {
+		t.Errorf("unexpected location: %f %f %f", md.Latitude, md.Longitude, md.Altitude)
+	}
+	if md.Make != "Canon" || md.Model != "Canon EOS R6" || md.LensModel != "RF24-105mm F4 L IS USM" || md.Orientation != 8 {
+		t.Errorf("unexpected camera: %q %q %q %d", md.Make, md.Model, md.LensModel, md.Orientation)
+	}
+	if md.Title != "Opera house" || md.Description != "" || md.Rating != 5 {
+		t.Errorf("unexpected title, description or rating: %q %q %d", md.Title, md.Description, md.Rating)
+	}
+	if !reflect.DeepEqual(md.Keywords, []string{"Sydney", "Harbour"}) {
+		t.Errorf("unexpected keywords: %v", md.Keywords)
+	}
+	faces := []FaceRegion{
+		{Name: "Alice", X: 0.25, Y: 0.4, W: 0.1, H: 0.2},
+		{Name: "Bob", X: 0.75, Y: 0.5, W: 0.12, H: 0.22},
+	}
+	if !reflect.DeepEqual(md.Faces, faces) {
+		t.Errorf("unexpected faces: %v", md.Faces)
+	}
+}
+
+func TestParseXMPCoordinate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    float64
+		wantErr bool
+	}{
+		{s: "48,51.462N", want: 48.8577},
+		{s: "2,17,42W", want: -2.295},
+		{s: "-33.8688", want: -33.8688},
+		{s: "", wantErr: true},
+		{s: "north", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseXMPCoordinate(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseXMPCoordinate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("parseXMPCoordinate() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+const embeddedXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"
+ xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:DateTimeOriginal="2023-10-07T10:00:00+02:00" xmp:Rating="4">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">The title</rdf:li></rdf:Alt></dc:title>
+<dc:description><rdf:Alt><rdf:li xml:lang="x-default">The description</rdf:li></rdf:Alt></dc:description>
+<dc:subject><rdf:Bag><rdf:li>Holidays</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+// corpusHEIF places the Exif and the XMP items in the media data, located by the meta box
+func corpusHEIF(xmp []byte) []byte {
+	exifItem := append(u32(6), append([]byte("Exif\x00\x00"), corpusTIFF()...)...)
+	image := GenRandomBytes(700)
+	ftyp := atom("ftyp", []byte("heic"), u32(0), []byte("mif1heic"))
+	infe := func(id uint16, typ string, extra string) []byte {
+		return atom("infe", u32(2<<24), []byte{byte(id >> 8), byte(id), 0, 0}, []byte(typ), []byte("\x00"+extra))
+	}
+	item := func(id uint16, offset, length int) []byte {
+		return append([]byte{0, byte(id), 0, 0, 0, 1}, u32(uint32(offset), uint32(length))...)
+	}
+	meta := func(start int) []byte {
+		iinf := atom("iinf", u32(0), []byte{0, 3}, infe(1, "hvc1", ""), infe(2, "Exif", ""), infe(3, "mime", "application/rdf+xml\x00"))
+		iloc := atom("iloc", u32(0), []byte{0x44, 0x00, 0, 3},
+			item(1, start+len(xmp)+len(exifItem), len(image)),
+			item(2, start+len(xmp), len(exifItem)),
+			item(3, start, len(xmp)),
+		)
+		return atom("meta", u32(0), atom("hdlr", make([]byte, 25)), iinf, iloc)
+	}
+	start := len(ftyp) + len(meta(0)) + 8
+	return bytes.Join([][]byte{ftyp, meta(start), atom("mdat", xmp, exifItem, image)}, nil)
+}
+
+func TestEmbeddedXMP(t *testing.T) {
+	xmp := []byte(embeddedXMP)
+	mvhd := atom("mvhd", u32(0, uint32(corpusDate.Unix()+2082844800), uint32(corpusDate.Unix()+2082844800), 1000, 5000))
+
+	tests := []struct {
+		name string
+		ext  string
+		data []byte
+	}{
+		{name: "jpeg", ext: ".jpg", data: corpusJPEGWith(jpegSegment(jpegAPP1, append(append([]byte{}, jpegXMPHeader...), xmp...)))},
+		{name: "dng", ext: ".dng", data: tiffBytes(
+			[]ifdEntry{asciiTag(0x010f, "Maker"), {tag: exifXMLPacketTag, typ: 1, count: uint32(len(xmp)), data: xmp}},
+			[]ifdEntry{asciiTag(0x9003, "2023:10:06 08:30:00"), asciiTag(0x9011, "+02:00")},
+			nil,
+		)},
+		{name: "heic", ext: ".heic", data: corpusHEIF(xmp)},
+		{name: "jxl", ext: ".jxl", data: bytes.Join([][]byte{
+			atom("ftyp", []byte("jxl "), u32(0), []byte("jxl ")),
+			atom("Exif", u32(0), corpusTIFF()),
+			atom("xml ", xmp),
+			atom("jxlc", []byte{0xff, 0x0a}, GenRandomBytes(300)),
+		}, nil)},
+		{name: "mp4", ext: ".mp4", data: bytes.Join([][]byte{
+			atom("ftyp", []byte("isom"), u32(0), []byte("isom")),
+			atom("moov", mvhd),
+			atom("uuid", xmpUUID, xmp),
+			atom("mdat", GenRandomBytes(1000)),
+		}, nil)},
+		{name: "mov", ext: ".mov", data: bytes.Join([][]byte{
+			atom("ftyp", []byte("qt  "), u32(0), []byte("qt  ")),
+			atom("mdat", GenRandomBytes(1000)),
+			atom("moov", mvhd, atom("udta", atom("XMP_", xmp))),
+		}, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := GetFromReader(bytes.NewReader(tt.data), tt.ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The XMP packet takes precedence, like a sidecar
+			if want := time.Date(2023, 10, 7, 8, 0, 0, 0, time.UTC); !md.DateTaken.Equal(want) || md.DateIsUTC {
+				t.Errorf("DateTaken = %s, want %s", md.DateTaken, want)
+			}
+			if md.Title != "The title" || md.Description != "The description" || md.Rating != 4 || !reflect.DeepEqual(md.Keywords, []string{"Holidays"}) {
+				t.Errorf("unexpected values: %q %q %d %q", md.Title, md.Description, md.Rating, md.Keywords)
+			}
+		})
+	}
+}
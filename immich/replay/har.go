@@ -0,0 +1,139 @@
+// Package replay records the exchanges with the immich server, and serves them back.
+//
+// The Recorder is an http.RoundTripper that writes the requests and the responses into a HAR-like file.
+// The API key is redacted, and the files sent or received are replaced by their SHA-1 and their size.
+//
+// The Replayer is an http.RoundTripper that answers the requests with the recorded responses,
+// so a session reported by a user can be turned into a regression test.
+package replay
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// File is the content of a recording, following the structure of the HAR files
+type File struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string   `json:"version"`
+	Creator Creator  `json:"creator"`
+	Entries []*Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is an exchange with the server
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"` // duration of the exchange in milliseconds
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Error           string    `json:"_error,omitempty"` // error of the transport, when the server hasn't answered
+}
+
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Request struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	HTTPVersion string    `json:"httpVersion"`
+	Headers     []Header  `json:"headers"`
+	PostData    *PostData `json:"postData,omitempty"`
+}
+
+type PostData struct {
+	MimeType string  `json:"mimeType"`
+	Text     string  `json:"text,omitempty"`
+	Params   []Param `json:"params,omitempty"` // parts of multipart forms
+}
+
+// Param is a part of a multipart form. The value of a file part is its SHA-1 and its size.
+type Param struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type Response struct {
+	Status      int      `json:"status"`
+	StatusText  string   `json:"statusText"`
+	HTTPVersion string   `json:"httpVersion"`
+	Headers     []Header `json:"headers"`
+	Content     Content  `json:"content"`
+}
+
+// Content is the body of the response. Binary bodies are replaced by their SHA-1 given in the comment.
+type Content struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// redacted headers
+var secretHeaders = map[string]bool{
+	"X-Api-Key":     true,
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+const redacted = "REDACTED"
+
+func headers(h http.Header) []Header {
+	l := []Header{}
+	for name, values := range h {
+		for _, v := range values {
+			if secretHeaders[http.CanonicalHeaderKey(name)] {
+				v = redacted
+			}
+			l = append(l, Header{Name: name, Value: v})
+		}
+	}
+	return l
+}
+
+// Read reads a recording
+func Read(r io.Reader) (*File, error) {
+	f := File{}
+	err := json.NewDecoder(r).Decode(&f)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ReadFile reads a recording from a file
+func ReadFile(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// isText tells if the body of the given content type can be recorded as text
+func isText(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	ct = strings.TrimSpace(strings.ToLower(ct))
+	switch {
+	case ct == "", strings.HasPrefix(ct, "text/"), strings.HasSuffix(ct, "json"), strings.HasSuffix(ct, "xml"):
+		return true
+	}
+	return false
+}
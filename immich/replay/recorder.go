@@ -0,0 +1,269 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recorder is an http.RoundTripper that records the exchanges done through the next one
+type Recorder struct {
+	next    http.RoundTripper
+	creator Creator
+
+	lock    sync.Mutex
+	entries []*Entry
+	pending sync.WaitGroup // multipart bodies being summarized
+}
+
+// NewRecorder gives a recorder using the next transport, the default one when nil
+func NewRecorder(next http.RoundTripper, version string) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{
+		next:    next,
+		creator: Creator{Name: "immich-go", Version: version},
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := &Entry{
+		StartedDateTime: time.Now(),
+		Request: Request{
+			Method:      req.Method,
+			URL:         redactURL(req.URL),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     headers(req.Header),
+		},
+	}
+	r.lock.Lock()
+	r.entries = append(r.entries, e)
+	r.lock.Unlock()
+
+	out, err := r.recordRequest(req, e)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.RoundTrip(out)
+	elapsed := float64(time.Since(e.StartedDateTime).Microseconds()) / 1000
+	if err != nil {
+		r.lock.Lock()
+		e.Time, e.Error = elapsed, err.Error()
+		r.lock.Unlock()
+		return nil, err
+	}
+
+	rr := Response{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     headers(resp.Header),
+		Content:     Content{Size: resp.ContentLength, MimeType: resp.Header.Get("Content-Type")},
+	}
+	switch {
+	case resp.Body == nil || resp.Body == http.NoBody:
+	case isText(rr.Content.MimeType):
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			r.lock.Lock()
+			e.Time, e.Error = elapsed, err.Error()
+			r.lock.Unlock()
+			return nil, err
+		}
+		rr.Content.Size = int64(len(b))
+		rr.Content.Text = string(b)
+		resp.Body = io.NopCloser(bytes.NewReader(b))
+	default:
+		// Binary bodies, like downloaded files, are hashed while the caller reads them
+		resp.Body = &hashingBody{
+			ReadCloser: resp.Body,
+			h:          sha1.New(),
+			done: func(sum string, size int64) {
+				r.lock.Lock()
+				defer r.lock.Unlock()
+				e.Response.Content.Size = size
+				e.Response.Content.Comment = sum
+			},
+		}
+	}
+
+	r.lock.Lock()
+	e.Time, e.Response = elapsed, rr
+	r.lock.Unlock()
+	return resp, nil
+}
+
+// recordRequest records the body of the request, and gives the request to send
+func (r *Recorder) recordRequest(req *http.Request, e *Entry) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	out := req.Clone(req.Context())
+	ct := req.Header.Get("Content-Type")
+	pd := &PostData{MimeType: ct}
+	e.Request.PostData = pd
+
+	mt, params, _ := mime.ParseMediaType(ct)
+	if mt == "multipart/form-data" && params["boundary"] != "" {
+		// The parts are summarized while the transport sends them
+		pr, pw := io.Pipe()
+		out.Body = &teeBody{Reader: io.TeeReader(req.Body, pw), body: req.Body, pw: pw}
+		r.pending.Add(1)
+		go func() {
+			defer r.pending.Done()
+			parts := summarizeMultipart(pr, params["boundary"])
+			_, _ = io.Copy(io.Discard, pr)
+			r.lock.Lock()
+			pd.Params = parts
+			r.lock.Unlock()
+		}()
+		return out, nil
+	}
+
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if isText(ct) {
+		pd.Text = string(b)
+	} else {
+		pd.Text = fileSummary(sha1.Sum(b), int64(len(b)))
+	}
+	out.Body = io.NopCloser(bytes.NewReader(b))
+	return out, nil
+}
+
+// summarizeMultipart reads the parts of a multipart body, the files are replaced by their SHA-1 and size
+func summarizeMultipart(r io.Reader, boundary string) []Param {
+	params := []Param{}
+	mr := multipart.NewReader(r, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return params
+		}
+		p := Param{Name: part.FormName()}
+		if part.FileName() != "" {
+			p.FileName = part.FileName()
+			p.ContentType = part.Header.Get("Content-Type")
+			h := sha1.New()
+			n, _ := io.Copy(h, part)
+			var sum [sha1.Size]byte
+			copy(sum[:], h.Sum(nil))
+			p.Value = fileSummary(sum, n)
+		} else {
+			b, _ := io.ReadAll(io.LimitReader(part, 64*1024))
+			p.Value = string(b)
+		}
+		params = append(params, p)
+	}
+}
+
+func fileSummary(sum [sha1.Size]byte, size int64) string {
+	return fmt.Sprintf("sha1:%s size:%d", base64.StdEncoding.EncodeToString(sum[:]), size)
+}
+
+// redactURL removes the key from the query
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	if q.Has("key") {
+		q.Set("key", redacted)
+		c := *u
+		c.RawQuery = q.Encode()
+		return c.String()
+	}
+	return u.String()
+}
+
+// Entries gives the exchanges recorded so far
+func (r *Recorder) Entries() []*Entry {
+	r.pending.Wait()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	l := make([]*Entry, len(r.entries))
+	copy(l, r.entries)
+	return l
+}
+
+// Write writes the recording
+func (r *Recorder) Write(w io.Writer) error {
+	f := File{Log: Log{Version: "1.2", Creator: r.creator, Entries: r.Entries()}}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(f)
+}
+
+// Save writes the recording into the file
+func (r *Recorder) Save(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = r.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// teeBody copies the request body into the pipe of the multipart summarizer
+type teeBody struct {
+	io.Reader
+	body io.Closer
+	pw   *io.PipeWriter
+}
+
+func (t *teeBody) Close() error {
+	err := t.body.Close()
+	t.pw.Close()
+	return err
+}
+
+// hashingBody computes the SHA-1 of the body while it is read
+type hashingBody struct {
+	io.ReadCloser
+	h    hash.Hash
+	size int64
+	once sync.Once
+	done func(sum string, size int64)
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.h.Write(p[:n])
+	b.size += int64(n)
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *hashingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *hashingBody) finish() {
+	b.once.Do(func() {
+		var sum [sha1.Size]byte
+		copy(sum[:], b.h.Sum(nil))
+		b.done(fileSummary(sum, b.size), b.size)
+	})
+}
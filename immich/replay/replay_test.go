@@ -0,0 +1,119 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/replay"
+	"github.com/simulot/immich-go/internal/fakeimmich"
+)
+
+// session runs some API calls, and gives a summary of the results
+func session(t *testing.T, ic *immich.ImmichClient) string {
+	ctx := context.Background()
+	b := strings.Builder{}
+	if _, err := ic.ValidateConnection(ctx); err != nil {
+		t.Fatal(err)
+	}
+	la := &browser.LocalAssetFile{
+		FileName:  "PHOTO.jpg",
+		Title:     "PHOTO.jpg",
+		FileSize:  5,
+		DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC),
+		FSys:      fstest.MapFS{"PHOTO.jpg": &fstest.MapFile{Data: []byte("photo")}},
+	}
+	r, err := ic.AssetUpload(ctx, la)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteString(r.ID + "\n")
+	for _, p := range []string{"first", "second"} {
+		_, err = ic.CreateAlbum(ctx, p, []string{r.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assets, err := ic.GetAllAssets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range assets {
+		b.WriteString(a.OriginalFileName + " " + a.Checksum + "\n")
+	}
+	rc, err := ic.DownloadAsset(ctx, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, rc)
+	rc.Close()
+	if _, err = ic.GetAlbumInfo(ctx, "unknown"); err == nil {
+		t.Fatal("GetAlbumInfo() should fail")
+	}
+	return b.String()
+}
+
+func TestRecordReplay(t *testing.T) {
+	s := fakeimmich.New()
+	defer s.Close()
+	s.PageSize = 1
+
+	ic, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := replay.NewRecorder(ic.Transport(), "test")
+	ic.SetTransport(rec)
+	recorded := session(t, ic)
+
+	buf := bytes.NewBuffer(nil)
+	if err = rec.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	trace := buf.String()
+	if strings.Contains(trace, s.Key) {
+		t.Errorf("the API key isn't redacted")
+	}
+	if strings.Contains(trace, "photo\\r\\n") || !strings.Contains(trace, `"fileName": "PHOTO.jpg"`) {
+		t.Errorf("the uploaded file isn't replaced by its hash")
+	}
+
+	f, err := replay.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range f.Log.Entries {
+		if e.Request.Method == http.MethodPost && strings.HasSuffix(e.Request.URL, "/download/asset/"+strings.TrimSpace(strings.Split(recorded, "\n")[0])) {
+			if !strings.HasPrefix(e.Response.Content.Comment, "sha1:") || e.Response.Content.Size != 5 {
+				t.Errorf("unexpected content of the download: %+v", e.Response.Content)
+			}
+		}
+	}
+
+	// Replay the session without the server
+	s.Close()
+	rp := replay.NewReplayer(f)
+	ic, err = immich.NewImmichClient("http://replay.invalid", "another key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.SetTransport(rp)
+	replayed := session(t, ic)
+	if replayed != recorded {
+		t.Errorf("replayed session:\n%s\nrecorded session:\n%s", replayed, recorded)
+	}
+	if l := rp.Unused(); len(l) != 0 {
+		t.Errorf("%d exchanges not replayed", len(l))
+	}
+
+	if _, err = ic.GetAllAlbums(context.Background()); err == nil {
+		t.Errorf("a call not recorded should fail")
+	}
+}
@@ -0,0 +1,129 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Replayer is an http.RoundTripper that answers with the recorded responses.
+//
+// A request gets the response of the first exchange not yet replayed with the same method and path.
+// Among them, the exchange with the same JSON body is preferred, so the pages of a search are served in order.
+type Replayer struct {
+	lock    sync.Mutex
+	entries []*Entry
+	used    []bool
+}
+
+// NewReplayer gives a replayer of the exchanges of the recording
+func NewReplayer(f *File) *Replayer {
+	return &Replayer{
+		entries: f.Log.Entries,
+		used:    make([]bool, len(f.Log.Entries)),
+	}
+}
+
+// LoadReplayer reads a recording from a file, and gives its replayer
+func LoadReplayer(name string) (*Replayer, error) {
+	f, err := ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(f), nil
+}
+
+func (p *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		// Consume the body, like a server does
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	first := -1
+	for i, e := range p.entries {
+		if p.used[i] || e.Request.Method != req.Method || !samePath(e.Request.URL, req.URL) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if e.Request.PostData == nil || e.Request.PostData.Text == "" || sameJSON(e.Request.PostData.Text, body) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nil, fmt.Errorf("replay: no recorded exchange for %s %s", req.Method, req.URL.Path)
+	}
+	p.used[first] = true
+	e := p.entries[first]
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+
+	h := http.Header{}
+	for _, hd := range e.Response.Headers {
+		h.Add(hd.Name, hd.Value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Response.Status, e.Response.StatusText),
+		StatusCode:    e.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(strings.NewReader(e.Response.Content.Text)),
+		ContentLength: int64(len(e.Response.Content.Text)),
+		Request:       req,
+	}, nil
+}
+
+// Unused gives the recorded exchanges that haven't been replayed
+func (p *Replayer) Unused() []*Entry {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	l := []*Entry{}
+	for i, e := range p.entries {
+		if !p.used[i] {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// samePath compares the path and the query of the recorded URL with the request's one, whatever the server
+func samePath(recorded string, u *url.URL) bool {
+	r, err := url.Parse(recorded)
+	if err != nil {
+		return false
+	}
+	if r.Path != u.Path {
+		return false
+	}
+	rq, uq := r.Query(), u.Query()
+	if rq.Has("key") {
+		rq.Del("key")
+		uq.Del("key")
+	}
+	return rq.Encode() == uq.Encode()
+}
+
+// sameJSON compares JSON bodies, whatever their formatting
+func sameJSON(recorded string, body []byte) bool {
+	var a, b any
+	if json.Unmarshal([]byte(recorded), &a) != nil || json.Unmarshal(body, &b) != nil {
+		return recorded == string(body)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,72 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tag is a tag of the server. Tags are hierarchical: the value is the path of the tag, like "Places/France/Paris",
+// the name is its last level.
+type Tag struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	ParentID string `json:"parentId,omitempty"`
+	Color    string `json:"color,omitempty"`
+}
+
+func (ic *ImmichClient) GetAllTags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	err := ic.newServerCall(ctx, "GetAllTags").do(get("/tags", setAcceptJSON()), responseJSON(&tags))
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// CreateTag creates a tag under the parent tag, or at the root when parentID is empty
+func (ic *ImmichClient) CreateTag(ctx context.Context, name string, parentID string) (Tag, error) {
+	body := struct {
+		Name     string `json:"name"`
+		ParentID string `json:"parentId,omitempty"`
+	}{Name: name, ParentID: parentID}
+	var r Tag
+	err := ic.newServerCall(ctx, "CreateTag").do(
+		post("/tags", "application/json", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return Tag{}, err
+	}
+	return r, nil
+}
+
+// UpsertTags gives the tags of the paths, like "Places/France/Paris".
+// The missing tags are created with their parents.
+func (ic *ImmichClient) UpsertTags(ctx context.Context, values []string) ([]Tag, error) {
+	body := struct {
+		Tags []string `json:"tags"`
+	}{Tags: values}
+	var r []Tag
+	err := ic.newServerCall(ctx, "UpsertTags").do(
+		put("/tags", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TagAssets gives the tag to the assets. The assets already tagged are reported with the error "duplicate".
+func (ic *ImmichClient) TagAssets(ctx context.Context, tagID string, assets []string) ([]UpdateAlbumResult, error) {
+	var r []UpdateAlbumResult
+	body := UpdateAlbum{
+		IDS: assets,
+	}
+	err := ic.newServerCall(ctx, "TagAssets").do(
+		put(fmt.Sprintf("/tags/%s/assets", tagID), setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
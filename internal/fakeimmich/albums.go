@@ -0,0 +1,156 @@
+package fakeimmich
+
+import (
+	"net/http"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// Album is an album of the server
+type Album struct {
+	ID       string
+	Name     string
+	AssetIDs []string
+}
+
+func (al *Album) has(id string) bool {
+	for _, aid := range al.AssetIDs {
+		if aid == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (al *Album) remove(id string) {
+	for i, aid := range al.AssetIDs {
+		if aid == id {
+			al.AssetIDs = append(al.AssetIDs[:i], al.AssetIDs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (al *Album) wire() map[string]any {
+	return map[string]any{
+		"id":         al.ID,
+		"albumName":  al.Name,
+		"assetCount": len(al.AssetIDs),
+	}
+}
+
+// AddAlbum creates an album with the given assets, and gives its ID
+func (s *Server) AddAlbum(name string, assetIDs ...string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addAlbum(name, assetIDs)
+}
+
+func (s *Server) addAlbum(name string, assetIDs []string) string {
+	al := &Album{ID: s.newID(), Name: name}
+	for _, id := range assetIDs {
+		if _, ok := s.assets[id]; ok && !al.has(id) {
+			al.AssetIDs = append(al.AssetIDs, id)
+		}
+	}
+	s.albums[al.ID] = al
+	s.albumOrder = append(s.albumOrder, al.ID)
+	return al.ID
+}
+
+// Albums gives a copy of the albums of the server, in the order of their creation
+func (s *Server) Albums() []Album {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	l := make([]Album, 0, len(s.albumOrder))
+	for _, id := range s.albumOrder {
+		al := *s.albums[id]
+		al.AssetIDs = append([]string(nil), al.AssetIDs...)
+		l = append(l, al)
+	}
+	return l
+}
+
+// getAlbums lists the albums, or the albums of the asset given by the assetId parameter
+func (s *Server) getAlbums(w http.ResponseWriter, r *http.Request) {
+	assetID := r.URL.Query().Get("assetId")
+	l := []map[string]any{}
+	for _, id := range s.albumOrder {
+		al := s.albums[id]
+		if assetID != "" && !al.has(assetID) {
+			continue
+		}
+		l = append(l, al.wire())
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (s *Server) createAlbum(w http.ResponseWriter, r *http.Request) {
+	var req immich.AlbumSimplified
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.AlbumName == "" {
+		writeError(w, http.StatusBadRequest, "albumName should not be empty")
+		return
+	}
+	id := s.addAlbum(req.AlbumName, req.AssetIds)
+	writeJSON(w, http.StatusCreated, s.albums[id].wire())
+}
+
+func (s *Server) getAlbum(w http.ResponseWriter, id string) {
+	al, ok := s.albums[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Not found or no album.read access")
+		return
+	}
+	content := al.wire()
+	assets := []map[string]any{}
+	for _, aid := range al.AssetIDs {
+		assets = append(assets, s.assets[aid].wire())
+	}
+	content["assets"] = assets
+	writeJSON(w, http.StatusOK, content)
+}
+
+func (s *Server) deleteAlbum(w http.ResponseWriter, id string) {
+	if _, ok := s.albums[id]; !ok {
+		writeError(w, http.StatusBadRequest, "Not found or no album.delete access")
+		return
+	}
+	delete(s.albums, id)
+	for i, aid := range s.albumOrder {
+		if aid == id {
+			s.albumOrder = append(s.albumOrder[:i], s.albumOrder[i+1:]...)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addAssetsToAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	al, ok := s.albums[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Not found or no album.addAsset access")
+		return
+	}
+	var req immich.UpdateAlbum
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	results := []immich.UpdateAlbumResult{}
+	for _, aid := range req.IDS {
+		res := immich.UpdateAlbumResult{ID: aid}
+		switch {
+		case s.assets[aid] == nil:
+			res.Error = "not_found"
+		case al.has(aid):
+			res.Error = "duplicate"
+		default:
+			al.AssetIDs = append(al.AssetIDs, aid)
+			res.Success = true
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,504 @@
+package fakeimmich
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// Asset is an asset stored by the server
+type Asset struct {
+	ID               string
+	DeviceAssetID    string
+	DeviceID         string
+	Type             string // IMAGE or VIDEO
+	OriginalFileName string // Name of the uploaded file, without extension
+	OriginalPath     string // Path of the file on the server
+	Checksum         string // SHA-1 of the content, base64 encoded
+	FileCreatedAt    time.Time
+	FileModifiedAt   time.Time
+	UpdatedAt        time.Time // Date of the last change, set by the server
+	DateTimeOriginal time.Time // Date of capture, its location gives the wall clock time when TimeZone is empty
+	TimeZone         string    // Time zone of the capture, like Europe/Paris or UTC+2
+	Make             string
+	Model            string
+	Latitude         float64
+	Longitude        float64
+	Description      string
+	IsFavorite       bool
+	IsArchived       bool
+	IsTrashed        bool
+	StackParentID    string
+	LivePhotoVideoID string
+	Sidecar          []byte // Content of the XMP sidecar uploaded with the asset
+	Content          []byte // Content of the asset
+	Size             int    // Size of the file, the size of the content when 0
+}
+
+func (a *Asset) size() int {
+	if a.Size > 0 {
+		return a.Size
+	}
+	return len(a.Content)
+}
+
+const immichTimeFormat = "2006-01-02T15:04:05.000Z"
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(immichTimeFormat)
+}
+
+// wire gives the asset as sent by the server
+func (a *Asset) wire() map[string]any {
+	local := a.DateTimeOriginal
+	if loc := (immich.ExifInfo{TimeZone: a.TimeZone}).Location(); loc != nil {
+		local = local.In(loc)
+	}
+	localDateTime := ""
+	if !local.IsZero() {
+		localDateTime = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC).Format(immichTimeFormat)
+	}
+	exif := map[string]any{
+		"make":             a.Make,
+		"model":            a.Model,
+		"fileSizeInByte":   a.size(),
+		"dateTimeOriginal": formatTime(a.DateTimeOriginal),
+		"timeZone":         a.TimeZone,
+		"description":      a.Description,
+	}
+	if a.Latitude != 0 || a.Longitude != 0 {
+		exif["latitude"] = a.Latitude
+		exif["longitude"] = a.Longitude
+	}
+	return map[string]any{
+		"id":               a.ID,
+		"deviceAssetId":    a.DeviceAssetID,
+		"deviceId":         a.DeviceID,
+		"type":             a.Type,
+		"originalPath":     a.OriginalPath,
+		"originalFileName": a.OriginalFileName,
+		"fileCreatedAt":    formatTime(a.FileCreatedAt),
+		"fileModifiedAt":   formatTime(a.FileModifiedAt),
+		"updatedAt":        formatTime(a.UpdatedAt),
+		"localDateTime":    localDateTime,
+		"isFavorite":       a.IsFavorite,
+		"isArchived":       a.IsArchived,
+		"isTrashed":        a.IsTrashed,
+		"checksum":         a.Checksum,
+		"stackParentId":    a.StackParentID,
+		"livePhotoVideoId": a.LivePhotoVideoID,
+		"exifInfo":         exif,
+	}
+}
+
+// AddAsset stores an asset in the server, and gives its ID.
+// The ID and the checksum are computed when missing.
+func (s *Server) AddAsset(a Asset) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addAsset(&a)
+}
+
+func (s *Server) addAsset(a *Asset) string {
+	if a.ID == "" {
+		a.ID = s.newID()
+	}
+	if a.Checksum == "" {
+		h := sha1.Sum(a.Content)
+		a.Checksum = base64.StdEncoding.EncodeToString(h[:])
+	}
+	if a.Type == "" {
+		a.Type = "IMAGE"
+	}
+	if a.UpdatedAt.IsZero() {
+		a.UpdatedAt = time.Now()
+	}
+	if a.OriginalPath == "" {
+		a.OriginalPath = "upload/library/admin/" + a.ID + ".jpg"
+	}
+	if _, exists := s.assets[a.ID]; !exists {
+		s.assetOrder = append(s.assetOrder, a.ID)
+	}
+	s.assets[a.ID] = a
+	return a.ID
+}
+
+// Assets gives a copy of the assets of the server, in the order of their creation
+func (s *Server) Assets() []Asset {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	l := make([]Asset, 0, len(s.assetOrder))
+	for _, id := range s.assetOrder {
+		l = append(l, *s.assets[id])
+	}
+	return l
+}
+
+// Asset gives a copy of the asset with the given ID
+func (s *Server) Asset(id string) (Asset, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	a, ok := s.assets[id]
+	if !ok {
+		return Asset{}, false
+	}
+	return *a, true
+}
+
+func (s *Server) byChecksum(checksum string) *Asset {
+	for _, id := range s.assetOrder {
+		if a := s.assets[id]; a.Checksum == checksum {
+			return a
+		}
+	}
+	return nil
+}
+
+// searchMetadata answers with a page of the assets matching the criteria
+func (s *Server) searchMetadata(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Page             int    `json:"page"`
+		Size             int    `json:"size"`
+		ID               string `json:"id"`
+		Checksum         string `json:"checksum"`
+		OriginalFileName string `json:"originalFileName"`
+		DeviceAssetID    string `json:"deviceAssetId"`
+		WithDeleted      bool   `json:"withDeleted"`
+		UpdatedAfter     string `json:"updatedAfter"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	var updatedAfter time.Time
+	if req.UpdatedAfter != "" {
+		var err error
+		updatedAfter, err = time.Parse(time.RFC3339, req.UpdatedAfter)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "updatedAfter must be a valid ISO 8601 date string")
+			return
+		}
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	size := s.PageSize
+	if req.Size > 0 && req.Size < size {
+		size = req.Size
+	}
+
+	matches := []map[string]any{}
+	for _, id := range s.assetOrder {
+		a := s.assets[id]
+		switch {
+		case a.IsTrashed && !req.WithDeleted,
+			req.ID != "" && a.ID != req.ID,
+			req.Checksum != "" && a.Checksum != req.Checksum,
+			req.OriginalFileName != "" && a.OriginalFileName+path.Ext(a.OriginalPath) != req.OriginalFileName,
+			req.DeviceAssetID != "" && a.DeviceAssetID != req.DeviceAssetID,
+			!updatedAfter.IsZero() && !a.UpdatedAt.After(updatedAfter):
+			continue
+		}
+		matches = append(matches, a.wire())
+	}
+
+	start := (req.Page - 1) * size
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + size
+	var nextPage any
+	if end < len(matches) {
+		nextPage = strconv.Itoa(req.Page + 1)
+	} else {
+		end = len(matches)
+	}
+	items := matches[start:end]
+	writeJSON(w, http.StatusOK, map[string]any{
+		"assets": map[string]any{
+			"total":    len(items),
+			"count":    len(items),
+			"items":    items,
+			"nextPage": nextPage,
+		},
+		"albums": map[string]any{
+			"total": 0, "count": 0, "items": []any{}, "nextPage": nil,
+		},
+	})
+}
+
+// upload stores the asset sent in a multipart form
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	if checksum := r.Header.Get("x-immich-checksum"); checksum != "" {
+		if a := s.byChecksum(normalizeChecksum(checksum)); a != nil {
+			_, _ = io.Copy(io.Discard, r.Body)
+			writeJSON(w, http.StatusOK, immich.AssetResponse{ID: a.ID, Duplicate: true})
+			return
+		}
+	}
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	f, fh, err := r.FormFile("assetData")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "assetData: "+err.Error())
+		return
+	}
+	content, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a := &Asset{
+		DeviceAssetID: r.FormValue("deviceAssetId"),
+		DeviceID:      r.FormValue("deviceId"),
+		Type:          strings.ToUpper(r.FormValue("assetType")),
+		Content:       content,
+	}
+	if a.DeviceAssetID == "" || a.DeviceID == "" || a.Type == "" {
+		writeError(w, http.StatusBadRequest, "deviceAssetId, deviceId and assetType are required")
+		return
+	}
+	h := sha1.Sum(content)
+	a.Checksum = base64.StdEncoding.EncodeToString(h[:])
+	if dup := s.byChecksum(a.Checksum); dup != nil {
+		writeJSON(w, http.StatusOK, immich.AssetResponse{ID: dup.ID, Duplicate: true})
+		return
+	}
+
+	ext := path.Ext(fh.Filename)
+	a.OriginalFileName = strings.TrimSuffix(fh.Filename, ext)
+	a.FileCreatedAt, _ = time.Parse(time.RFC3339, r.FormValue("fileCreatedAt"))
+	a.FileModifiedAt, _ = time.Parse(time.RFC3339, r.FormValue("fileModifiedAt"))
+	a.DateTimeOriginal = a.FileCreatedAt
+	a.IsFavorite = r.FormValue("isFavorite") == "true"
+	a.LivePhotoVideoID = r.FormValue("livePhotoVideoId")
+	if sc, _, err := r.FormFile("sidecarData"); err == nil {
+		a.Sidecar, _ = io.ReadAll(sc)
+		sc.Close()
+	}
+
+	a.ID = s.newID()
+	a.OriginalPath = "upload/library/admin/" + a.ID + strings.ToLower(ext)
+	s.addAsset(a)
+	writeJSON(w, http.StatusCreated, immich.AssetResponse{ID: a.ID})
+}
+
+// normalizeChecksum gives the base64 encoding of a checksum given in hexadecimal
+func normalizeChecksum(checksum string) string {
+	if len(checksum) == 2*sha1.Size {
+		if b, err := hex.DecodeString(checksum); err == nil {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+	}
+	return checksum
+}
+
+func (s *Server) bulkUploadCheck(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Assets []immich.BulkCheckItem `json:"assets"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	results := []immich.BulkCheckResult{}
+	for _, item := range req.Assets {
+		res := immich.BulkCheckResult{ID: item.ID, Action: "accept"}
+		if a := s.byChecksum(normalizeChecksum(item.Checksum)); a != nil {
+			res.Action = "reject"
+			res.Reason = "duplicate"
+			res.AssetID = a.ID
+			res.IsTrashed = a.IsTrashed
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+// updateAssets changes several assets at once, it is used for stacking the assets
+func (s *Server) updateAssets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs           []string `json:"ids"`
+		IsArchived    *bool    `json:"isArchived"`
+		IsFavorite    *bool    `json:"isFavorite"`
+		Latitude      *float64 `json:"latitude"`
+		Longitude     *float64 `json:"longitude"`
+		RemoveParent  bool     `json:"removeParent"`
+		StackParentID string   `json:"stackParentId"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	for _, id := range req.IDs {
+		if _, ok := s.assets[id]; !ok {
+			writeError(w, http.StatusBadRequest, "Not found or no asset.update access")
+			return
+		}
+	}
+	if req.StackParentID != "" {
+		if _, ok := s.assets[req.StackParentID]; !ok {
+			writeError(w, http.StatusBadRequest, "Not found or no asset.update access")
+			return
+		}
+	}
+	for _, id := range req.IDs {
+		a := s.assets[id]
+		if req.IsArchived != nil {
+			a.IsArchived = *req.IsArchived
+		}
+		if req.IsFavorite != nil {
+			a.IsFavorite = *req.IsFavorite
+		}
+		if req.Latitude != nil && req.Longitude != nil && (*req.Latitude != 0 || *req.Longitude != 0) {
+			a.Latitude, a.Longitude = *req.Latitude, *req.Longitude
+		}
+		switch {
+		case req.RemoveParent:
+			a.StackParentID = ""
+		case req.StackParentID != "" && id != req.StackParentID:
+			a.StackParentID = req.StackParentID
+		}
+		a.UpdatedAt = time.Now()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) updateAsset(w http.ResponseWriter, r *http.Request, id string) {
+	a, ok := s.assets[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Not found or no asset.update access")
+		return
+	}
+	var req immich.AssetUpdate
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.DateTimeOriginal != "" {
+		d, err := time.Parse(time.RFC3339, req.DateTimeOriginal)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "dateTimeOriginal must be a valid ISO 8601 date string")
+			return
+		}
+		a.DateTimeOriginal = d
+		a.TimeZone = ""
+	}
+	if req.IsArchived != nil {
+		a.IsArchived = *req.IsArchived
+	}
+	if req.IsFavorite != nil {
+		a.IsFavorite = *req.IsFavorite
+	}
+	if req.Latitude != nil {
+		a.Latitude = *req.Latitude
+	}
+	if req.Longitude != nil {
+		a.Longitude = *req.Longitude
+	}
+	if req.Description != nil {
+		a.Description = *req.Description
+	}
+	a.UpdatedAt = time.Now()
+	writeJSON(w, http.StatusOK, a.wire())
+}
+
+// deleteAssets moves the assets to the trash, or removes them when forced
+func (s *Server) deleteAssets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Force bool     `json:"force"`
+		IDs   []string `json:"ids"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	for _, id := range req.IDs {
+		a, ok := s.assets[id]
+		if !ok {
+			continue
+		}
+		if !req.Force {
+			a.IsTrashed = true
+			a.UpdatedAt = time.Now()
+			continue
+		}
+		s.removeAsset(id)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveAsset deletes the asset permanently, like when the trash is emptied
+func (s *Server) RemoveAsset(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removeAsset(id)
+}
+
+func (s *Server) removeAsset(id string) {
+	if _, ok := s.assets[id]; !ok {
+		return
+	}
+	delete(s.assets, id)
+	for i, aid := range s.assetOrder {
+		if aid == id {
+			s.assetOrder = append(s.assetOrder[:i], s.assetOrder[i+1:]...)
+			break
+		}
+	}
+	for _, al := range s.albums {
+		al.remove(id)
+	}
+	for _, t := range s.tags {
+		t.remove(id)
+	}
+	s.deletions = append(s.deletions, deletion{id: id, at: time.Now()})
+}
+
+// deletion is an entry of the audit of the deleted assets
+type deletion struct {
+	id string
+	at time.Time
+}
+
+// auditDeletes gives the assets deleted after the date
+func (s *Server) auditDeletes(w http.ResponseWriter, r *http.Request) {
+	after, err := time.Parse(time.RFC3339, r.URL.Query().Get("after"))
+	if err != nil || r.URL.Query().Get("entityType") != "ASSET" {
+		writeError(w, http.StatusBadRequest, "after must be a valid ISO 8601 date string, entityType must be ASSET")
+		return
+	}
+	ids := []string{}
+	for _, d := range s.deletions {
+		if d.at.After(after) {
+			ids = append(ids, d.id)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"needsFullSync": false, "ids": ids})
+}
+
+func (s *Server) download(w http.ResponseWriter, id string) {
+	a, ok := s.assets[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Not found or no asset.download access")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.Content)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(a.Content)
+}
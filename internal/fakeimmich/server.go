@@ -0,0 +1,261 @@
+// Package fakeimmich is an in-process stand-in of the immich server for the tests.
+//
+// It implements the endpoints used by immich.ImmichClient over an httptest server,
+// with an in-memory state of the assets, albums and tags. Errors can be injected on any endpoint
+// to exercise the retries and the error paths of the commands without docker.
+package fakeimmich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// APIKey is the key accepted by default by the server
+const APIKey = "fake-immich-api-key"
+
+// Server is a fake immich server
+type Server struct {
+	URL        string                // Base URL of the server, to be given to -server
+	Key        string                // API key expected in the x-api-key header
+	PageSize   int                   // Number of assets per page of search/metadata
+	User       immich.User           // The user of the API key
+	MediaTypes immich.SupportedMedia // Media types supported by the server
+
+	ts         *httptest.Server
+	lock       sync.Mutex
+	assets     map[string]*Asset
+	assetOrder []string
+	albums     map[string]*Album
+	albumOrder []string
+	tags       map[string]*Tag
+	tagOrder   []string
+	deletions  []deletion
+	failures   []*failure
+	calls      map[string]int
+	lastID     int
+}
+
+// failure is an error to inject in the next requests matching the method and the path
+type failure struct {
+	method string
+	path   string
+	status int
+	count  int
+}
+
+// New starts a fake immich server. The caller must close it.
+func New() *Server {
+	s := &Server{
+		Key:      APIKey,
+		PageSize: 1000,
+		User: immich.User{
+			ID:        "00000000-0000-0000-0000-000000000000",
+			Email:     "demo@immich.app",
+			FirstName: "Demo",
+			IsAdmin:   true,
+		},
+		MediaTypes: immich.DefaultSupportedMedia,
+		assets:     map[string]*Asset{},
+		albums:     map[string]*Album{},
+		tags:       map[string]*Tag{},
+		calls:      map[string]int{},
+	}
+	s.ts = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.ts.URL
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// Client gives an immich client connected to the server, with short retry delays
+func (s *Server) Client() (*immich.ImmichClient, error) {
+	ic, err := immich.NewImmichClient(s.URL, s.Key, false)
+	if err != nil {
+		return nil, err
+	}
+	ic.RetriesDelay = time.Millisecond
+	ic.MaxRetriesDelay = 10 * time.Millisecond
+	return ic, nil
+}
+
+// FailNext makes the next count requests matching the method and the path fail with the status code.
+// The path is relative to the API, like /asset/upload. A path ending with * matches all paths with this prefix.
+func (s *Server) FailNext(method, path string, status int, count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: path, status: status, count: count})
+}
+
+// Calls gives the number of requests received for the method and the path, including the failed ones.
+// The path follows the rules of FailNext.
+func (s *Server) Calls(method, path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := 0
+	for k, c := range s.calls {
+		m, p, _ := strings.Cut(k, " ")
+		if m == method && matchPath(path, p) {
+			n += c
+		}
+	}
+	return n
+}
+
+func matchPath(pattern, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return pattern == path
+}
+
+// newID gives a new identifier looking like the server's UUIDs
+func (s *Server) newID() string {
+	s.lastID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.lastID)
+}
+
+// injectedFailure gives the status to return for the request, 0 when the request must be processed
+func (s *Server) injectedFailure(method, path string) int {
+	for i, f := range s.failures {
+		if f.method == method && matchPath(f.path, path) {
+			f.count--
+			if f.count <= 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+			return f.status
+		}
+	}
+	return 0
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := strings.CutPrefix(r.URL.Path, "/api")
+	if !ok {
+		writeError(w, http.StatusNotFound, "Cannot "+r.Method+" "+r.URL.Path)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.calls[r.Method+" "+p]++
+	if status := s.injectedFailure(r.Method, p); status != 0 {
+		writeError(w, status, "injected failure")
+		return
+	}
+	if r.Header.Get("x-api-key") != s.Key {
+		writeError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	route := r.Method + " " + parts[0]
+	if len(parts) > 1 {
+		route += "/" + parts[1]
+	}
+
+	switch {
+	case route == "GET server-info/ping":
+		writeJSON(w, http.StatusOK, immich.PingResponse{Res: "pong"})
+	case route == "GET server-info/media-types":
+		s.mediaTypes(w)
+	case route == "GET server-info/statistics":
+		s.statistics(w)
+	case route == "GET user/me":
+		writeJSON(w, http.StatusOK, s.User)
+	case route == "POST search/metadata":
+		s.searchMetadata(w, r)
+	case route == "POST asset/upload":
+		s.upload(w, r)
+	case route == "POST asset/bulk-upload-check":
+		s.bulkUploadCheck(w, r)
+	case route == "PUT asset" && len(parts) == 1:
+		s.updateAssets(w, r)
+	case route == "DELETE asset" && len(parts) == 1:
+		s.deleteAssets(w, r)
+	case strings.HasPrefix(route, "PUT asset/") && len(parts) == 2:
+		s.updateAsset(w, r, parts[1])
+	case strings.HasPrefix(route, "POST download/asset") && len(parts) == 3:
+		s.download(w, parts[2])
+	case route == "GET audit/deletes":
+		s.auditDeletes(w, r)
+	case route == "GET album" && len(parts) == 1:
+		s.getAlbums(w, r)
+	case route == "POST album" && len(parts) == 1:
+		s.createAlbum(w, r)
+	case strings.HasPrefix(route, "GET album/") && len(parts) == 2:
+		s.getAlbum(w, parts[1])
+	case strings.HasPrefix(route, "DELETE album/") && len(parts) == 2:
+		s.deleteAlbum(w, parts[1])
+	case strings.HasPrefix(route, "PUT album/") && len(parts) == 3 && parts[2] == "assets":
+		s.addAssetsToAlbum(w, r, parts[1])
+	case route == "GET tags" && len(parts) == 1:
+		s.getTags(w)
+	case route == "POST tags" && len(parts) == 1:
+		s.createTag(w, r)
+	case route == "PUT tags" && len(parts) == 1:
+		s.upsertTags(w, r)
+	case strings.HasPrefix(route, "PUT tags/") && len(parts) == 3 && parts[2] == "assets":
+		s.tagAssets(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "Cannot "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *Server) mediaTypes(w http.ResponseWriter) {
+	types := map[string][]string{}
+	for ext, t := range s.MediaTypes {
+		switch t {
+		case immich.TypeImage, immich.TypeVideo, immich.TypeSidecar:
+			types[t] = append(types[t], ext)
+		}
+	}
+	writeJSON(w, http.StatusOK, types)
+}
+
+func (s *Server) statistics(w http.ResponseWriter) {
+	st := immich.ServerStatistics{}
+	for _, a := range s.assets {
+		if a.Type == "VIDEO" {
+			st.Videos++
+		} else {
+			st.Photos++
+		}
+		st.Usage += int64(a.size())
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// decodeBody reads the JSON body of the request, and answers with a bad request on error
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, immich.ServerMessage{
+		Error:      http.StatusText(status),
+		StatusCode: fmt.Sprint(status),
+		Message:    []string{message},
+	})
+}
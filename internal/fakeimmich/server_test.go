@@ -0,0 +1,220 @@
+package fakeimmich
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+)
+
+func localAsset(name string, content string) *browser.LocalAssetFile {
+	return &browser.LocalAssetFile{
+		FileName:  name,
+		Title:     name,
+		FileSize:  len(content),
+		DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, time.FixedZone("", 2*3600)),
+		FSys:      fstest.MapFS{name: &fstest.MapFile{Data: []byte(content)}},
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	defer s.Close()
+	ic, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ic.PingServer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	u, err := ic.ValidateConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != s.User.Email || !ic.SupportedMedia().IsMedia(".jpg") {
+		t.Fatalf("unexpected user or media types: %v, %v", u, ic.SupportedMedia())
+	}
+
+	// Upload, and upload the same content again
+	r1, err := ic.AssetUpload(ctx, localAsset("PHOTO_1.jpg", "photo 1"))
+	if err != nil || r1.Duplicate {
+		t.Fatalf("AssetUpload() = %v, %v", r1, err)
+	}
+	r2, err := ic.AssetUpload(ctx, localAsset("PHOTO_2.jpg", "photo 2"))
+	if err != nil || r2.Duplicate {
+		t.Fatalf("AssetUpload() = %v, %v", r2, err)
+	}
+	r3, err := ic.AssetUpload(ctx, localAsset("COPY.jpg", "photo 1"))
+	if err != nil || !r3.Duplicate || r3.ID != r1.ID {
+		t.Fatalf("AssetUpload() = %v, %v, want a duplicate of %s", r3, err, r1.ID)
+	}
+
+	la := localAsset("PHOTO_1.jpg", "photo 1")
+	checksum, err := la.ComputeChecksum()
+	_ = la.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := ic.CheckBulkUpload(ctx, []immich.BulkCheckItem{{ID: "a", Checksum: checksum}, {ID: "b", Checksum: "AAAA"}})
+	if err != nil || len(results) != 2 || results[0].Action != "reject" || results[0].AssetID != r1.ID || results[1].Action != "accept" {
+		t.Fatalf("CheckBulkUpload() = %v, %v", results, err)
+	}
+
+	// Paging
+	s.PageSize = 1
+	assets, err := ic.GetAllAssets(ctx)
+	if err != nil || len(assets) != 2 {
+		t.Fatalf("GetAllAssets() = %d assets, %v", len(assets), err)
+	}
+	a := assets[0]
+	if a.OriginalFileName != "PHOTO_1" || a.Checksum != checksum || a.ExifInfo.FileSizeInByte != 7 {
+		t.Errorf("unexpected asset: %+v", a)
+	}
+	if w := a.WallClock(); !w.Equal(time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("WallClock() = %s", w)
+	}
+	// The pages after the last one are requested ahead
+	if n := s.Calls(http.MethodPost, "/search/metadata"); n != 1+ic.PageFetchers {
+		t.Errorf("expected 2 pages and %d pages ahead, got %d calls", ic.PageFetchers-1, n)
+	}
+
+	// Albums
+	al, err := ic.CreateAlbum(ctx, "album", []string{r1.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ic.AddAssetToAlbum(ctx, al.ID, []string{r1.ID, r2.ID})
+	if err != nil || len(res) != 2 || res[0].Error != "duplicate" || !res[1].Success {
+		t.Fatalf("AddAssetToAlbum() = %v, %v", res, err)
+	}
+	content, err := ic.GetAlbumInfo(ctx, al.ID)
+	if err != nil || content.AlbumName != "album" || len(content.Assets) != 2 {
+		t.Fatalf("GetAlbumInfo() = %v, %v", content, err)
+	}
+	albums, err := ic.GetAssetAlbums(ctx, r2.ID)
+	if err != nil || len(albums) != 1 || albums[0].ID != al.ID {
+		t.Fatalf("GetAssetAlbums() = %v, %v", albums, err)
+	}
+
+	// Tags
+	tags, err := ic.UpsertTags(ctx, []string{"Places/France/Paris", "Places/France"})
+	if err != nil || len(tags) != 2 || tags[0].Name != "Paris" || tags[0].Value != "Places/France/Paris" || tags[0].ParentID != tags[1].ID {
+		t.Fatalf("UpsertTags() = %v, %v", tags, err)
+	}
+	if _, err = ic.CreateTag(ctx, "France", tags[1].ParentID); err == nil {
+		t.Errorf("CreateTag() should fail on an existing tag")
+	}
+	tag, err := ic.CreateTag(ctx, "Lyon", tags[1].ID)
+	if err != nil || tag.Value != "Places/France/Lyon" {
+		t.Fatalf("CreateTag() = %v, %v", tag, err)
+	}
+	if all, err := ic.GetAllTags(ctx); err != nil || len(all) != 4 {
+		t.Fatalf("GetAllTags() = %v, %v", all, err)
+	}
+	res, err = ic.TagAssets(ctx, tags[0].ID, []string{r1.ID, r1.ID, "unknown"})
+	if err != nil || len(res) != 3 || !res[0].Success || res[1].Error != "duplicate" || res[2].Error != "not_found" {
+		t.Fatalf("TagAssets() = %v, %v", res, err)
+	}
+
+	// Updates
+	desc := "a description"
+	upd, err := ic.UpdateAssetFields(ctx, r1.ID, immich.AssetUpdate{DateTimeOriginal: "2023-10-06T10:30:00+09:00", Description: &desc})
+	if err != nil || upd.ExifInfo.Description != desc || !upd.ExifInfo.DateTimeOriginal.Equal(time.Date(2023, 10, 6, 1, 30, 0, 0, time.UTC)) {
+		t.Fatalf("UpdateAssetFields() = %+v, %v", upd, err)
+	}
+	if err = ic.StackAssets(ctx, r1.ID, []string{r2.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := s.Asset(r2.ID); a.StackParentID != r1.ID {
+		t.Errorf("the asset isn't stacked: %+v", a)
+	}
+
+	// Download
+	rc, err := ic.DownloadAsset(ctx, r2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "photo 2" {
+		t.Errorf("DownloadAsset() = %q", b)
+	}
+
+	// Deletion
+	if err = ic.DeleteAssets(ctx, []string{r2.ID}, false); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := s.Asset(r2.ID); !a.IsTrashed {
+		t.Errorf("the asset isn't trashed")
+	}
+	if err = ic.DeleteAssets(ctx, []string{r2.ID}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Asset(r2.ID); ok {
+		t.Errorf("the asset isn't deleted")
+	}
+	if l := s.Albums(); len(l[0].AssetIDs) != 1 {
+		t.Errorf("the asset is still in the album: %v", l)
+	}
+	if err = ic.DeleteAlbum(ctx, al.ID); err != nil || len(s.Albums()) != 0 {
+		t.Fatalf("DeleteAlbum() = %v, albums: %v", err, s.Albums())
+	}
+}
+
+func TestInjectedFailures(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	defer s.Close()
+	ic, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.Retries = 2
+	if _, err = ic.ValidateConnection(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Temporary errors are retried
+	s.FailNext(http.MethodGet, "/server-info/ping", http.StatusServiceUnavailable, 2)
+	if err = ic.PingServer(ctx); err != nil {
+		t.Errorf("PingServer() should succeed after the retries: %v", err)
+	}
+	if n := s.Calls(http.MethodGet, "/server-info/ping"); n != 3 {
+		t.Errorf("expected 3 calls, got %d", n)
+	}
+
+	// The uploads are retried from the beginning of the file
+	s.FailNext(http.MethodPost, "/asset/*", http.StatusBadGateway, 1)
+	r, err := ic.AssetUpload(ctx, localAsset("PHOTO.jpg", "photo"))
+	if err != nil || r.Duplicate {
+		t.Fatalf("AssetUpload() = %v, %v", r, err)
+	}
+	if a, _ := s.Asset(r.ID); string(a.Content) != "photo" {
+		t.Errorf("unexpected content: %q", a.Content)
+	}
+
+	// Other errors are reported
+	s.FailNext(http.MethodGet, "/album", http.StatusForbidden, 1)
+	if _, err = ic.GetAllAlbums(ctx); err == nil {
+		t.Errorf("GetAllAlbums() should fail")
+	}
+	if _, err = ic.GetAllAlbums(ctx); err != nil {
+		t.Errorf("the failure should be injected once: %v", err)
+	}
+
+	if _, err = ic.GetAlbumInfo(ctx, "unknown"); err == nil {
+		t.Errorf("GetAlbumInfo() should fail on an unknown album")
+	}
+
+	ic, _ = immich.NewImmichClient(s.URL, "wrong key", false)
+	if _, err = ic.ValidateConnection(ctx); err == nil {
+		t.Errorf("ValidateConnection() should fail with a wrong key")
+	}
+}
@@ -0,0 +1,166 @@
+package fakeimmich
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// Tag is a tag of the server. The value is the path of the tag, like "Places/France/Paris".
+type Tag struct {
+	ID       string
+	Name     string
+	Value    string
+	ParentID string
+	AssetIDs []string
+}
+
+func (t *Tag) has(id string) bool {
+	for _, aid := range t.AssetIDs {
+		if aid == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tag) remove(id string) {
+	for i, aid := range t.AssetIDs {
+		if aid == id {
+			t.AssetIDs = append(t.AssetIDs[:i], t.AssetIDs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *Tag) wire() immich.Tag {
+	return immich.Tag{ID: t.ID, Name: t.Name, Value: t.Value, ParentID: t.ParentID}
+}
+
+// Tags gives a copy of the tags of the server, in the order of their creation
+func (s *Server) Tags() []Tag {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	l := make([]Tag, 0, len(s.tagOrder))
+	for _, id := range s.tagOrder {
+		t := *s.tags[id]
+		t.AssetIDs = append([]string(nil), t.AssetIDs...)
+		l = append(l, t)
+	}
+	return l
+}
+
+// tagByValue gives the tag of the path, nil when it doesn't exist
+func (s *Server) tagByValue(value string) *Tag {
+	for _, id := range s.tagOrder {
+		if t := s.tags[id]; t.Value == value {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Server) addTag(name string, parent *Tag) *Tag {
+	t := &Tag{ID: s.newID(), Name: name, Value: name}
+	if parent != nil {
+		t.ParentID = parent.ID
+		t.Value = parent.Value + "/" + name
+	}
+	s.tags[t.ID] = t
+	s.tagOrder = append(s.tagOrder, t.ID)
+	return t
+}
+
+func (s *Server) getTags(w http.ResponseWriter) {
+	l := []immich.Tag{}
+	for _, id := range s.tagOrder {
+		l = append(l, s.tags[id].wire())
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (s *Server) createTag(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		ParentID string `json:"parentId"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name should not be empty")
+		return
+	}
+	var parent *Tag
+	if req.ParentID != "" {
+		parent = s.tags[req.ParentID]
+		if parent == nil {
+			writeError(w, http.StatusBadRequest, "Tag not found")
+			return
+		}
+	}
+	value := req.Name
+	if parent != nil {
+		value = parent.Value + "/" + req.Name
+	}
+	if s.tagByValue(value) != nil {
+		writeError(w, http.StatusBadRequest, "A tag with that name and parent already exists")
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.addTag(req.Name, parent).wire())
+}
+
+// upsertTags gives the tags of the paths, and creates the missing ones with their parents
+func (s *Server) upsertTags(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	l := []immich.Tag{}
+	for _, value := range req.Tags {
+		var t *Tag
+		for _, name := range strings.Split(value, "/") {
+			v := name
+			if t != nil {
+				v = t.Value + "/" + name
+			}
+			next := s.tagByValue(v)
+			if next == nil {
+				next = s.addTag(name, t)
+			}
+			t = next
+		}
+		l = append(l, t.wire())
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (s *Server) tagAssets(w http.ResponseWriter, r *http.Request, id string) {
+	t, ok := s.tags[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Not found or no tag.asset access")
+		return
+	}
+	var req immich.UpdateAlbum
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	results := []immich.UpdateAlbumResult{}
+	for _, aid := range req.IDS {
+		res := immich.UpdateAlbumResult{ID: aid}
+		switch {
+		case s.assets[aid] == nil:
+			res.Error = "not_found"
+		case t.has(aid):
+			res.Error = "duplicate"
+		default:
+			t.AssetIDs = append(t.AssetIDs, aid)
+			res.Success = true
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, results)
+}
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"fmt"
+	"io/fs"
+	"reflect"
 	"strings"
 	"sync"
 )
@@ -8,9 +11,18 @@ import (
 type Journal struct {
 	mut    sync.Mutex
 	counts map[Action]int
+	files  map[fileKey]*FileReport // fate of each file
+	order  []fileKey               // files by order of appearance
 	Log    Logger
 }
 
+// fileKey identifies a file by the name of its file system and its path:
+// the same path can be found in different folders or archives
+type fileKey struct {
+	fs   string
+	file string
+}
+
 type Action string
 
 const (
@@ -34,6 +46,8 @@ const (
 	INFO               Action = "Info"
 	NotSelected        Action = "Not selected because options"
 	ServerError        Action = "Server error"
+	Resumed            Action = "Handled by a previous run"
+	Geotagged          Action = "Geotagged from the tracks"
 )
 
 func NewJournal(log Logger) *Journal {
@@ -41,10 +55,17 @@ func NewJournal(log Logger) *Journal {
 		// files:  map[string]Entries{},
 		Log:    log,
 		counts: map[Action]int{},
+		files:  map[fileKey]*FileReport{},
 	}
 }
 
+// AddEntry records an action on a file that doesn't belong to a file system, like a server's asset
 func (j *Journal) AddEntry(file string, action Action, comment ...string) {
+	j.AddFileEntry(nil, file, action, comment...)
+}
+
+// AddFileEntry records an action on a file of the file system
+func (j *Journal) AddFileEntry(fsys fs.FS, file string, action Action, comment ...string) {
 	if j == nil {
 		return
 	}
@@ -66,12 +87,67 @@ func (j *Journal) AddEntry(file string, action Action, comment ...string) {
 	if action == Upgraded {
 		j.counts[Uploaded]--
 	}
+	if file != "" {
+		f := j.file(fsys, file)
+		f.History = append(f.History, FileEvent{Action: action, Comment: c})
+		if !action.informative() {
+			f.Action = action
+			f.Comment = c
+		}
+	}
 	j.mut.Unlock()
 }
 
+// SetAsset records the server's asset ID and the albums of a file that doesn't belong to a file system
+func (j *Journal) SetAsset(file string, id string, albums []string) {
+	j.SetFileAsset(nil, file, id, albums)
+}
+
+// SetFileAsset records the server's asset ID and the albums of the file of the file system
+func (j *Journal) SetFileAsset(fsys fs.FS, file string, id string, albums []string) {
+	if j == nil || file == "" {
+		return
+	}
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	f := j.file(fsys, file)
+	f.ID = id
+	f.Albums = append([]string(nil), albums...)
+}
+
+func (j *Journal) file(fsys fs.FS, file string) *FileReport {
+	k := fileKey{fs: FSName(fsys), file: file}
+	f, ok := j.files[k]
+	if !ok {
+		f = &FileReport{FS: k.fs, File: file}
+		j.files[k] = f
+		j.order = append(j.order, k)
+	}
+	return f
+}
+
+// FSName names the file system in the reports, with its String method, or the folder of os.DirFS.
+// The other file systems are named after their type and their address.
+func FSName(fsys fs.FS) string {
+	if fsys == nil {
+		return ""
+	}
+	if s, ok := fsys.(fmt.Stringer); ok {
+		return s.String()
+	}
+	v := reflect.ValueOf(fsys)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Pointer, reflect.Map:
+		return fmt.Sprintf("%T@%x", fsys, v.Pointer())
+	}
+	return fmt.Sprintf("%T", fsys)
+}
+
 func (j *Journal) Report() {
 	checkFiles := j.counts[ScannedImage] + j.counts[ScannedVideo] + j.counts[Metadata] + j.counts[Unsupported] + j.counts[FailedVideo] + j.counts[Discarded]
-	handledFiles := j.counts[NotSelected] + j.counts[LocalDuplicate] + j.counts[ServerDuplicate] + j.counts[ServerBetter] + j.counts[Uploaded] + j.counts[Upgraded] + j.counts[ServerError]
+	handledFiles := j.counts[NotSelected] + j.counts[LocalDuplicate] + j.counts[ServerDuplicate] + j.counts[ServerBetter] + j.counts[Uploaded] + j.counts[Upgraded] + j.counts[ServerError] + j.counts[Resumed]
 	j.Log.OK("Scan of the sources:")
 	j.Log.OK("%6d files in the input", j.counts[DiscoveredFile])
 	j.Log.OK("--------------------------------------------------------")
@@ -93,6 +169,10 @@ func (j *Journal) Report() {
 	j.Log.OK("%6d discarded files because duplicated in the input", j.counts[LocalDuplicate])
 	j.Log.OK("%6d discarded files because server has a better image", j.counts[ServerBetter])
 	j.Log.OK("%6d errors when uploading", j.counts[ServerError])
+	j.Log.OK("%6d files handled by a previous run", j.counts[Resumed])
+	if j.counts[Geotagged] > 0 {
+		j.Log.OK("%6d files geotagged from the tracks", j.counts[Geotagged])
+	}
 
 	j.Log.OK("%6d handled total (difference %d)", handledFiles, j.counts[ScannedImage]+j.counts[ScannedVideo]-handledFiles)
 }
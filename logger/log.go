@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/ttacon/chalk"
 )
@@ -61,6 +62,7 @@ var colorLevel = map[Level]string{
 }
 
 type Log struct {
+	mut          sync.Mutex // the log can be used by concurrent goroutines
 	needCR       bool
 	needSpace    bool
 	displayLevel Level
@@ -149,6 +151,8 @@ func (l *Log) DebugObject(name string, v any) {
 		l.Error("can't display object %s: %s", name, err)
 		return
 	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
 	if l.needCR {
 		fmt.Println()
 		l.needCR = false
@@ -214,6 +218,8 @@ func (l *Log) Message(level Level, f string, v ...any) {
 	if level > l.displayLevel {
 		return
 	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
 	if l.needCR {
 		fmt.Fprintln(l.out)
 		l.needCR = false
@@ -234,6 +240,8 @@ func (l *Log) Progress(level Level, f string, v ...any) {
 	if level > l.displayLevel {
 		return
 	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
 	fmt.Fprintf(l.out, "\r\033[2K"+f, v...)
 	l.needCR = true
 }
@@ -245,6 +253,8 @@ func (l *Log) MessageContinue(level Level, f string, v ...any) {
 	if level > l.displayLevel {
 		return
 	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
 	if l.needCR {
 		fmt.Fprintln(l.out)
 		l.needCR = false
@@ -265,6 +275,8 @@ func (l *Log) MessageTerminate(level Level, f string, v ...any) {
 	if level > l.displayLevel {
 		return
 	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
 	fmt.Fprint(l.out, l.colorStrings[level])
 	fmt.Fprintf(l.out, f, v...)
 	if !l.noColors {
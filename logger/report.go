@@ -0,0 +1,98 @@
+package logger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// FileReport is the fate of a file
+type FileReport struct {
+	FS      string      `json:"fs,omitempty"` // the name of the file system: the folder, or the archives
+	File    string      `json:"file"`
+	Action  Action      `json:"action"`            // the last action that isn't only informative
+	Comment string      `json:"comment,omitempty"` // the comment of the action
+	ID      string      `json:"id,omitempty"`      // the server's asset ID
+	Albums  []string    `json:"albums,omitempty"`
+	History []FileEvent `json:"history"` // all the actions on the file
+}
+
+type FileEvent struct {
+	Action  Action `json:"action"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// informative actions don't change the fate of a file
+func (a Action) informative() bool {
+	switch a {
+	case DiscoveredFile, INFO, Album, AssociatedMetadata, LivePhoto, Stacked, Geotagged:
+		return true
+	}
+	return false
+}
+
+// Files gives the fate of all files by order of appearance
+func (j *Journal) Files() []FileReport {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	r := make([]FileReport, 0, len(j.order))
+	for _, f := range j.order {
+		r = append(r, *j.files[f])
+	}
+	return r
+}
+
+// sortedFiles gives the fate of all files sorted by file system and path, so the reports don't depend on
+// the order of the concurrent uploads
+func (j *Journal) sortedFiles() []FileReport {
+	r := j.Files()
+	for i := range r {
+		r[i].Albums = append([]string(nil), r[i].Albums...)
+		sort.Strings(r[i].Albums)
+	}
+	sort.SliceStable(r, func(a, b int) bool {
+		if r[a].FS != r[b].FS {
+			return r[a].FS < r[b].FS
+		}
+		return r[a].File < r[b].File
+	})
+	return r
+}
+
+type jsonReport struct {
+	Counts map[Action]int `json:"counts"`
+	Files  []FileReport   `json:"files"`
+}
+
+// WriteJSON writes the counts of actions and the fate of each file, sorted by file system and path
+func (j *Journal) WriteJSON(w io.Writer) error {
+	r := jsonReport{Files: j.sortedFiles(), Counts: map[Action]int{}}
+	j.mut.Lock()
+	for a, c := range j.counts {
+		r.Counts[a] = c
+	}
+	j.mut.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one line by file, sorted by file system and path: fs,file,action,comment,id,albums.
+// The albums are separated by semicolons.
+func (j *Journal) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"fs", "file", "action", "comment", "id", "albums"})
+	if err != nil {
+		return err
+	}
+	for _, f := range j.sortedFiles() {
+		err = cw.Write([]string{f.FS, f.File, string(f.Action), f.Comment, f.ID, strings.Join(f.Albums, ";")})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
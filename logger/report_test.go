@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestJournalReports(t *testing.T) {
+	j := NewJournal(NoLog{})
+	photos, backup := os.DirFS("photos"), os.DirFS("backup")
+	j.AddFileEntry(photos, "a/1.jpg", DiscoveredFile)
+	j.AddFileEntry(photos, "a/1.jpg", ScannedImage)
+	j.AddFileEntry(photos, "a/1.jpg", Uploaded)
+	j.AddFileEntry(photos, "a/1.jpg", Album, "a")
+	j.SetFileAsset(photos, "a/1.jpg", "id-1", []string{"summer, 2023", "a"})
+	j.AddFileEntry(photos, "a/2.mp4", DiscoveredFile)
+	j.AddFileEntry(photos, "a/2.mp4", ScannedVideo)
+	j.AddFileEntry(photos, "a/2.mp4", NotSelected, "extension excluded")
+	// The same path in another folder
+	j.AddFileEntry(backup, "a/1.jpg", DiscoveredFile)
+	j.AddFileEntry(backup, "a/1.jpg", ScannedImage)
+	j.AddFileEntry(backup, "a/1.jpg", ServerDuplicate)
+	j.AddEntry("upload/notes.txt", Unsupported)
+
+	b := bytes.NewBuffer(nil)
+	if err := j.WriteCSV(b); err != nil {
+		t.Fatal(err)
+	}
+	// The files are sorted by file system and path
+	expected := `fs,file,action,comment,id,albums
+,upload/notes.txt,File type not supported,,,
+backup,a/1.jpg,Server has photo,,,
+photos,a/1.jpg,Uploaded,,id-1,"a;summer, 2023"
+photos,a/2.mp4,Not selected because options,extension excluded,,
+`
+	if b.String() != expected {
+		t.Errorf("CSV: expected\n%s\ngot\n%s", expected, b.String())
+	}
+
+	b.Reset()
+	if err := j.WriteJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	r := jsonReport{}
+	if err := json.Unmarshal(b.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Counts[DiscoveredFile] != 3 || r.Counts[Uploaded] != 1 {
+		t.Errorf("unexpected counts: %v", r.Counts)
+	}
+	if len(r.Files) != 4 {
+		t.Fatalf("expected 4 files, got %d", len(r.Files))
+	}
+	f := r.Files[2]
+	if f.FS != "photos" || f.File != "a/1.jpg" || !reflect.DeepEqual(f.Albums, []string{"a", "summer, 2023"}) {
+		t.Errorf("unexpected file: %+v", f)
+	}
+	expectedHistory := []FileEvent{{Action: DiscoveredFile}, {Action: ScannedImage}, {Action: Uploaded}, {Action: Album, Comment: "a"}}
+	if !reflect.DeepEqual(f.History, expectedHistory) {
+		t.Errorf("history: expected %v, got %v", expectedHistory, f.History)
+	}
+}
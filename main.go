@@ -9,8 +9,10 @@ import (
 	"os/signal"
 
 	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/cmd/download"
 	"github.com/simulot/immich-go/cmd/duplicate"
 	"github.com/simulot/immich-go/cmd/metadata"
+	"github.com/simulot/immich-go/cmd/migrate"
 	"github.com/simulot/immich-go/cmd/stack"
 	"github.com/simulot/immich-go/cmd/tool"
 	"github.com/simulot/immich-go/cmd/upload"
@@ -61,13 +63,13 @@ func Run(ctx context.Context) error {
 	fs := flag.NewFlagSet("main", flag.ExitOnError)
 	app.SetFlags(fs)
 
-	err := fs.Parse(os.Args[1:])
+	err := app.Parse(fs, os.Args[1:])
 	if err != nil {
 		return err
 	}
 
 	if len(fs.Args()) == 0 {
-		err = errors.Join(err, errors.New("missing command upload|duplicate|stack|tool"))
+		err = errors.Join(err, errors.New("missing command upload|download|migrate|duplicate|stack|tool"))
 	}
 
 	if err != nil {
@@ -78,6 +80,10 @@ func Run(ctx context.Context) error {
 	switch cmd {
 	case "upload":
 		err = upload.UploadCommand(ctx, &app, fs.Args()[1:])
+	case "download":
+		err = download.DownloadCommand(ctx, &app, fs.Args()[1:])
+	case "migrate":
+		err = migrate.MigrateCommand(ctx, &app, fs.Args()[1:])
 	case "duplicate":
 		err = duplicate.DuplicateCommand(ctx, &app, fs.Args()[1:])
 	case "metadata":
@@ -89,6 +95,7 @@ func Run(ctx context.Context) error {
 	default:
 		err = fmt.Errorf("unknown command: %q", cmd)
 	}
+	err = errors.Join(err, app.WriteReports(), app.SaveAPIRecord())
 
 	if err != nil {
 		log.Error(err.Error())